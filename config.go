@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// the formats we can write the results in
+const (
+	formatCSV   = "csv"
+	formatTSV   = "tsv"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+)
+
+// Config - everything that controls a run, read from a YAML or JSON file and then the command line,
+// with the command line winning. in a config file it looks like
+//
+//	inputs:
+//	  - hl7/raw-hl7
+//	  - hl7/*.dat
+//	extensions: [.hl7, .dat]
+//	recursive: true
+//	output: hl7/results.csv
+//	defaultTimeZone: America/Chicago
+//	timeZones:
+//	  mayo: America/Chicago
+//
+// relative paths in a config file are relative to the file, so it can live next to the data
+type Config struct {
+	// Inputs - directories, files and globs to read messages from. files named directly, or
+	// matched by a glob, are read whatever their extension
+	Inputs []string `json:"inputs"`
+	// Extensions - the extensions of the files to read from the input directories, like .hl7
+	Extensions []string `json:"extensions"`
+	// Recursive - whether to read the directories inside the input directories too
+	Recursive *bool `json:"recursive"`
+	// Output - the file to write the results to, or - for standard output
+	Output string `json:"output"`
+	// Format - csv, tsv, json or jsonl. empty picks the format from the output file's extension,
+	// falling back to csv
+	Format string `json:"format"`
+	// DefaultTimeZone - the IANA time zone for times sent without a UTC offset by senders that
+	// aren't in TimeZones. empty means UTC
+	DefaultTimeZone string `json:"defaultTimeZone"`
+	// TimeZones - the IANA time zone each sender means, keyed by the sender_id column
+	TimeZones map[string]string `json:"timeZones"`
+	// Tables - a directory of local HL7 tables in CSV files, see [hl7Utilities.Tables.LoadCSVDirectory]
+	Tables string `json:"tables"`
+	// Profiles - a directory of conformance profiles, see [hl7Utilities.Profiles.LoadDirectory]
+	Profiles string `json:"profiles"`
+	// Mapping - a YAML or JSON file of columns to read out of the messages with terser paths, added
+	// to the ones in columns.yaml
+	Mapping string `json:"mapping"`
+	// Senders - a YAML or JSON file of the labs we know and what to do differently for them, checked
+	// before the ones in senders.yaml
+	Senders string `json:"senders"`
+	// Rows - how messages are broken up into rows: a row per specimen, per order or per observation.
+	// empty means per specimen
+	Rows string `json:"rows"`
+	// Verbose - prints every row as it's decomposed
+	Verbose bool `json:"verbose"`
+}
+
+// defaultConfig - what we do without a config file or flags, other than knowing where to look
+func defaultConfig() Config {
+	recursive := true
+	return Config{
+		Extensions: []string{".hl7", ".dat"},
+		Recursive:  &recursive,
+		Output:     "results.csv",
+	}
+}
+
+// listFlag - a flag that can be given more than once, or with a comma separated list
+type listFlag []string
+
+// String - the values, for the flag package
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set - adds the values in a comma separated list
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// mapFlag - a flag of key=value pairs that can be given more than once
+type mapFlag map[string]string
+
+// String - the pairs, for the flag package
+func (m mapFlag) String() string {
+	var pairs []string
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set - adds a key=value pair
+func (m mapFlag) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected sender=zone but got '%s'", value)
+	}
+	m[key] = v
+	return nil
+}
+
+// parseCommandLine - works out the config from the arguments, loading the config file they name
+// first and then applying the flags that were given on top of it. arguments that aren't flags are
+// inputs, added to the ones in the config file
+func parseCommandLine(arguments []string, output io.Writer) (Config, error) {
+	flags := flag.NewFlagSet("hl7Decomposer", flag.ContinueOnError)
+	flags.SetOutput(output)
+	var inputs, extensions listFlag
+	timeZones := mapFlag{}
+	configPath := flags.String("config", "", "a YAML or JSON file holding any of the settings below")
+	flags.Var(&inputs, "input", "a directory, file or glob to read messages from, can be repeated")
+	flags.Var(&extensions, "ext", "the extensions of the files to read from directories, like .hl7,.dat")
+	recursive := flags.Bool("recursive", true, "read the directories inside the input directories too")
+	outputPath := flags.String("output", "", "the file to write the results to, or - for standard output (default results.csv)")
+	format := flags.String("format", "", "csv, tsv, json or jsonl (default from the output file's extension)")
+	defaultTimeZone := flags.String("tz", "", "the time zone for times sent without a UTC offset, like America/Chicago")
+	flags.Var(timeZones, "sender-tz", "the time zone a sender means, like mayo=America/Chicago, can be repeated")
+	tables := flags.String("tables", "", "a directory of local HL7 tables in CSV files")
+	profiles := flags.String("profiles", "", "a directory of conformance profiles")
+	mapping := flags.String("mapping", "", "a YAML or JSON file of extra columns to read with terser paths")
+	senders := flags.String("senders", "", "a YAML or JSON file of sender rules, checked before the built in ones")
+	rows := flags.String("rows", "", "a row per specimen, order or observation (default specimen)")
+	verbose := flags.Bool("verbose", false, "print every row as it's decomposed")
+	flags.Usage = func() {
+		fmt.Fprintf(output, "usage: hl7Decomposer [flags] [input ...]\n\n")
+		fmt.Fprintf(output, "decomposes the HL7 lab results in the inputs into rows, one per specimen by default, or\n")
+		fmt.Fprintf(output, "one per order or per observation with -rows order or -rows observation\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(arguments); err != nil {
+		return Config{}, err
+	}
+	config := defaultConfig()
+	if *configPath != "" {
+		loaded, err := loadConfig(*configPath)
+		if err != nil {
+			return Config{}, err
+		}
+		config.merge(loaded)
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "ext":
+			config.Extensions = extensions
+		case "recursive":
+			config.Recursive = recursive
+		case "output":
+			config.Output = *outputPath
+		case "format":
+			config.Format = *format
+		case "tz":
+			config.DefaultTimeZone = *defaultTimeZone
+		case "sender-tz":
+			if config.TimeZones == nil {
+				config.TimeZones = map[string]string{}
+			}
+			for sender, zone := range timeZones {
+				config.TimeZones[sender] = zone
+			}
+		case "tables":
+			config.Tables = *tables
+		case "profiles":
+			config.Profiles = *profiles
+		case "mapping":
+			config.Mapping = *mapping
+		case "senders":
+			config.Senders = *senders
+		case "rows":
+			config.Rows = *rows
+		case "verbose":
+			config.Verbose = *verbose
+		}
+	})
+	config.Inputs = append(config.Inputs, inputs...)
+	config.Inputs = append(config.Inputs, flags.Args()...)
+	return config, config.validate()
+}
+
+// loadConfig - reads a config file, as JSON when its extension is .json and as YAML otherwise
+func loadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	if err := decodeFile(data, strings.EqualFold(filepath.Ext(path), ".json"), &config); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	config.resolvePaths(filepath.Dir(path))
+	return config, nil
+}
+
+// decodeFile - decodes a JSON or YAML file into the value, rejecting settings it doesn't have so a
+// typo doesn't go unnoticed
+func decodeFile(data []byte, isJSON bool, v interface{}) error {
+	if !isJSON {
+		value, err := parseYAML(string(data))
+		if err != nil {
+			return err
+		}
+		// YAML reads into the same values JSON does, so it's decoded the same way from here
+		if data, err = json.Marshal(value); err != nil {
+			return err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// merge - replaces the settings with the ones the other config sets
+func (c *Config) merge(other Config) {
+	if other.Inputs != nil {
+		c.Inputs = other.Inputs
+	}
+	if other.Extensions != nil {
+		c.Extensions = other.Extensions
+	}
+	if other.Recursive != nil {
+		c.Recursive = other.Recursive
+	}
+	if other.Output != "" {
+		c.Output = other.Output
+	}
+	if other.Format != "" {
+		c.Format = other.Format
+	}
+	if other.DefaultTimeZone != "" {
+		c.DefaultTimeZone = other.DefaultTimeZone
+	}
+	if other.TimeZones != nil {
+		c.TimeZones = other.TimeZones
+	}
+	if other.Tables != "" {
+		c.Tables = other.Tables
+	}
+	if other.Profiles != "" {
+		c.Profiles = other.Profiles
+	}
+	if other.Mapping != "" {
+		c.Mapping = other.Mapping
+	}
+	if other.Senders != "" {
+		c.Senders = other.Senders
+	}
+	if other.Rows != "" {
+		c.Rows = other.Rows
+	}
+	c.Verbose = c.Verbose || other.Verbose
+}
+
+// resolvePaths - makes the relative paths relative to the directory
+func (c *Config) resolvePaths(directory string) {
+	resolve := func(path string) string {
+		if path == "" || path == "-" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(directory, path)
+	}
+	for i, input := range c.Inputs {
+		c.Inputs[i] = resolve(input)
+	}
+	c.Output = resolve(c.Output)
+	c.Tables = resolve(c.Tables)
+	c.Profiles = resolve(c.Profiles)
+	c.Mapping = resolve(c.Mapping)
+	c.Senders = resolve(c.Senders)
+}
+
+// validate - checks there's something to read and that we know how to write it
+func (c *Config) validate() error {
+	if len(c.Inputs) == 0 {
+		return fmt.Errorf("no inputs: give the directories, files or globs to read, or list them in a config file")
+	}
+	switch c.format() {
+	case formatCSV, formatTSV, formatJSON, formatJSONL:
+	default:
+		return fmt.Errorf("unknown format '%s': use csv, tsv, json or jsonl", c.Format)
+	}
+	switch c.Rows {
+	case "", rowsPerSpecimen, rowsPerOrder, rowsPerObservation:
+	default:
+		return fmt.Errorf("unknown rows '%s': use specimen, order or observation", c.Rows)
+	}
+	for i, extension := range c.Extensions {
+		extension = strings.ToLower(extension)
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		c.Extensions[i] = extension
+	}
+	_, err := c.timeZones()
+	return err
+}
+
+// format - the format to write, picked from the output file's extension when it isn't set
+func (c *Config) format() string {
+	if c.Format != "" {
+		return strings.ToLower(c.Format)
+	}
+	switch strings.ToLower(filepath.Ext(c.Output)) {
+	case ".tsv", ".tab":
+		return formatTSV
+	case ".json":
+		return formatJSON
+	case ".jsonl", ".ndjson":
+		return formatJSONL
+	}
+	return formatCSV
+}
+
+// timeZones - loads the time zones the config names
+func (c *Config) timeZones() (hl7Utilities.SenderTimeZones, error) {
+	zones := hl7Utilities.SenderTimeZones{Senders: map[string]*time.Location{}}
+	if c.DefaultTimeZone != "" {
+		location, err := time.LoadLocation(c.DefaultTimeZone)
+		if err != nil {
+			return zones, fmt.Errorf("default time zone: %w", err)
+		}
+		zones.Default = location
+	}
+	for sender, zone := range c.TimeZones {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return zones, fmt.Errorf("time zone for %s: %w", sender, err)
+		}
+		zones.Senders[sender] = location
+	}
+	return zones, nil
+}
+
+// apply - sets up the sender rules, time zones, local tables, profiles, extra columns and rows the
+// config names
+func (c *Config) apply() error {
+	if c.Senders != "" {
+		if err := loadSenders(c.Senders); err != nil {
+			return err
+		}
+	}
+	zones, err := c.timeZones()
+	if err != nil {
+		return err
+	}
+	// the config's time zones win over the ones in the sender rules
+	for _, rule := range senderRules {
+		if _, ok := zones.Senders[rule.ID]; !ok && rule.location != nil {
+			zones.Senders[rule.ID] = rule.location
+		}
+	}
+	senderTimeZones = zones
+	rowMode = rowsPerSpecimen
+	if c.Rows != "" {
+		rowMode = c.Rows
+	}
+	if c.Tables != "" {
+		if err := hl7Utilities.DefaultTables.LoadCSVDirectory(c.Tables); err != nil {
+			return err
+		}
+	}
+	if c.Profiles != "" {
+		if err := hl7Utilities.DefaultProfiles.LoadDirectory(c.Profiles); err != nil {
+			return err
+		}
+	}
+	if c.Mapping != "" {
+		if err := loadColumns(c.Mapping); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputFiles - the files to read, in a stable order. globs are expanded, files are taken as they
+// are, and directories are searched for files with one of the extensions
+func (c *Config) inputFiles() ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	for _, input := range c.Inputs {
+		matches := []string{input}
+		if strings.ContainsAny(input, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(input); err != nil {
+				return nil, fmt.Errorf("%s: %w", input, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no files match", input)
+			}
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			found, err := c.directoryFiles(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range found {
+				add(f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// directoryFiles - the files in the directory with one of the extensions, and in the directories
+// inside it when we're recursing
+func (c *Config) directoryFiles(directory string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != directory && (c.Recursive == nil || !*c.Recursive) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if c.hasExtension(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// hasExtension - true when the file has one of the extensions, or there aren't any to match
+func (c *Config) hasExtension(path string) bool {
+	if len(c.Extensions) == 0 {
+		return true
+	}
+	extension := strings.ToLower(filepath.Ext(path))
+	for _, e := range c.Extensions {
+		if e == extension {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	data := `# where the files are
+inputs:
+  - raw-hl7
+  - "aegis/*.hl7"   # quoted because of the *
+extensions: [.hl7, .DAT]
+names: ["Smith, J", 'O''Brien, K', x]
+recursive: false
+output: 'results # today.csv'
+timeZones:
+  mayo: America/Chicago
+empty:
+namespace: NO
+senders:
+- name: mayo
+  zone: America/Chicago
+- name: sonic
+`
+	value, err := parseYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"inputs":     []interface{}{"raw-hl7", "aegis/*.hl7"},
+		"extensions": []interface{}{".hl7", ".DAT"},
+		"names":      []interface{}{"Smith, J", "O'Brien, K", "x"},
+		"recursive":  false,
+		"output":     "results # today.csv",
+		"timeZones":  map[string]interface{}{"mayo": "America/Chicago"},
+		"empty":      nil,
+		"namespace":  "NO",
+		"senders": []interface{}{
+			map[string]interface{}{"name": "mayo", "zone": "America/Chicago"},
+			map[string]interface{}{"name": "sonic"},
+		},
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Logf("expected %v but got %v", expected, value)
+		t.Fail()
+	}
+}
+
+func TestParseYAML_errors(t *testing.T) {
+	cases := map[string]string{
+		"tabs":          "inputs:\n\t- raw-hl7\n",
+		"duplicate key": "output: a.csv\noutput: b.csv\n",
+		"indentation":   "output: a.csv\n  format: csv\n",
+		"not a mapping": "output: a.csv\njust text\n",
+		"quotes":        "output: \"a.csv\n",
+	}
+	for name, data := range cases {
+		if _, err := parseYAML(data); err == nil {
+			t.Logf("%s: expected an error", name)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseCommandLine(t *testing.T) {
+	directory := t.TempDir()
+	yamlConfig := filepath.Join(directory, "config.yaml")
+	err := os.WriteFile(yamlConfig, []byte("inputs: [raw-hl7]\noutput: results.tsv\nrecursive: false\ndefaultTimeZone: America/Chicago\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := parseCommandLine([]string{"-config", yamlConfig, "-ext", "HL7", "extra"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// paths in the file are relative to it, and inputs on the command line are added to its inputs
+	if expected := []string{filepath.Join(directory, "raw-hl7"), "extra"}; !reflect.DeepEqual(config.Inputs, expected) {
+		t.Logf("expected inputs %v but got %v", expected, config.Inputs)
+		t.Fail()
+	}
+	if config.Output != filepath.Join(directory, "results.tsv") || config.format() != formatTSV {
+		t.Logf("expected a TSV in the config's directory but got %s as %s", config.Output, config.format())
+		t.Fail()
+	}
+	if *config.Recursive || !reflect.DeepEqual(config.Extensions, []string{".hl7"}) {
+		t.Logf("expected the config file's recursion and the flag's extensions but got %v, %v", *config.Recursive, config.Extensions)
+		t.Fail()
+	}
+	if zones, _ := config.timeZones(); zones.Default == nil || zones.Default.String() != "America/Chicago" {
+		t.Logf("expected America/Chicago but got %v", zones.Default)
+		t.Fail()
+	}
+	// flags win over the file
+	jsonConfig := filepath.Join(directory, "config.json")
+	err = os.WriteFile(jsonConfig, []byte(`{"inputs": ["raw-hl7"], "format": "json", "timeZones": {"mayo": "America/Chicago"}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = parseCommandLine([]string{"-config", jsonConfig, "-format", "jsonl", "-output", "-", "-sender-tz", "sonic=Australia/Sydney"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.format() != formatJSONL || config.Output != "-" || *config.Recursive != true {
+		t.Logf("expected jsonl on standard output, recursing, but got %s on %s, %v", config.format(), config.Output, *config.Recursive)
+		t.Fail()
+	}
+	if expected := map[string]string{"mayo": "America/Chicago", "sonic": "Australia/Sydney"}; !reflect.DeepEqual(config.TimeZones, expected) {
+		t.Logf("expected time zones %v but got %v", expected, config.TimeZones)
+		t.Fail()
+	}
+}
+
+func TestParseCommandLine_errors(t *testing.T) {
+	directory := t.TempDir()
+	unknown := filepath.Join(directory, "unknown.json")
+	if err := os.WriteFile(unknown, []byte(`{"inputs": ["a"], "outputs": "b"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]string{
+		"no inputs":         {},
+		"unknown format":    {"-format", "xlsx", "a"},
+		"unknown rows":      {"-rows", "panel", "a"},
+		"unknown time zone": {"-tz", "Mars/Olympus_Mons", "a"},
+		"bad sender zone":   {"-sender-tz", "mayo", "a"},
+		"unknown setting":   {"-config", unknown},
+		"missing config":    {"-config", filepath.Join(directory, "missing.yaml")},
+	}
+	for name, arguments := range cases {
+		if _, err := parseCommandLine(arguments, io.Discard); err == nil {
+			t.Logf("%s: expected an error", name)
+			t.Fail()
+		}
+	}
+}
+
+func TestConfig_inputFiles(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"a.hl7", "b.DAT", "notes.txt", "nested/c.hl7", "other/d.txt"} {
+		path := filepath.Join(directory, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recursive, flat := true, false
+	cases := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{"recursive", Config{Inputs: []string{directory}, Extensions: []string{".hl7", ".dat"}, Recursive: &recursive},
+			[]string{"a.hl7", "b.DAT", "nested/c.hl7"}},
+		{"top level only", Config{Inputs: []string{directory}, Extensions: []string{".hl7"}, Recursive: &flat},
+			[]string{"a.hl7"}},
+		// named files are read whatever their extension, and only once
+		{"files and globs", Config{Inputs: []string{filepath.Join(directory, "*.txt"), filepath.Join(directory, "other", "d.txt"), filepath.Join(directory, "other", "*")}, Extensions: []string{".hl7"}, Recursive: &recursive},
+			[]string{"notes.txt", "other/d.txt"}},
+	}
+	for _, c := range cases {
+		files, err := c.config.inputFiles()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		var relative []string
+		for _, f := range files {
+			r, _ := filepath.Rel(directory, f)
+			relative = append(relative, filepath.ToSlash(r))
+		}
+		if !reflect.DeepEqual(relative, c.expected) {
+			t.Logf("%s: expected %v but got %v", c.name, c.expected, relative)
+			t.Fail()
+		}
+	}
+	missing := Config{Inputs: []string{filepath.Join(directory, "*.xml")}}
+	if _, err := missing.inputFiles(); err == nil {
+		t.Log("expected an error for a glob that matches nothing")
+		t.Fail()
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	rows := []map[string]string{
+		{"sender_id": "mayo", "result": "a, b"},
+		{"sender_id": "sonic", "age": "30"},
+	}
+	cases := map[string]string{
+		formatCSV:   "age,result,sender_id\n,\"a, b\",mayo\n30,,sonic\n",
+		formatTSV:   "age\tresult\tsender_id\n\ta, b\tmayo\n30\t\tsonic\n",
+		formatJSONL: "{\"result\":\"a, b\",\"sender_id\":\"mayo\"}\n{\"age\":\"30\",\"sender_id\":\"sonic\"}\n",
+	}
+	for format, expected := range cases {
+		var buffer bytes.Buffer
+		if err := writeResults(&buffer, format, rows); err != nil {
+			t.Fatal(err)
+		}
+		if buffer.String() != expected {
+			t.Logf("%s: expected %q but got %q", format, expected, buffer.String())
+			t.Fail()
+		}
+	}
+	var buffer bytes.Buffer
+	if err := writeResults(&buffer, formatJSON, nil); err != nil || strings.TrimSpace(buffer.String()) != "[]" {
+		t.Logf("expected an empty array but got %q, %v", buffer.String(), err)
+		t.Fail()
+	}
+}
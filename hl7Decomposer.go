@@ -1,23 +1,18 @@
 package main
 
 import (
-	"encoding/csv"
+	"flag"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
-)
-
-// main separator for HL7 fields
-const fieldSeparator = "|"
 
-// subfield separator for HL7
-const subfieldSeparator = "^"
+	"hl7Decomposer/hl7Utilities"
+)
 
 // date formats in Go are kind of...dumb. you specify the format for your date
 // by telling Go what the data 02-Jan 3:04:05 PM 2006 -0700 looks like when parsing dates
@@ -26,11 +21,24 @@ const subfieldSeparator = "^"
 // month	day		hour	minute		second		year (as 2006)		offset (in negative)
 const longDateFormat = "20060102150405-0700"
 
-const shortDateFormat = "20060102"
+var results []map[string]string
 
-const mediumDateFormat = "200601021504"
+// the ways a message can be broken up into rows
+const (
+	// rowsPerSpecimen - a row for each SPM, with the result of the order it's in
+	rowsPerSpecimen = "specimen"
+	// rowsPerOrder - a row for each ORDER_OBSERVATION group, with its OBR and its specimen
+	rowsPerOrder = "order"
+	// rowsPerObservation - a row for each OBX, with the order and specimen it belongs to
+	rowsPerObservation = "observation"
+)
 
-var results []map[string]string
+// rowMode - how messages are broken up into rows, from the config
+var rowMode = rowsPerSpecimen
+
+// senderTimeZones - the time zone each sender means when they leave the UTC offset off a date, from
+// the config. senders it doesn't name are UTC
+var senderTimeZones = hl7Utilities.SenderTimeZones{}
 
 // keys - returns the keys for a map
 func keys[K string, V string](m map[K]V) []K {
@@ -44,122 +52,140 @@ func keys[K string, V string](m map[K]V) []K {
 	return keys
 }
 
-// parseDate - Given a string, try to parse the dates per the formats we know
-// in these files and return a [time.Time] object
-func parseDate(date string) (time.Time, error) {
-	var parsedDate time.Time
-	var err error
+// parseDate - Given a string, parse it as an HL7 date in whatever precision
+// the sender used and return a [time.Time] object
+func parseDate(date string, componentSeparator string, sender string) (time.Time, error) {
 	// put some bumpers around the date value
-	if strings.Contains(date, subfieldSeparator) {
+	if strings.Contains(date, componentSeparator) {
 		// mayo is now sending the age! but it blows up this logic
-		dateParts := strings.Split(date, subfieldSeparator)
+		dateParts := strings.Split(date, componentSeparator)
 		// strip off the date portion
 		date = dateParts[0]
 	}
-	if len(date) == 8 {
-		parsedDate, err = time.Parse(shortDateFormat, date)
-	} else if len(date) == 12 {
-		parsedDate, err = time.Parse(mediumDateFormat, date)
-	} else {
-		parsedDate, err = time.Parse(longDateFormat, date)
-	}
-	return parsedDate, err
+	parsedDate, err := senderTimeZones.ParseDTM(sender, date)
+	return parsedDate.Time, err
 }
 
 // getPatientAge - given two string representations of dates, parse them
-// and then get the distance between as a float64 value representing years
-// however, Mayo now sends us the age as part of the DOB, so I have to split
-// that off and if we have it, and it's a real numeric value, return that instead
-func getPatientAge(patientDob, messageDate string) float64 {
-	if strings.Contains(patientDob, subfieldSeparator) {
-		// this should be the date portion AND the age portion. it will look like 19000101^30Y
-		// this is non-standard HL7, so we need to handle it manually here
-		patientDobParts := strings.Split(patientDob, subfieldSeparator)
-		rawPatientAge := patientDobParts[1]
-		ageRegex := regexp.MustCompile(`^\d+`)
-		matches := ageRegex.FindAllString(rawPatientAge, -1)
-		if len(matches) > 0 {
-			// ignore the error
-			age, _ := strconv.ParseFloat(matches[0], 64)
-			return age
-		} else {
-			return 122
-		}
-	} else {
-		reportingDate, err := parseDate(messageDate)
-		check(err)
-		var dob time.Time
-		dob, err = parseDate(patientDob)
-		check(err)
-		timeBetween := reportingDate.Sub(dob)
-		return timeBetween.Minutes() / (60 * 24 * 365)
+// and then get the distance between as a float64 value representing years.
+// senders that send the age some other way fix it up with a quirk, see senders.go
+func getPatientAge(patientDob, messageDate string, componentSeparator string, sender string) (float64, error) {
+	reportingDate, err := parseDate(messageDate, componentSeparator, sender)
+	if err != nil {
+		return 0, err
+	}
+	dob, err := parseDate(patientDob, componentSeparator, sender)
+	if err != nil {
+		return 0, err
 	}
+	timeBetween := reportingDate.Sub(dob)
+	return timeBetween.Minutes() / (60 * 24 * 365), nil
+}
+
+func parseAndFormatDate(rawDate string, componentSeparator string, sender string) string {
+	return formatDate(rawDate, componentSeparator, sender, longDateFormat)
 }
 
-func parseAndFormatDate(rawDate string) string {
-	date, err := parseDate(rawDate)
+// formatDate - parses the date and writes it out with the layout, or returns it as it was sent when
+// it can't be parsed
+func formatDate(rawDate string, componentSeparator string, sender string, layout string) string {
+	date, err := parseDate(rawDate, componentSeparator, sender)
 	if err != nil {
-		fmt.Printf("Error parsing date: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error parsing date: %v\n", err)
 		return rawDate
 	}
-	return date.Format(longDateFormat)
+	return date.Format(layout)
 }
 
-// given an HL7 message from a file, clean it up, and convert it
-// into an array of string
-func getHl7MessageAsList(message string) []string {
-	hl7Message := strings.TrimSpace(message)
-	hl7Message = strings.ReplaceAll(hl7Message, "\r", "\n")
-	// split the string
-	return strings.Split(hl7Message, "\n")
+// headerValue - looks up a value in a message header with a terser specification, returning an empty
+// string when the sender left it out
+func headerValue(message hl7Utilities.Hl7Message, specification string) string {
+	value, err := message.GetRaw(specification)
+	if err != nil {
+		return ""
+	}
+	return *value
 }
 
 // take the cleaned up message, split it, and then start processing it
-func processHl7Message(hl7Message, fileName string) {
+func processHl7Message(hl7Message hl7Utilities.Hl7Message, fileName string) {
 	var values map[string]string
-	messageParts := getHl7MessageAsList(hl7Message)
-	for _, s := range messageParts {
-		cleaned := strings.TrimSpace(s)
-		// skip empty lines
-		if len(cleaned) == 0 {
-			continue
+	parsed, err := hl7Message.Parse()
+	check(err)
+	checkProfile(fileName, parsed)
+	// every message declares its own delimiters in MSH-1 and MSH-2
+	delimiters := parsed.Delimiters
+	// the version from MSH-12, which decides where a few components live
+	version := ""
+	// the segments the columns in columns.yaml are read from
+	row := newRowContext(parsed)
+	// the observations in the order we're in. the order's specimen comes after them, so they only
+	// become rows when the order ends
+	var observations []*hl7Utilities.ParsedSegment
+	// whether we're in an order, and whether it's had its OBR yet
+	inOrder, orderHasOBR := false, false
+	// endOrder - writes out the rows for the order we're in, when there's a row per order or per
+	// observation
+	endOrder := func() {
+		switch rowMode {
+		case rowsPerOrder:
+			if inOrder {
+				results = append(results, row.build(values, orderColumns))
+			}
+		case rowsPerObservation:
+			for _, obx := range observations {
+				row.add(obx)
+				observation := row.build(values, orderColumns, observationColumns)
+				observation["observation_value"] = observationValue(obx, delimiters, version)
+				results = append(results, observation)
+			}
 		}
-		// get the segment
-		segment := cleaned[0:3]
-		switch segment {
+		observations = nil
+		inOrder, orderHasOBR = false, false
+	}
+	for _, segment := range parsed.Segments {
+		// an ORC starts a new order, and so does an OBR when the order we're in already has one, so
+		// nothing from the last order carries over into it
+		if segment.Name == "ORC" || (segment.Name == "OBR" && orderHasOBR) {
+			endOrder()
+			row.remove("ORC", "OBR", "OBX", "SPM")
+			for _, key := range []string{"test_result", "patient_age", "specimen_type"} {
+				delete(values, key)
+			}
+		}
+		row.add(segment)
+		switch segment.Name {
 		case "MSH":
 			// create our map
 			values = make(map[string]string)
 			// add the file name to the CSV
 			values["file_name"] = fileName
-			msh := strings.Split(cleaned, fieldSeparator)
-			// get the sender ID from MSH-3
-			labName := strings.Split(msh[2], subfieldSeparator)[0]
-			// normalize the lab names since the MSH fields can have different values
-			switch strings.ToLower(labName) {
-			case "mayo clinic rd":
-				values["sender_id"] = "mayo"
-			case "corep.sonichealth.pr", "corep.sonichealth.st":
-				values["sender_id"] = "sonic"
-			case "aegis", "horizon":
-				values["sender_id"] = "aegis"
-			default:
-				values["sender_id"] = labName
+			// normalize the lab names since the MSH fields can have different values, falling back
+			// to the name in MSH-3 for the labs we don't know
+			row.rule = matchSender(parsed)
+			if row.rule != nil {
+				values["sender_id"] = row.rule.ID
+			} else {
+				values["sender_id"] = delimiters.Decode(headerValue(hl7Message, "MSH-3-1"))
 			}
 			values["lab_name"] = values["sender_id"]
-			values["message_date"] = parseAndFormatDate(msh[6])
-			values["reporting_date"] = msh[6]
-			values["message_id"] = msh[9]
+			row.sender = values["sender_id"]
+			values["message_date"] = parseAndFormatDate(headerValue(hl7Message, "MSH-7"), delimiters.Component, values["sender_id"])
+			version = headerValue(hl7Message, "MSH-12-1")
 		case "OBX":
-			obx := strings.Split(cleaned, fieldSeparator)
+			observations = append(observations, segment)
+			obx, err := hl7Utilities.NewSegment[hl7Utilities.OBX](segment, delimiters)
+			check(err)
+			valueType := obx.ValueType().Value()
+			checkCode(fileName, "OBX-11", "0085", obx.ObservationResultStatus().Value())
 			// skip any AOEs
-			if obx[1] == "1" && (obx[2] == "CE" || obx[2] == "CWE") {
-				testResult := strings.Split(obx[5], subfieldSeparator)
-				values["test_result"] = testResult[1]
+			if obx.SetId().Value() == "1" && (valueType == "CE" || valueType == "CWE") {
+				testResult := hl7Utilities.NewCWE(obx.ObservationValue().Repetition(0), delimiters, version)
+				values["test_result"] = testResult.Text
 			} else {
 				// parse out the patient age
-				if obx[2] == "NM" && obx[3] == "30525-0" {
-					patientAge, err := strconv.ParseInt(obx[5], 0, 64)
+				if valueType == "NM" && obx.ObservationIdentifier().Value() == "30525-0" {
+					patientAge, err := strconv.ParseInt(obx.ObservationValue().Value(), 0, 64)
 					if err == nil {
 						values["patient_age"] = fmt.Sprintf("%d", patientAge)
 					} else {
@@ -167,103 +193,108 @@ func processHl7Message(hl7Message, fileName string) {
 					}
 				}
 			}
+		case "ORC":
+			inOrder = true
 		case "OBR":
+			inOrder, orderHasOBR = true, true
 		case "PID":
-			pid := strings.Split(cleaned, fieldSeparator)
-			patientId := strings.Split(pid[3], subfieldSeparator)
-			patientAddress := strings.Split(pid[11], subfieldSeparator)
-			patientRace := strings.Split(pid[10], subfieldSeparator)
-			patientEthnicity := strings.Split(pid[22], subfieldSeparator)
+			pid, err := hl7Utilities.NewSegment[hl7Utilities.PID](segment, delimiters)
+			check(err)
+			// these can all repeat, and we only ever want the first one
+			patientRace := hl7Utilities.NewCWE(pid.Race().Repetition(0), delimiters, version)
+			patientEthnicity := hl7Utilities.NewCWE(pid.EthnicGroup().Repetition(0), delimiters, version)
+			// the date of birth, without anything a sender puts after it, like mayo's ages
+			birthDate := pid.DateTimeOfBirth().Value()
 			// get the patient age
-			age := getPatientAge(pid[7], values["message_date"])
-			dob, _ := parseDate(pid[7])
-			values["pt_id"] = patientId[0]
-			values["pt_dob"] = dob.Format("20060102") // see other notes about Go date formatting
-			values["pt_age"] = fmt.Sprintf("%.0f", math.Abs(math.Floor(age)))
-			values["pt_sex"] = pid[8]
-			values["pt_state"] = strings.TrimSpace(patientAddress[3])
-			if len(patientRace) > 1 {
-				values["pt_race"] = strings.TrimSpace(patientRace[1])
+			if age, err := getPatientAge(birthDate, values["message_date"], delimiters.Component, values["sender_id"]); err == nil {
+				values["pt_age"] = fmt.Sprintf("%.0f", math.Abs(math.Floor(age)))
 			} else {
-				values["pt_race"] = strings.TrimSpace(patientRace[0])
+				fmt.Fprintf(os.Stderr, "%s: PID-7: %v\n", fileName, err)
 			}
-			if len(patientEthnicity) > 1 {
-				values["pt_ethnicity"] = strings.TrimSpace(patientEthnicity[1])
-			} else {
-				values["pt_ethnicity"] = strings.TrimSpace(patientEthnicity[0])
+			dob, _ := parseDate(birthDate, delimiters.Component, values["sender_id"])
+			values["pt_dob"] = dob.Format("20060102") // see other notes about Go date formatting
+			values["pt_race"] = strings.TrimSpace(codedDisplay(patientRace, "0005"))
+			values["pt_ethnicity"] = strings.TrimSpace(codedDisplay(patientEthnicity, "0189"))
+			// these go into the CSV as they are, so flag the codes we don't recognize
+			checkCode(fileName, "PID-8", "0001", pid.Decode(pid.AdministrativeSex().Value()))
+			if patientRace.UsesTable("0005") {
+				checkCode(fileName, "PID-10", "0005", patientRace.Identifier)
+			}
+			if patientEthnicity.UsesTable("0189") {
+				checkCode(fileName, "PID-22", "0189", patientEthnicity.Identifier)
 			}
 
 		case "SPM":
 			// get spm values
-			spm := strings.Split(cleaned, fieldSeparator)
-			specimenType := strings.Split(spm[4], subfieldSeparator)
-			if len(specimenType) > 0 {
-				if values["lab_name"] == "mayo" && len(specimenType) == 8 {
-					values["specimen_type"] = strings.ToUpper(strings.TrimSpace(specimenType[3]))
-				} else {
-					values["specimen_type"] = strings.ToUpper(strings.TrimSpace(specimenType[1]))
-				}
-			} else {
-				values["specimen_type"] = ""
-			}
-			if len(spm) >= 18 {
-				values["specimen_collection_date"] = parseAndFormatDate(spm[17])
-				values["specimen_received_date"] = parseAndFormatDate(spm[18])
-			} else {
-				values["specimen_collection_date"] = values["message_date"]
-				values["specimen_received_date"] = values["message_date"]
-			}
-			// append to the array
-			results = append(results, values)
-		case "ORC":
-			orc := strings.Split(cleaned, fieldSeparator)
-			// get the accession number
-			fillerOrderNumber := strings.Split(orc[3], subfieldSeparator)
-			values["filler_order_number"] = strings.TrimSpace(strings.ToUpper(fillerOrderNumber[0]))
-			orderingFacilityName := orc[21]
-			// these apparently contain the caret sometimes, which is silly. strip it rabbit
-			if strings.Index(orderingFacilityName, subfieldSeparator) > 0 {
-				nameParts := strings.Split(orderingFacilityName, subfieldSeparator)
-				orderingFacilityName = nameParts[0]
-			}
-			// get the ordering facility information
-			orderingFacilityAddress := strings.Split(orc[22], subfieldSeparator)
-			values["ordering_facility_state"] = strings.TrimSpace(orderingFacilityAddress[3])
-			values["ordering_facility_zip"] = strings.TrimSpace(orderingFacilityAddress[4])
-			if len(orderingFacilityAddress) >= 9 {
-				values["ordering_facility_county"] = strings.TrimSpace(orderingFacilityAddress[8])
-			} else {
-				values["ordering_facility_county"] = ""
-			}
-			values["ordering_facility_name"] = strings.ToUpper(strings.TrimSpace(orderingFacilityName))
-			// now the ordering provider information. not every lab sends us this, so we can default this
-			// to be the ordering facility information if it doesn't exist
-			orderingProviderName := strings.Split(orc[12], subfieldSeparator)
-			providerName := fmt.Sprintf(
-				"%s %s",
-				strings.TrimSpace(orderingProviderName[2]),
-				strings.TrimSpace(orderingProviderName[1]),
-			)
-			values["ordering_provider_name"] = strings.ToUpper(providerName)
-			if len(orc) >= 25 {
-				orderingProviderAddress := strings.Split(orc[24], subfieldSeparator)
-				values["ordering_provider_state"] = strings.TrimSpace(orderingProviderAddress[3])
-				values["ordering_provider_zip"] = strings.TrimSpace(orderingProviderAddress[4])
-				if len(orderingProviderAddress) >= 9 {
-					values["ordering_provider_county"] = strings.TrimSpace(orderingProviderAddress[8])
-				} else {
-					values["ordering_provider_county"] = ""
-				}
-			} else {
-				values["ordering_provider_state"] = values["ordering_facility_state"]
-				values["ordering_provider_zip"] = values["ordering_facility_zip"]
-				values["ordering_provider_county"] = values["ordering_facility_county"]
+			spm, err := hl7Utilities.NewSegment[hl7Utilities.SPM](segment, delimiters)
+			check(err)
+			specimenType := hl7Utilities.NewCWE(spm.SpecimenType().Repetition(0), delimiters, version)
+			values["specimen_type"] = strings.ToUpper(strings.TrimSpace(specimenType.Text))
+			if rowMode == rowsPerSpecimen {
+				results = append(results, row.build(values))
 			}
 		default:
 			// skip NTE and SFT and headers and footers oh my
 			continue
 		}
 	}
+	endOrder()
+}
+
+// observationValue - the value of an observation as text, using the text of coded values and
+// putting a structured numeric back together, like >=10
+func observationValue(segment *hl7Utilities.ParsedSegment, delimiters hl7Utilities.Delimiters, version string) string {
+	obx, err := hl7Utilities.NewSegment[hl7Utilities.OBX](segment, delimiters)
+	check(err)
+	var values []string
+	for i := 0; obx.ObservationValue().Repetition(i) != nil; i++ {
+		r := obx.ObservationValue().Repetition(i)
+		separator := " "
+		switch obx.ValueType().Value() {
+		case "CE", "CWE", "CNE":
+			values = append(values, hl7Utilities.NewCWE(r, delimiters, version).DisplayText())
+			continue
+		case "SN":
+			separator = ""
+		}
+		var parts []string
+		for _, c := range r.Components {
+			parts = append(parts, delimiters.Decode(c.Value()))
+		}
+		values = append(values, strings.TrimSpace(strings.Join(parts, separator)))
+	}
+	return strings.Join(values, "; ")
+}
+
+// codedDisplay - the text the sender gave a coded value, or the display from the HL7 table when
+// they only sent the code
+func codedDisplay(value hl7Utilities.CWE, table string) string {
+	if value.Text == "" && value.UsesTable(table) {
+		if display, ok := hl7Utilities.DefaultTables.Display(table, value.Identifier); ok {
+			return display
+		}
+	}
+	return value.DisplayText()
+}
+
+// checkCode - prints a warning when a code isn't in its HL7 table
+func checkCode(fileName, location, table, code string) {
+	if code == "" {
+		return
+	}
+	if err := hl7Utilities.DefaultTables.Check(table, code); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %v\n", fileName, location, err)
+	}
+}
+
+// checkProfile - prints the report for a message that doesn't follow the profile it names in MSH-21.
+// messages that don't name one we have are left alone
+func checkProfile(fileName string, message *hl7Utilities.ParsedMessage) {
+	report, err := message.ValidateProfile()
+	if err != nil || len(report.Issues) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\n", fileName, report)
 }
 
 // checks for an error on a result, like reading a file, etc
@@ -273,91 +304,89 @@ func check(e error) {
 	}
 }
 
-// reads the file and returns a string of the contents
-// this is very naive because if the file was very big it could
-// take a long time
-func readFile(filePath string) string {
-	data, err := os.ReadFile(filePath)
-	check(err)
-	return string(data)
-}
-
-// recurse some directories
-func walkResultsDirs(path string, extension string) {
-	var hl7Message string
-	dir, err := os.ReadDir(path)
+// reads the messages in the file one at a time, so even a very big
+// batch file never has to be in memory all at once
+func processHl7File(filePath, fileName string) {
+	file, err := os.Open(filePath)
 	check(err)
-	for _, entry := range dir {
-		if entry.IsDir() {
-			// recurse in
-			walkResultsDirs(filepath.Join(path, entry.Name()), extension)
-		} else {
-			fileName := entry.Name()
-			ext := strings.ToLower(filepath.Ext(fileName))
-			if ext == extension {
-				fmt.Println(fileName)
-				fullPath := filepath.Join(path, fileName)
-				hl7Message = readFile(fullPath)
-				processHl7Message(hl7Message, fileName)
-			}
-		}
+	defer file.Close()
+	scanner := hl7Utilities.NewScanner(file)
+	for scanner.Scan() {
+		processHl7Message(scanner.Message(), fileName)
 	}
+	check(scanner.Err())
 }
 
 // our main method
 func main() {
-	// this is our collection of paths to check
-	var paths = map[string]string{
-		"/Users/maurice/Downloads/hl7/":              ".dat",
-		"/Users/maurice/Downloads/hl7/raw-hl7":       ".hl7",
-		"/Users/maurice/Downloads/hl7/aegis/raw-hl7": ".hl7",
+	config, err := parseCommandLine(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		return
 	}
-	// loop the map and process
-	for dirPath, extension := range paths {
-		// walk the directory
-		walkResultsDirs(dirPath, extension)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hl7Decomposer: %v\n", err)
+		os.Exit(2)
 	}
-	// open our output folder
-	dirPath := "/Users/maurice/Downloads/hl7/"
-	// get a count of each lab's results
-	countAegis, countSonic, countMayo, countOther := 0, 0, 0, 0
-	otherLabNames := make([]string, 0, 10)
-	// output our decomposed list of values
-	for _, entry := range results {
-		// output the entry
-		fmt.Println(entry)
-		// get the count by lab name
-		switch entry["lab_name"] {
-		case "aegis":
-			countAegis += 1
-		case "sonic":
-			countSonic += 1
-		case "mayo":
-			countMayo += 1
-		default:
-			countOther += 1
-			otherLabNames = append(otherLabNames, entry["lab_name"])
-		}
+	if err := run(config); err != nil {
+		fmt.Fprintf(os.Stderr, "hl7Decomposer: %v\n", err)
+		os.Exit(1)
 	}
-	fmt.Printf("Aegis: %d, Sonic: %d, Mayo: %d, Other: %d\n", countAegis, countSonic, countMayo, countOther)
-	fmt.Println(otherLabNames)
-	file, err := os.Create(dirPath + "results.csv")
-	check(err)
-	defer file.Close()
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// senderCounts - how many rows came from each sender, like "aegis: 3, mayo: 12", in order of the
+// sender IDs so the summary reads the same every run
+func senderCounts(rows []map[string]string) string {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		sender := row["sender_id"]
+		if sender == "" {
+			sender = "unknown"
+		}
+		counts[sender]++
+	}
+	senders := make([]string, 0, len(counts))
+	for sender := range counts {
+		senders = append(senders, sender)
+	}
+	sort.Strings(senders)
+	summary := make([]string, 0, len(senders))
+	for _, sender := range senders {
+		summary = append(summary, fmt.Sprintf("%s: %d", sender, counts[sender]))
+	}
+	return strings.Join(summary, ", ")
+}
 
-	fmt.Printf("keys in our results: %v\n", keys(results[0]))
-	keys := keys(results[0])
-	// write out our headers
-	writer.Write(keys)
-	// decompose
-	for _, entry := range results {
-		l := make([]string, 0, len(keys))
-		for _, key := range keys {
-			l = append(l, entry[key])
+// run - decomposes the messages in the files the config names and writes out the results
+func run(config Config) error {
+	if err := config.apply(); err != nil {
+		return err
+	}
+	files, err := config.inputFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		fileName := filepath.Base(path)
+		fmt.Fprintln(os.Stderr, fileName)
+		processHl7File(path, fileName)
+	}
+	if config.Verbose {
+		for _, entry := range results {
+			fmt.Fprintln(os.Stderr, entry)
 		}
-		writer.Write(l)
 	}
+	// get a count of each lab's results
+	fmt.Fprintln(os.Stderr, senderCounts(results))
+	if config.Output == "-" {
+		return writeResults(os.Stdout, config.format(), results)
+	}
+	file, err := os.Create(config.Output)
+	if err != nil {
+		return err
+	}
+	if err := writeResults(file, config.format(), results); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
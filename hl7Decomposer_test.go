@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// panelMessage - two orders, the first a panel with three results and the second a single coded result
+const panelMessage = "MSH|^~\\&|LAB|FAC|||20220802003337-0500||ORU^R01^ORU_R01|CTRL1|P|2.5.1\r" +
+	"PID|1||M1^^^LAB||DOE^JANE||19800101|F\r" +
+	"ORC|RE||acc1\r" +
+	"OBR|1||acc1|24323-8^Metabolic panel^LN|||20220801080000\r" +
+	"OBX|1|NM|2345-7^Glucose^LN||95|mg/dL|70-99|N|||F\r" +
+	"OBX|2|SN|2160-0^Creatinine^LN||<^0.5|mg/dL||L|||F\r" +
+	"OBX|3|ST|8251-1^Comment^LN||fasting~hemolyzed||||||F\r" +
+	"SPM|1|||119297000^Blood^SCT|||||||||||||20220801070000\r" +
+	"ORC|RE||acc2\r" +
+	"OBR|2||acc2|94500-6^SARS-CoV-2 RNA^LN\r" +
+	"OBX|1|CWE|94500-6^SARS-CoV-2 RNA^LN||260415000^Not detected^SCT||||||F\r" +
+	"SPM|2|||258500001^Nasopharyngeal swab^SCT\r"
+
+// decompose - the rows for the message when it's broken up the way the mode says
+func decompose(t *testing.T, mode string) []map[string]string {
+	savedMode, savedResults := rowMode, results
+	defer func() { rowMode, results = savedMode, savedResults }()
+	rowMode, results = mode, nil
+	processHl7Message(hl7Utilities.Hl7Message{RawMessage: panelMessage}, "panel.hl7")
+	return results
+}
+
+// expectRows - checks the rows have the values, leaving the columns it doesn't mention alone
+func expectRows(t *testing.T, mode string, rows []map[string]string, expected []map[string]string) {
+	if len(rows) != len(expected) {
+		t.Fatalf("%s: expected %d rows but got %d: %v", mode, len(expected), len(rows), rows)
+	}
+	for i, e := range expected {
+		for column, value := range e {
+			if rows[i][column] != value {
+				t.Logf("%s: row %d: expected %s to be '%s' but got '%s'", mode, i, column, value, rows[i][column])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestProcessHl7Message_rowsPerSpecimen(t *testing.T) {
+	rows := decompose(t, rowsPerSpecimen)
+	// each specimen keeps its own order's values, rather than every row ending up with the last ones
+	expectRows(t, rowsPerSpecimen, rows, []map[string]string{
+		{"filler_order_number": "ACC1", "specimen_type": "BLOOD", "test_result": "", "specimen_collection_date": "20220801070000+0000"},
+		{"filler_order_number": "ACC2", "specimen_type": "NASOPHARYNGEAL SWAB", "test_result": "Not detected", "specimen_collection_date": "20220802003337-0500"},
+	})
+	if _, ok := rows[0]["observation_value"]; ok {
+		t.Log("expected no observation columns with a row per specimen")
+		t.Fail()
+	}
+}
+
+func TestProcessHl7Message_rowsPerOrder(t *testing.T) {
+	rows := decompose(t, rowsPerOrder)
+	expectRows(t, rowsPerOrder, rows, []map[string]string{
+		{"filler_order_number": "ACC1", "order_code": "24323-8", "order_text": "Metabolic panel", "order_date": "20220801080000+0000", "specimen_type": "BLOOD", "pt_id": "M1"},
+		{"filler_order_number": "ACC2", "order_code": "94500-6", "order_date": "", "specimen_type": "NASOPHARYNGEAL SWAB", "test_result": "Not detected", "pt_id": "M1"},
+	})
+}
+
+func TestProcessHl7Message_rowsPerObservation(t *testing.T) {
+	rows := decompose(t, rowsPerObservation)
+	expectRows(t, rowsPerObservation, rows, []map[string]string{
+		{"filler_order_number": "ACC1", "order_code": "24323-8", "specimen_type": "BLOOD", "observation_set_id": "1", "observation_code": "2345-7", "observation_value": "95", "observation_units": "mg/dL", "observation_reference_range": "70-99", "observation_date": "20220801080000+0000"},
+		{"filler_order_number": "ACC1", "observation_set_id": "2", "observation_code": "2160-0", "observation_value": "<0.5", "observation_abnormal_flags": "L"},
+		{"filler_order_number": "ACC1", "observation_set_id": "3", "observation_text": "Comment", "observation_value": "fasting; hemolyzed", "observation_units": ""},
+		// the specimen comes after the observations, and is still joined in
+		{"filler_order_number": "ACC2", "specimen_type": "NASOPHARYNGEAL SWAB", "observation_value_type": "CWE", "observation_value": "Not detected", "observation_status": "F", "pt_id": "M1"},
+	})
+}
+
+func TestSenderCounts(t *testing.T) {
+	rows := []map[string]string{
+		{"sender_id": "mayo"},
+		{"sender_id": "newlab"},
+		{"sender_id": "mayo"},
+		{},
+		{"sender_id": "aegis"},
+	}
+	// a lab onboarded in senders.yaml gets its own count, however many rows it has
+	if summary, expected := senderCounts(rows), "aegis: 1, mayo: 2, newlab: 1, unknown: 1"; summary != expected {
+		t.Logf("expected '%s' but got '%s'", expected, summary)
+		t.Fail()
+	}
+}
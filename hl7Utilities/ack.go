@@ -0,0 +1,204 @@
+package hl7Utilities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the acknowledgment codes for MSA-1, from HL7 table 0008
+const (
+	// AckApplicationAccept - the message was processed
+	AckApplicationAccept = "AA"
+	// AckApplicationError - the message couldn't be processed, but sending it again may work
+	AckApplicationError = "AE"
+	// AckApplicationReject - the message was refused, and sending it again as it is won't help
+	AckApplicationReject = "AR"
+)
+
+// the severities for ERR-4, from HL7 table 0516
+const (
+	SeverityError       = "E"
+	SeverityWarning     = "W"
+	SeverityInformation = "I"
+)
+
+// the error codes for ERR-3, or the fourth component of ERR-1 before v2.5, from HL7 table 0357
+const (
+	ErrorCodeSegmentSequence      = "100"
+	ErrorCodeRequiredFieldMissing = "101"
+	ErrorCodeDataType             = "102"
+	ErrorCodeTableValueNotFound   = "103"
+	ErrorCodeValueTooLong         = "104"
+	ErrorCodeUnsupportedMessage   = "200"
+	ErrorCodeUnsupportedEvent     = "201"
+	ErrorCodeUnsupportedProcessId = "202"
+	ErrorCodeUnsupportedVersion   = "203"
+	ErrorCodeUnknownKey           = "204"
+	ErrorCodeDuplicateKey         = "205"
+	ErrorCodeApplicationRecord    = "206"
+	ErrorCodeApplicationInternal  = "207"
+)
+
+// errorCodeText - the descriptions HL7 gives the codes in table 0357
+var errorCodeText = map[string]string{
+	ErrorCodeSegmentSequence:      "Segment sequence error",
+	ErrorCodeRequiredFieldMissing: "Required field missing",
+	ErrorCodeDataType:             "Data type error",
+	ErrorCodeTableValueNotFound:   "Table value not found",
+	ErrorCodeValueTooLong:         "Value too long",
+	ErrorCodeUnsupportedMessage:   "Unsupported message type",
+	ErrorCodeUnsupportedEvent:     "Unsupported event code",
+	ErrorCodeUnsupportedProcessId: "Unsupported processing id",
+	ErrorCodeUnsupportedVersion:   "Unsupported version id",
+	ErrorCodeUnknownKey:           "Unknown key identifier",
+	ErrorCodeDuplicateKey:         "Duplicate key identifier",
+	ErrorCodeApplicationRecord:    "Application record locked",
+	ErrorCodeApplicationInternal:  "Application internal error",
+}
+
+// AckError - one problem with a message, reported back to the sender in an ERR segment
+type AckError struct {
+	// Segment - the segment the problem is in, like PID. empty when it's about the whole message
+	Segment string
+	// Sequence - which occurrence of the segment, starting at 1. zero means the first
+	Sequence int
+	// Field, Repetition, Component and Subcomponent - where in the segment the problem is, starting
+	// at 1. zero leaves that part of the location out
+	Field        int
+	Repetition   int
+	Component    int
+	Subcomponent int
+	// Code - the HL7 error code, one of the ErrorCode constants. empty means 207, an internal error
+	Code string
+	// Severity - E, W or I. empty means E. only v2.5 and later can say this
+	Severity string
+	// Text - what went wrong, for a person to read
+	Text string
+}
+
+// ackSequence - makes the control IDs of the ACKs we generate unique even within the same second
+var ackSequence int64
+
+// GenerateAck - builds the acknowledgment for the message, addressed back to whoever sent it. MSH-3
+// and MSH-4 swap with MSH-5 and MSH-6, MSH-9 becomes ACK^<trigger>^ACK, and the MSA carries the code
+// and the message's control ID. each error becomes an ERR segment, using ERR-2 and ERR-3 for v2.5
+// and later and ERR-1 before that.
+//
+// a message too broken to parse still gets an ACK, with whatever can be salvaged from its MSH and
+// the default delimiters when it doesn't declare usable ones of its own
+func GenerateAck(message Hl7Message, code string, errors []AckError) Hl7Message {
+	delimiters, err := message.Delimiters()
+	if err != nil {
+		delimiters = DefaultDelimiters
+	}
+	// fall back to splitting the MSH ourselves when the terser can't read it, which at least gets the
+	// fields of a message whose encoding characters are broken
+	msh, _ := message.Preprocess()
+	field := func(specification string) string {
+		value, err := message.GetRaw(specification)
+		if err == nil {
+			return *value
+		}
+		spec, err := parseTerserSpecification(specification)
+		if err != nil || len(spec.FieldIndices) == 0 || len(msh.MessageParts) == 0 {
+			return ""
+		}
+		raw := mshField(msh.MessageParts, int(spec.FieldIndices[0].Index))
+		if len(spec.FieldIndices) > 1 && msh.EncodingCharacters != "" {
+			components := strings.Split(raw, msh.EncodingCharacters[0:1])
+			return mshField(append([]string{""}, components...), int(spec.FieldIndices[1].Index))
+		}
+		return raw
+	}
+	version := field("MSH-12-1")
+	now := time.Now()
+	sequence := atomic.AddInt64(&ackSequence, 1)
+	segments := []string{
+		strings.Join([]string{
+			"MSH",
+			delimiters.EncodingCharacters(),
+			field("MSH-5"),
+			field("MSH-6"),
+			field("MSH-3"),
+			field("MSH-4"),
+			now.Format("20060102150405-0700"),
+			"",
+			strings.Join([]string{"ACK", field("MSH-9-2"), "ACK"}, delimiters.Component),
+			fmt.Sprintf("%s%06d", now.Format("20060102150405"), sequence%1000000),
+			field("MSH-11"),
+			field("MSH-12"),
+		}, delimiters.Field),
+		strings.Join([]string{"MSA", code, field("MSH-10")}, delimiters.Field),
+	}
+	if len(errors) > 0 && errors[0].Text != "" {
+		// MSA-3 is deprecated from v2.5 on, but plenty of receivers still only look there
+		segments[1] += delimiters.Field + delimiters.Encode(errors[0].Text)
+	}
+	for _, e := range errors {
+		segments = append(segments, e.segment(delimiters, version))
+	}
+	return Hl7Message{RawMessage: strings.Join(segments, "\r")}
+}
+
+// segment - the ERR segment for the error
+func (e AckError) segment(delimiters Delimiters, version string) string {
+	code := e.Code
+	if code == "" {
+		code = ErrorCodeApplicationInternal
+	}
+	text := errorCodeText[code]
+	if !versionAtLeast(version, "2.5") {
+		// ERR-1 is an ELD, the location followed by the code as a CE in the subcomponents. there's
+		// nowhere else to put our own text, so it takes the place of the code's description
+		if e.Text != "" {
+			text = e.Text
+		}
+		location := e.location(3)
+		if e.Segment == "" {
+			location = []string{"", "", ""}
+		}
+		codedError := strings.Join([]string{code, delimiters.Encode(text), "HL70357"}, delimiters.Subcomponent)
+		return "ERR" + delimiters.Field + strings.Join(append(location, codedError), delimiters.Component)
+	}
+	severity := e.Severity
+	if severity == "" {
+		severity = SeverityError
+	}
+	location := ""
+	if e.Segment != "" {
+		location = strings.Join(trimTrailingEmpty(e.location(6)), delimiters.Component)
+	}
+	fields := []string{
+		"ERR",
+		"",
+		location,
+		strings.Join([]string{code, delimiters.Encode(text), "HL70357"}, delimiters.Component),
+		severity,
+	}
+	if e.Text != "" {
+		// ERR-8 is the user message
+		fields = append(fields, "", "", "", delimiters.Encode(e.Text))
+	}
+	return strings.Join(fields, delimiters.Field)
+}
+
+// location - the segment, sequence and positions of the error, which ERR-2 has all six of and ERR-1
+// only the first three
+func (e AckError) location(parts int) []string {
+	sequence := e.Sequence
+	if sequence <= 0 {
+		sequence = 1
+	}
+	values := []string{e.Segment, strconv.Itoa(sequence)}
+	for _, position := range []int{e.Field, e.Repetition, e.Component, e.Subcomponent}[:parts-2] {
+		value := ""
+		if position > 0 {
+			value = strconv.Itoa(position)
+		}
+		values = append(values, value)
+	}
+	return values
+}
@@ -0,0 +1,92 @@
+package hl7Utilities
+
+import (
+	"strings"
+	"testing"
+)
+
+const ackInbound = "MSH|^~\\&|LAB|LAB FACILITY|EHR|EHR FACILITY|20220802003337-0500||ORU^R01^ORU_R01|CTRL123|P|2.5.1\r" +
+	"PID|1||M177323145^^^LAB^MR||DOE^JANE"
+
+func TestGenerateAck_Header(t *testing.T) {
+	ack := GenerateAck(Hl7Message{RawMessage: ackInbound}, AckApplicationAccept, nil)
+	expected := []struct{ spec, value string }{
+		{"MSH-3", "EHR"},
+		{"MSH-4", "EHR FACILITY"},
+		{"MSH-5", "LAB"},
+		{"MSH-6", "LAB FACILITY"},
+		{"MSH-9", "ACK^R01^ACK"},
+		{"MSH-11", "P"},
+		{"MSH-12", "2.5.1"},
+		{"MSA-1", "AA"},
+		{"MSA-2", "CTRL123"},
+	}
+	for _, e := range expected {
+		value, err := ack.GetRaw(e.spec)
+		if err != nil || *value != e.value {
+			t.Logf("%s: expected '%s' but got %v, %v", e.spec, e.value, value, err)
+			t.Fail()
+		}
+	}
+	first, _ := ack.GetRaw("MSH-10")
+	second, _ := GenerateAck(Hl7Message{RawMessage: ackInbound}, AckApplicationAccept, nil).GetRaw("MSH-10")
+	if *first == "" || *first == "CTRL123" || *first == *second {
+		t.Logf("every ACK should have its own control ID but got '%s' and '%s'", *first, *second)
+		t.Fail()
+	}
+	if segments := ack.MessageSegments(); len(segments) != 2 {
+		t.Logf("an AA without errors should only have MSH and MSA but got %q", segments)
+		t.Fail()
+	}
+}
+
+func TestGenerateAck_Errors(t *testing.T) {
+	errs := []AckError{
+		{Segment: "PID", Field: 3, Repetition: 1, Component: 1, Code: ErrorCodeRequiredFieldMissing, Text: "no MRN"},
+		{Segment: "OBX", Sequence: 2, Field: 5, Code: ErrorCodeDataType, Severity: SeverityWarning, Text: "bad value | 12"},
+		{Text: "database down"},
+	}
+	cases := []struct {
+		name, message string
+		expected      []string
+	}{
+		{
+			"v2.5.1",
+			ackInbound,
+			[]string{
+				"MSA|AE|CTRL123|no MRN",
+				"ERR||PID^1^3^1^1|101^Required field missing^HL70357|E||||no MRN",
+				"ERR||OBX^2^5|102^Data type error^HL70357|W||||bad value \\F\\ 12",
+				"ERR|||207^Application internal error^HL70357|E||||database down",
+			},
+		},
+		{
+			"v2.3",
+			strings.Replace(ackInbound, "2.5.1", "2.3", 1),
+			[]string{
+				"MSA|AE|CTRL123|no MRN",
+				"ERR|PID^1^3^101&no MRN&HL70357",
+				"ERR|OBX^2^5^102&bad value \\F\\ 12&HL70357",
+				"ERR|^^^207&database down&HL70357",
+			},
+		},
+	}
+	for _, c := range cases {
+		segments := GenerateAck(Hl7Message{RawMessage: c.message}, AckApplicationError, errs).MessageSegments()
+		if strings.Join(segments[1:], "\n") != strings.Join(c.expected, "\n") {
+			t.Logf("%s: expected\n%s\nbut got\n%s", c.name, strings.Join(c.expected, "\n"), strings.Join(segments[1:], "\n"))
+			t.Fail()
+		}
+	}
+}
+
+func TestGenerateAck_BrokenMessage(t *testing.T) {
+	// the encoding characters repeat a delimiter, so the default ones are used instead
+	ack := GenerateAck(Hl7Message{RawMessage: "MSH|^^\\&|LAB||EHR||20220802||ORU^R01|CTRL9|P|2.5.1"}, AckApplicationReject,
+		[]AckError{{Text: "unreadable"}})
+	segments := ack.MessageSegments()
+	if !strings.HasPrefix(segments[0], "MSH|^~\\&|EHR||LAB|") || segments[1] != "MSA|AR|CTRL9|unreadable" {
+		t.Logf("expected an AR with the default delimiters but got %q", segments)
+		t.Fail()
+	}
+}
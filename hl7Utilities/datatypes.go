@@ -0,0 +1,495 @@
+package hl7Utilities
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// the composite data types below are built from a single repetition of a field, with every value
+// decoded. each one has a NewXXX function taking the parsed repetition, and a ParseXXX function
+// taking the repetition as it appears in the message. component positions follow v2.5.1, which
+// agrees with v2.3.1 and v2.7 for everything here apart from the few components noted on each type,
+// and those are picked using the version from MSH-12. an empty version means the newest
+
+// HD - hierarchic designator, naming an application, facility or assigning authority
+type HD struct {
+	NamespaceId     string
+	UniversalId     string
+	UniversalIdType string
+}
+
+// EI - entity identifier, like a placer or filler order number
+type EI struct {
+	EntityIdentifier string
+	NamespaceId      string
+	UniversalId      string
+	UniversalIdType  string
+}
+
+// CWE - coded with exceptions. CE, which it replaced, has the same first six components so CE
+// values read the same way
+type CWE struct {
+	Identifier                     string
+	Text                           string
+	NameOfCodingSystem             string
+	AlternateIdentifier            string
+	AlternateText                  string
+	NameOfAlternateCodingSystem    string
+	CodingSystemVersionId          string
+	AlternateCodingSystemVersionId string
+	// OriginalText - CWE-9, which only exists from v2.5 on
+	OriginalText string
+}
+
+// CE - coded element, the pre v2.6 type for coded values
+type CE = CWE
+
+// CX - extended composite ID with check digit, like a medical record number
+type CX struct {
+	IdNumber           string
+	CheckDigit         string
+	CheckDigitScheme   string
+	AssigningAuthority HD
+	IdentifierTypeCode string
+	AssigningFacility  HD
+}
+
+// XPN - extended person name
+type XPN struct {
+	// FamilyName - the surname, which is the first subcomponent of XPN-1 from v2.3 on
+	FamilyName                 string
+	GivenName                  string
+	SecondAndFurtherGivenNames string
+	Suffix                     string
+	Prefix                     string
+	Degree                     string
+	NameTypeCode               string
+	// ProfessionalSuffix - XPN-14, which only exists from v2.5 on
+	ProfessionalSuffix string
+}
+
+// XCN - extended composite ID number and name for persons, like an ordering provider
+type XCN struct {
+	IdNumber                   string
+	FamilyName                 string
+	GivenName                  string
+	SecondAndFurtherGivenNames string
+	Suffix                     string
+	Prefix                     string
+	Degree                     string
+	SourceTable                string
+	AssigningAuthority         HD
+	NameTypeCode               string
+	IdentifierTypeCode         string
+	AssigningFacility          HD
+	// ProfessionalSuffix - XCN-21, which only exists from v2.5 on
+	ProfessionalSuffix string
+}
+
+// XAD - extended address
+type XAD struct {
+	// StreetAddress - the street line, which is the first subcomponent of XAD-1 from v2.5 on
+	StreetAddress              string
+	OtherDesignation           string
+	City                       string
+	StateOrProvince            string
+	ZipOrPostalCode            string
+	Country                    string
+	AddressType                string
+	OtherGeographicDesignation string
+	CountyParishCode           string
+	CensusTract                string
+}
+
+// XTN - extended telecommunication number
+type XTN struct {
+	// TelephoneNumber - XTN-1, the number written out like (555)555-1234X12. it's deprecated from
+	// v2.5 on, where the number is split across the components below, and withdrawn in v2.7
+	TelephoneNumber                string
+	TelecommunicationUseCode       string
+	TelecommunicationEquipmentType string
+	EmailAddress                   string
+	CountryCode                    string
+	AreaCityCode                   string
+	LocalNumber                    string
+	Extension                      string
+	AnyText                        string
+	// UnformattedTelephoneNumber - XTN-12, which only exists from v2.5 on
+	UnformattedTelephoneNumber string
+}
+
+// XON - extended composite name and identification number for organizations
+type XON struct {
+	OrganizationName         string
+	OrganizationNameTypeCode string
+	AssigningAuthority       HD
+	IdentifierTypeCode       string
+	AssigningFacility        HD
+	// OrganizationIdentifier - the organization's ID, which is XON-3 before v2.5 and XON-10 after.
+	// we fall back to XON-3 for later versions when XON-10 is empty, since plenty of senders never
+	// made the move
+	OrganizationIdentifier string
+}
+
+// TS - time stamp. v2.7 withdrew TS and uses the DTM primitive on its own, which reads the same way
+// since it's just TS-1
+type TS struct {
+	Time              string
+	DegreeOfPrecision string
+}
+
+// components - reads decoded values out of a repetition, returning empty strings for anything that
+// isn't there
+type components struct {
+	repetition *Repetition
+	delimiters Delimiters
+}
+
+// value - the decoded first subcomponent of a component
+func (c components) value(position int) string {
+	return c.delimiters.Decode(c.repetition.Component(position).Value())
+}
+
+// subcomponent - a decoded subcomponent of a component
+func (c components) subcomponent(position, subposition int) string {
+	return c.delimiters.Decode(c.repetition.Component(position).Subcomponent(subposition))
+}
+
+// hd - a component holding a hierarchic designator in its subcomponents
+func (c components) hd(position int) HD {
+	return HD{
+		NamespaceId:     c.subcomponent(position, 1),
+		UniversalId:     c.subcomponent(position, 2),
+		UniversalIdType: c.subcomponent(position, 3),
+	}
+}
+
+// versionAtLeast - true when the message version is the minimum or later. an empty version means the
+// newest
+func versionAtLeast(version, minimum string) bool {
+	return version == "" || compareVersions(version, minimum) >= 0
+}
+
+// parseRepetition - splits a single repetition as it appears in the message
+func parseRepetition(rawValue string, delimiters Delimiters) *Repetition {
+	return parseField(rawValue, delimiters).Repetition(0)
+}
+
+// NewHD - reads a hierarchic designator from a field like MSH-3
+func NewHD(r *Repetition, delimiters Delimiters, version string) HD {
+	c := components{r, delimiters}
+	return HD{NamespaceId: c.value(1), UniversalId: c.value(2), UniversalIdType: c.value(3)}
+}
+
+// ParseHD - reads a hierarchic designator from its raw value
+func ParseHD(rawValue string, delimiters Delimiters, version string) HD {
+	return NewHD(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// NewEI - reads an entity identifier
+func NewEI(r *Repetition, delimiters Delimiters, version string) EI {
+	c := components{r, delimiters}
+	return EI{
+		EntityIdentifier: c.value(1),
+		NamespaceId:      c.value(2),
+		UniversalId:      c.value(3),
+		UniversalIdType:  c.value(4),
+	}
+}
+
+// ParseEI - reads an entity identifier from its raw value
+func ParseEI(rawValue string, delimiters Delimiters, version string) EI {
+	return NewEI(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// NewCWE - reads a coded value, either CWE or CE
+func NewCWE(r *Repetition, delimiters Delimiters, version string) CWE {
+	c := components{r, delimiters}
+	cwe := CWE{
+		Identifier:                     c.value(1),
+		Text:                           c.value(2),
+		NameOfCodingSystem:             c.value(3),
+		AlternateIdentifier:            c.value(4),
+		AlternateText:                  c.value(5),
+		NameOfAlternateCodingSystem:    c.value(6),
+		CodingSystemVersionId:          c.value(7),
+		AlternateCodingSystemVersionId: c.value(8),
+	}
+	if versionAtLeast(version, "2.5") {
+		cwe.OriginalText = c.value(9)
+	}
+	return cwe
+}
+
+// ParseCWE - reads a coded value from its raw value
+func ParseCWE(rawValue string, delimiters Delimiters, version string) CWE {
+	return NewCWE(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// DisplayText - the best text we have for the code, falling back to the code itself when the
+// sender didn't send any
+func (c CWE) DisplayText() string {
+	for _, text := range []string{c.Text, c.OriginalText, c.AlternateText, c.Identifier, c.AlternateIdentifier} {
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// NewCX - reads an extended composite ID
+func NewCX(r *Repetition, delimiters Delimiters, version string) CX {
+	c := components{r, delimiters}
+	return CX{
+		IdNumber:           c.value(1),
+		CheckDigit:         c.value(2),
+		CheckDigitScheme:   c.value(3),
+		AssigningAuthority: c.hd(4),
+		IdentifierTypeCode: c.value(5),
+		AssigningFacility:  c.hd(6),
+	}
+}
+
+// ParseCX - reads an extended composite ID from its raw value
+func ParseCX(rawValue string, delimiters Delimiters, version string) CX {
+	return NewCX(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// NewXPN - reads an extended person name
+func NewXPN(r *Repetition, delimiters Delimiters, version string) XPN {
+	c := components{r, delimiters}
+	xpn := XPN{
+		FamilyName:                 c.value(1),
+		GivenName:                  c.value(2),
+		SecondAndFurtherGivenNames: c.value(3),
+		Suffix:                     c.value(4),
+		Prefix:                     c.value(5),
+		Degree:                     c.value(6),
+		NameTypeCode:               c.value(7),
+	}
+	if versionAtLeast(version, "2.5") {
+		xpn.ProfessionalSuffix = c.value(14)
+	}
+	return xpn
+}
+
+// ParseXPN - reads an extended person name from its raw value
+func ParseXPN(rawValue string, delimiters Delimiters, version string) XPN {
+	return NewXPN(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// FullName - the name the way it would be written, like "DR JANE Q SMITH JR, MD"
+func (n XPN) FullName() string {
+	return fullName(n.Prefix, n.GivenName, n.SecondAndFurtherGivenNames, n.FamilyName, n.Suffix, n.Degree, n.ProfessionalSuffix)
+}
+
+// NewXCN - reads a person's ID and name
+func NewXCN(r *Repetition, delimiters Delimiters, version string) XCN {
+	c := components{r, delimiters}
+	xcn := XCN{
+		IdNumber:                   c.value(1),
+		FamilyName:                 c.value(2),
+		GivenName:                  c.value(3),
+		SecondAndFurtherGivenNames: c.value(4),
+		Suffix:                     c.value(5),
+		Prefix:                     c.value(6),
+		Degree:                     c.value(7),
+		SourceTable:                c.value(8),
+		AssigningAuthority:         c.hd(9),
+		NameTypeCode:               c.value(10),
+		IdentifierTypeCode:         c.value(13),
+		AssigningFacility:          c.hd(14),
+	}
+	if versionAtLeast(version, "2.5") {
+		xcn.ProfessionalSuffix = c.value(21)
+	}
+	return xcn
+}
+
+// ParseXCN - reads a person's ID and name from its raw value
+func ParseXCN(rawValue string, delimiters Delimiters, version string) XCN {
+	return NewXCN(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// FullName - the name the way it would be written, like "DR JANE Q SMITH JR, MD"
+func (n XCN) FullName() string {
+	return fullName(n.Prefix, n.GivenName, n.SecondAndFurtherGivenNames, n.FamilyName, n.Suffix, n.Degree, n.ProfessionalSuffix)
+}
+
+// fullName - puts the parts of a name together, skipping any that are empty. degrees and
+// professional suffixes go after a comma
+func fullName(prefix, given, second, family, suffix, degree, professionalSuffix string) string {
+	name := joinNonEmpty(" ", prefix, given, second, family, suffix)
+	if credentials := joinNonEmpty(" ", degree, professionalSuffix); credentials != "" {
+		name = joinNonEmpty(", ", name, credentials)
+	}
+	return name
+}
+
+// NewXAD - reads an extended address
+func NewXAD(r *Repetition, delimiters Delimiters, version string) XAD {
+	c := components{r, delimiters}
+	return XAD{
+		StreetAddress:              c.value(1),
+		OtherDesignation:           c.value(2),
+		City:                       c.value(3),
+		StateOrProvince:            c.value(4),
+		ZipOrPostalCode:            c.value(5),
+		Country:                    c.value(6),
+		AddressType:                c.value(7),
+		OtherGeographicDesignation: c.value(8),
+		CountyParishCode:           c.value(9),
+		CensusTract:                c.value(10),
+	}
+}
+
+// ParseXAD - reads an extended address from its raw value
+func ParseXAD(rawValue string, delimiters Delimiters, version string) XAD {
+	return NewXAD(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// OneLine - the address on a single line, like "1 Eastman Dr, Level 1, Beverly Hills, CA 90210, USA"
+func (a XAD) OneLine() string {
+	return joinNonEmpty(
+		", ",
+		a.StreetAddress,
+		a.OtherDesignation,
+		a.City,
+		joinNonEmpty(" ", a.StateOrProvince, a.ZipOrPostalCode),
+		a.Country,
+	)
+}
+
+// NewXTN - reads a telecommunication number
+func NewXTN(r *Repetition, delimiters Delimiters, version string) XTN {
+	c := components{r, delimiters}
+	xtn := XTN{
+		TelephoneNumber:                c.value(1),
+		TelecommunicationUseCode:       c.value(2),
+		TelecommunicationEquipmentType: c.value(3),
+		EmailAddress:                   c.value(4),
+		CountryCode:                    c.value(5),
+		AreaCityCode:                   c.value(6),
+		LocalNumber:                    c.value(7),
+		Extension:                      c.value(8),
+		AnyText:                        c.value(9),
+	}
+	if versionAtLeast(version, "2.5") {
+		xtn.UnformattedTelephoneNumber = c.value(12)
+	}
+	return xtn
+}
+
+// ParseXTN - reads a telecommunication number from its raw value
+func ParseXTN(rawValue string, delimiters Delimiters, version string) XTN {
+	return NewXTN(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// E164 - the number in E.164 form, like +15555551234, without any extension. the number comes from
+// the area code and local number when they're filled in, then the unformatted number, then the
+// XTN-1 text older senders use. the default country code is used when the number doesn't come with
+// one
+func (t XTN) E164(defaultCountryCode string) (string, error) {
+	countryCode := digitsOnly(t.CountryCode)
+	number := digitsOnly(t.AreaCityCode + t.LocalNumber)
+	for _, text := range []string{t.UnformattedTelephoneNumber, t.TelephoneNumber} {
+		if number != "" {
+			break
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), "+") {
+			// already international, country code and all
+			countryCode, number = "", digitsOnly(legacyTelephoneNumber(text))
+			if number != "" {
+				return "+" + number, nil
+			}
+			continue
+		}
+		main := legacyTelephoneNumber(text)
+		if i := strings.Index(main, "("); i > 0 && countryCode == "" {
+			// [NNN] [(999)]999-9999, where the leading digits are the country code
+			countryCode, main = digitsOnly(main[:i]), main[i:]
+		}
+		number = digitsOnly(main)
+	}
+	if number == "" {
+		return "", fmt.Errorf("%w: no telephone number", ErrInvalidValue)
+	}
+	if countryCode == "" {
+		countryCode = digitsOnly(defaultCountryCode)
+		// a number that already starts with the country code, like 15555551234, doesn't get it twice
+		if len(number) == len(countryCode)+10 && strings.HasPrefix(number, countryCode) {
+			number = number[len(countryCode):]
+		}
+	}
+	if countryCode == "" {
+		return "", fmt.Errorf("%w: no country code for %s", ErrInvalidValue, number)
+	}
+	if len(countryCode)+len(number) > 15 {
+		return "", fmt.Errorf("%w: %s%s is too long to be an E.164 number", ErrInvalidValue, countryCode, number)
+	}
+	return "+" + countryCode + number, nil
+}
+
+// legacyTelephoneNumber - the number part of the XTN-1 text, dropping the X extension, B beeper
+// and C comment that can follow it
+func legacyTelephoneNumber(text string) string {
+	if i := strings.IndexAny(text, "XBCxbc"); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
+
+// digitsOnly - strips everything but the digits, so (555) 555-1234 becomes 5555551234
+func digitsOnly(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+// NewXON - reads an organization's name and ID
+func NewXON(r *Repetition, delimiters Delimiters, version string) XON {
+	c := components{r, delimiters}
+	xon := XON{
+		OrganizationName:         c.value(1),
+		OrganizationNameTypeCode: c.value(2),
+		AssigningAuthority:       c.hd(6),
+		IdentifierTypeCode:       c.value(7),
+		AssigningFacility:        c.hd(8),
+		OrganizationIdentifier:   c.value(3),
+	}
+	if identifier := c.value(10); versionAtLeast(version, "2.5") && identifier != "" {
+		xon.OrganizationIdentifier = identifier
+	}
+	return xon
+}
+
+// ParseXON - reads an organization's name and ID from its raw value
+func ParseXON(rawValue string, delimiters Delimiters, version string) XON {
+	return NewXON(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// NewTS - reads a time stamp
+func NewTS(r *Repetition, delimiters Delimiters, version string) TS {
+	c := components{r, delimiters}
+	return TS{Time: c.value(1), DegreeOfPrecision: c.value(2)}
+}
+
+// ParseTS - reads a time stamp from its raw value
+func ParseTS(rawValue string, delimiters Delimiters, version string) TS {
+	return NewTS(parseRepetition(rawValue, delimiters), delimiters, version)
+}
+
+// joinNonEmpty - joins the values that aren't blank
+func joinNonEmpty(separator string, values ...string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, separator)
+}
@@ -0,0 +1,211 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseCompositeTypes(t *testing.T) {
+	d := DefaultDelimiters
+	cases := []struct {
+		name             string
+		actual, expected interface{}
+	}{
+		{
+			"HD",
+			ParseHD("Ketchup Clinic RD^2.16.840.1.113883.3.2.12.1^ISO", d, "2.5.1"),
+			HD{"Ketchup Clinic RD", "2.16.840.1.113883.3.2.12.1", "ISO"},
+		},
+		{
+			"EI",
+			ParseEI("H823018568^Filler Order Number^2.16.840.1.113883.3.2.12.1.1^ISO", d, "2.5.1"),
+			EI{"H823018568", "Filler Order Number", "2.16.840.1.113883.3.2.12.1.1", "ISO"},
+		},
+		{
+			"CWE",
+			ParseCWE("260415000^Undetected^SCT^^^^^^Not detected", d, "2.5.1"),
+			CWE{Identifier: "260415000", Text: "Undetected", NameOfCodingSystem: "SCT", OriginalText: "Not detected"},
+		},
+		{
+			// CWE-9 doesn't exist before v2.5
+			"CE",
+			ParseCWE("260415000^Undetected^SCT^^^^^^Not detected", d, "2.3.1"),
+			CE{Identifier: "260415000", Text: "Undetected", NameOfCodingSystem: "SCT"},
+		},
+		{
+			"CX",
+			ParseCX("M177323145^^^Ketchup Clinic DLMP&2.16.840.1.113883.3.2.12.1.1&ISO^PI", d, "2.5.1"),
+			CX{
+				IdNumber:           "M177323145",
+				AssigningAuthority: HD{"Ketchup Clinic DLMP", "2.16.840.1.113883.3.2.12.1.1", "ISO"},
+				IdentifierTypeCode: "PI",
+			},
+		},
+		{
+			"XPN",
+			ParseXPN(`SMITH^JANE^Q^JR^DR^^L^^^^^^^MD`, d, "2.5.1"),
+			XPN{
+				FamilyName:                 "SMITH",
+				GivenName:                  "JANE",
+				SecondAndFurtherGivenNames: "Q",
+				Suffix:                     "JR",
+				Prefix:                     "DR",
+				NameTypeCode:               "L",
+				ProfessionalSuffix:         "MD",
+			},
+		},
+		{
+			"XCN",
+			ParseXCN("NPI^HOWSER^DOUGLAS^^^^^^Eastman Medical Center&2.16.840.1.113883.3.2.12.1.99&ISO^L", d, "2.5.1"),
+			XCN{
+				IdNumber:           "NPI",
+				FamilyName:         "HOWSER",
+				GivenName:          "DOUGLAS",
+				AssigningAuthority: HD{"Eastman Medical Center", "2.16.840.1.113883.3.2.12.1.99", "ISO"},
+				NameTypeCode:       "L",
+			},
+		},
+		{
+			"XAD",
+			ParseXAD(`1 Eastman Dr^Level 1^Beverly Hills^CA^90210^USA^L^^06037`, d, "2.5.1"),
+			XAD{
+				StreetAddress:    "1 Eastman Dr",
+				OtherDesignation: "Level 1",
+				City:             "Beverly Hills",
+				StateOrProvince:  "CA",
+				ZipOrPostalCode:  "90210",
+				Country:          "USA",
+				AddressType:      "L",
+				CountyParishCode: "06037",
+			},
+		},
+		{
+			// the street line is the first subcomponent of the SAD
+			"XAD street",
+			ParseXAD(`1 Eastman Dr&Eastman Dr&1^^Beverly Hills`, d, "2.5.1"),
+			XAD{StreetAddress: "1 Eastman Dr", City: "Beverly Hills"},
+		},
+		{
+			"XTN",
+			ParseXTN("^WPN^PH^^1^555^5551234^12", d, "2.5.1"),
+			XTN{
+				TelecommunicationUseCode:       "WPN",
+				TelecommunicationEquipmentType: "PH",
+				CountryCode:                    "1",
+				AreaCityCode:                   "555",
+				LocalNumber:                    "5551234",
+				Extension:                      "12",
+			},
+		},
+		{
+			"XON v2.5.1",
+			ParseXON("KCLab-RO Main Campus^A^^^^CLIA&2.16.840.1.113883.4.7&ISO^XX^^^24D0404292", d, "2.5.1"),
+			XON{
+				OrganizationName:         "KCLab-RO Main Campus",
+				OrganizationNameTypeCode: "A",
+				AssigningAuthority:       HD{"CLIA", "2.16.840.1.113883.4.7", "ISO"},
+				IdentifierTypeCode:       "XX",
+				OrganizationIdentifier:   "24D0404292",
+			},
+		},
+		{
+			// XON-10 didn't exist yet, the ID was in XON-3
+			"XON v2.3.1",
+			ParseXON("KCLab^L^24D0404292^^^^^^^IGNORED", d, "2.3.1"),
+			XON{OrganizationName: "KCLab", OrganizationNameTypeCode: "L", OrganizationIdentifier: "24D0404292"},
+		},
+		{
+			"TS",
+			ParseTS("20220723105000-0500^S", d, "2.5.1"),
+			TS{Time: "20220723105000-0500", DegreeOfPrecision: "S"},
+		},
+		{
+			// values are decoded
+			"decoded",
+			ParseXAD(`Smith \T\ Sons^Suite 1\S\2`, d, "2.5.1"),
+			XAD{StreetAddress: "Smith & Sons", OtherDesignation: "Suite 1^2"},
+		},
+	}
+	for _, c := range cases {
+		if !reflect.DeepEqual(c.actual, c.expected) {
+			t.Logf("%s should be %+v but got %+v", c.name, c.expected, c.actual)
+			t.Fail()
+		}
+	}
+}
+
+func TestNewCompositeTypes_FromSegments(t *testing.T) {
+	parsed, err := ParseMessage(simpleHl7Message)
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	orc := SegmentOf[ORC](parsed, 0)
+	provider := NewXCN(orc.OrderingProvider().Repetition(0), parsed.Delimiters, "2.5.1")
+	if provider.FullName() != "DOUGLAS HOWSER, MD" {
+		t.Logf("expected 'DOUGLAS HOWSER, MD' but got '%s'", provider.FullName())
+		t.Fail()
+	}
+	address := NewXAD(orc.OrderingFacilityAddress().Repetition(0), parsed.Delimiters, "2.5.1")
+	if address.OneLine() != "1 Eastman Dr, Beverly Hills, CA 90210" {
+		t.Logf("expected '1 Eastman Dr, Beverly Hills, CA 90210' but got '%s'", address.OneLine())
+		t.Fail()
+	}
+	// a missing field reads as empty
+	if empty := NewXPN(SegmentOf[PV1](parsed, 0).AttendingDoctor().Repetition(0), parsed.Delimiters, ""); empty != (XPN{}) {
+		t.Logf("expected an empty name but got %+v", empty)
+		t.Fail()
+	}
+}
+
+func TestFullName(t *testing.T) {
+	cases := []struct{ name, expected string }{
+		{"SMITH^JANE^Q^JR^DR^MD", "DR JANE Q SMITH JR, MD"},
+		{"SMITH^JANE^^^^^^^^^^^^MD", "JANE SMITH, MD"},
+		{"SMITH", "SMITH"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if actual := ParseXPN(c.name, DefaultDelimiters, "2.5.1").FullName(); actual != c.expected {
+			t.Logf("%s should be '%s' but got '%s'", c.name, c.expected, actual)
+			t.Fail()
+		}
+	}
+}
+
+func TestXTN_E164(t *testing.T) {
+	cases := []struct {
+		xtn, version, expected string
+	}{
+		{"^WPN^PH^^1^555^5551234^12", "2.5.1", "+15555551234"},
+		{"^WPN^PH^^44^20^7946 0958", "2.5.1", "+442079460958"},
+		// no country code, so we use the default
+		{"^PRN^PH^^^555^555-1234", "2.5.1", "+15555551234"},
+		{"^PRN^PH^^^^^^^^^5555551234", "2.5.1", "+15555551234"},
+		{"^PRN^PH^^^^^^^^^+44 20 7946 0958", "2.5.1", "+442079460958"},
+		// the older free text form
+		{"(555)555-1234X12", "2.3.1", "+15555551234"},
+		{"44(20)7946-0958", "2.3.1", "+442079460958"},
+		{"1-555-555-1234", "2.3.1", "+15555551234"},
+	}
+	for _, c := range cases {
+		actual, err := ParseXTN(c.xtn, DefaultDelimiters, c.version).E164("1")
+		if err != nil {
+			t.Logf("%s shouldn't be an error: %v", c.xtn, err)
+			t.Fail()
+			continue
+		}
+		if actual != c.expected {
+			t.Logf("%s should be '%s' but got '%s'", c.xtn, c.expected, actual)
+			t.Fail()
+		}
+	}
+	if _, err := ParseXTN("^NET^Internet^jane@example.com", DefaultDelimiters, "2.5.1").E164("1"); !errors.Is(err, ErrInvalidValue) {
+		t.Log("an email address isn't a telephone number", err)
+		t.Fail()
+	}
+	if _, err := ParseXTN("^PRN^PH^^^555^5551234", DefaultDelimiters, "2.5.1").E164(""); !errors.Is(err, ErrInvalidValue) {
+		t.Log("a number with no country code should be an error", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,84 @@
+package hl7Utilities
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Delimiters - the separator characters a message declares for itself in MSH-1 and MSH-2
+type Delimiters struct {
+	Field        string
+	Component    string
+	Repetition   string
+	Escape       string
+	Subcomponent string
+	// Truncation - the fifth encoding character introduced in v2.7, usually `#`. it is empty for
+	// messages that only declare four encoding characters
+	Truncation string
+}
+
+// DefaultDelimiters - the delimiters almost every sender uses, `|^~\&`
+var DefaultDelimiters = Delimiters{
+	Field:        "|",
+	Component:    "^",
+	Repetition:   "~",
+	Escape:       "\\",
+	Subcomponent: "&",
+}
+
+// NewDelimiters - builds the delimiters from the field separator (MSH-1) and the encoding
+// characters (MSH-2). the encoding characters are positional: component, repetition, escape,
+// subcomponent and, from v2.7 on, truncation
+func NewDelimiters(fieldSeparator, encodingCharacters string) (Delimiters, error) {
+	if len(fieldSeparator) != 1 {
+		return Delimiters{}, fmt.Errorf("%w: invalid field separator '%s'", ErrInvalidMessage, fieldSeparator)
+	}
+	if len(encodingCharacters) != 4 && len(encodingCharacters) != 5 {
+		return Delimiters{}, fmt.Errorf("%w: invalid encoding characters '%s'", ErrInvalidMessage, encodingCharacters)
+	}
+	delimiters := Delimiters{
+		Field:        fieldSeparator,
+		Component:    encodingCharacters[0:1],
+		Repetition:   encodingCharacters[1:2],
+		Escape:       encodingCharacters[2:3],
+		Subcomponent: encodingCharacters[3:4],
+	}
+	if len(encodingCharacters) == 5 {
+		delimiters.Truncation = encodingCharacters[4:5]
+	}
+	// every delimiter has to be distinct or we can't tell the levels apart
+	seen := make(map[string]bool)
+	for _, c := range strings.Split(fieldSeparator+encodingCharacters, "") {
+		if seen[c] {
+			return Delimiters{}, fmt.Errorf(
+				"%w: delimiter '%s' is used more than once in '%s%s'",
+				ErrInvalidMessage,
+				c,
+				fieldSeparator,
+				encodingCharacters,
+			)
+		}
+		seen[c] = true
+	}
+	return delimiters, nil
+}
+
+// EncodingCharacters - returns the delimiters in the order they are written into MSH-2
+func (d Delimiters) EncodingCharacters() string {
+	return d.Component + d.Repetition + d.Escape + d.Subcomponent + d.Truncation
+}
+
+// separatorForDepth - the separator used to split a field at a given depth in a terser path, where
+// depth 0 is the field itself, 1 is a component and 2 is a subcomponent
+func (d Delimiters) separatorForDepth(depth int) (string, error) {
+	switch depth {
+	case 0:
+		return d.Repetition, nil
+	case 1:
+		return d.Component, nil
+	case 2:
+		return d.Subcomponent, nil
+	default:
+		return "", fmt.Errorf("%w: HL7 fields cannot be nested %d levels deep", ErrInvalidSpecification, depth)
+	}
+}
@@ -0,0 +1,48 @@
+package hl7Utilities
+
+import "testing"
+
+func TestNewDelimiters(t *testing.T) {
+	tests := []struct {
+		name               string
+		fieldSeparator     string
+		encodingCharacters string
+		want               Delimiters
+		wantErr            bool
+	}{
+		{"standard delimiters", "|", "^~\\&", DefaultDelimiters, false},
+		{
+			"v2.7 truncation character",
+			"|",
+			"^~\\&#",
+			Delimiters{Field: "|", Component: "^", Repetition: "~", Escape: "\\", Subcomponent: "&", Truncation: "#"},
+			false,
+		},
+		{
+			"custom delimiters",
+			"#",
+			"*!\\$",
+			Delimiters{Field: "#", Component: "*", Repetition: "!", Escape: "\\", Subcomponent: "$"},
+			false,
+		},
+		{"too few encoding characters", "|", "^~", Delimiters{}, true},
+		{"too many encoding characters", "|", "^~\\&#@", Delimiters{}, true},
+		{"missing field separator", "", "^~\\&", Delimiters{}, true},
+		{"duplicated delimiter", "|", "^~\\^", Delimiters{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDelimiters(tt.fieldSeparator, tt.encodingCharacters)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDelimiters() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NewDelimiters() got = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr && got.EncodingCharacters() != tt.encodingCharacters {
+				t.Errorf("EncodingCharacters() got = %s, want %s", got.EncodingCharacters(), tt.encodingCharacters)
+			}
+		})
+	}
+}
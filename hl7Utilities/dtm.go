@@ -0,0 +1,212 @@
+package hl7Utilities
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DTMPrecision - how much of a date/time the sender gave us, from just the year down to fractions
+// of a second
+type DTMPrecision int
+
+const (
+	PrecisionYear DTMPrecision = iota + 1
+	PrecisionMonth
+	PrecisionDay
+	PrecisionHour
+	PrecisionMinute
+	PrecisionSecond
+	PrecisionFraction
+)
+
+// String - the name of the precision, which reads better in errors and logs than the number
+func (p DTMPrecision) String() string {
+	switch p {
+	case PrecisionYear:
+		return "year"
+	case PrecisionMonth:
+		return "month"
+	case PrecisionDay:
+		return "day"
+	case PrecisionHour:
+		return "hour"
+	case PrecisionMinute:
+		return "minute"
+	case PrecisionSecond:
+		return "second"
+	case PrecisionFraction:
+		return "fraction"
+	}
+	return "unknown"
+}
+
+// DTM - an HL7 date/time, YYYY[MM[DD[HH[MM[SS[.S[S[S[S]]]]]]]]][+/-ZZZZ], along with how precise
+// the sender was. the parts the sender left off are the start of their period, so 2022 is midnight
+// on January 1st
+type DTM struct {
+	Time      time.Time
+	Precision DTMPrecision
+	// FractionDigits - how many digits of fractional seconds were sent, from 1 to 4
+	FractionDigits int
+	// HasOffset - whether the value carried its own UTC offset. when it didn't, Time is in the
+	// default location it was parsed with
+	HasOffset bool
+}
+
+// dtmPattern - the digits, the optional fraction, and the optional offset of a DTM
+var dtmPattern = regexp.MustCompile(`^([0-9]{4,14})(\.([0-9]{1,4}))?(([+-])([0-9]{2})([0-9]{2}))?$`)
+
+// dtmLayouts - the Go layout for each precision, without any fraction or offset
+var dtmLayouts = map[DTMPrecision]string{
+	PrecisionYear:     "2006",
+	PrecisionMonth:    "200601",
+	PrecisionDay:      "20060102",
+	PrecisionHour:     "2006010215",
+	PrecisionMinute:   "200601021504",
+	PrecisionSecond:   "20060102150405",
+	PrecisionFraction: "20060102150405",
+}
+
+// ParseDTM - parses a DTM, or the first component of a TS. values without a UTC offset are taken to
+// be in the default location, which is UTC when it's nil. HL7 says those are in the sender's local
+// time, so pass the sender's location when you know it, see [SenderTimeZones]
+func ParseDTM(value string, defaultLocation *time.Location) (DTM, error) {
+	value = strings.TrimSpace(value)
+	matches := dtmPattern.FindStringSubmatch(value)
+	if matches == nil {
+		return DTM{}, fmt.Errorf("%w: '%s' is not an HL7 date/time", ErrInvalidValue, value)
+	}
+	digits := matches[1]
+	var precision DTMPrecision
+	switch len(digits) {
+	case 4:
+		precision = PrecisionYear
+	case 6:
+		precision = PrecisionMonth
+	case 8:
+		precision = PrecisionDay
+	case 10:
+		precision = PrecisionHour
+	case 12:
+		precision = PrecisionMinute
+	case 14:
+		precision = PrecisionSecond
+	default:
+		return DTM{}, fmt.Errorf("%w: '%s' has an odd number of digits for a date/time", ErrInvalidValue, value)
+	}
+	dtm := DTM{Precision: precision}
+	if matches[3] != "" {
+		if precision != PrecisionSecond {
+			return DTM{}, fmt.Errorf("%w: '%s' has fractional seconds without seconds", ErrInvalidValue, value)
+		}
+		dtm.Precision = PrecisionFraction
+		dtm.FractionDigits = len(matches[3])
+	}
+	location := defaultLocation
+	if location == nil {
+		location = time.UTC
+	}
+	if matches[4] != "" {
+		hours, _ := strconv.Atoi(matches[6])
+		minutes, _ := strconv.Atoi(matches[7])
+		if hours > 14 || minutes > 59 {
+			return DTM{}, fmt.Errorf("%w: '%s' has an invalid UTC offset", ErrInvalidValue, value)
+		}
+		offset := hours*60*60 + minutes*60
+		if matches[5] == "-" {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+		dtm.HasOffset = true
+	}
+	// pad out the missing parts to the start of the period, so 2022 becomes 20220101000000
+	full := digits + "0101000000"[len(digits)-4:]
+	parsed, err := time.ParseInLocation("20060102150405", full, location)
+	if err != nil {
+		return DTM{}, fmt.Errorf("%w: '%s' is not a valid date/time", ErrInvalidValue, value)
+	}
+	if dtm.FractionDigits > 0 {
+		fraction, _ := strconv.Atoi(matches[3] + strings.Repeat("0", 9-dtm.FractionDigits))
+		parsed = parsed.Add(time.Duration(fraction))
+	}
+	dtm.Time = parsed
+	return dtm, nil
+}
+
+// IsZero - true for a DTM that was never set
+func (d DTM) IsZero() bool {
+	return d.Precision == 0
+}
+
+// HL7 - formats the time back into a DTM with the precision it was sent with, including the UTC
+// offset when it had one
+func (d DTM) HL7() string {
+	if d.IsZero() {
+		return ""
+	}
+	layout := dtmLayouts[d.Precision]
+	if d.Precision == PrecisionFraction {
+		layout += "." + strings.Repeat("0", d.FractionDigits)
+	}
+	if d.HasOffset {
+		layout += "-0700"
+	}
+	return d.Time.Format(layout)
+}
+
+// RFC3339 - formats the time for RFC 3339, or ISO 8601 for the precisions RFC 3339 can't express.
+// years, months and days come out as 2022, 2022-07 and 2022-07-23, the way FHIR writes partial
+// dates, and anything more precise is a full timestamp with the UTC offset
+func (d DTM) RFC3339() string {
+	switch d.Precision {
+	case 0:
+		return ""
+	case PrecisionYear:
+		return d.Time.Format("2006")
+	case PrecisionMonth:
+		return d.Time.Format("2006-01")
+	case PrecisionDay:
+		return d.Time.Format("2006-01-02")
+	case PrecisionFraction:
+		return d.Time.Format("2006-01-02T15:04:05." + strings.Repeat("0", d.FractionDigits) + "Z07:00")
+	}
+	return d.Time.Format(time.RFC3339)
+}
+
+// String - the HL7 form of the time
+func (d DTM) String() string {
+	return d.HL7()
+}
+
+// Parse - parses the time stamp's time, see [ParseDTM]
+func (t TS) Parse(defaultLocation *time.Location) (DTM, error) {
+	return ParseDTM(t.Time, defaultLocation)
+}
+
+// SenderTimeZones - the time zones to assume for times sent without a UTC offset. plenty of senders
+// leave the offset off and mean their own local time, so these are kept per sender, keyed however
+// the caller identifies senders, like MSH-3 or MSH-4
+type SenderTimeZones struct {
+	// Default - the location for senders that aren't listed. nil means UTC
+	Default *time.Location
+	Senders map[string]*time.Location
+}
+
+// Location - the location to assume for the sender
+func (z SenderTimeZones) Location(sender string) *time.Location {
+	if location, ok := z.Senders[sender]; ok && location != nil {
+		return location
+	}
+	if z.Default != nil {
+		return z.Default
+	}
+	return time.UTC
+}
+
+// ParseDTM - parses a DTM using the sender's location for times sent without an offset
+func (z SenderTimeZones) ParseDTM(sender, value string) (DTM, error) {
+	return ParseDTM(value, z.Location(sender))
+}
@@ -0,0 +1,151 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDTM(t *testing.T) {
+	eastern := time.FixedZone("", -5*60*60)
+	cases := []struct {
+		value        string
+		expected     time.Time
+		precision    DTMPrecision
+		hasOffset    bool
+		hl7, rfc3339 string
+	}{
+		{"2022", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), PrecisionYear, false, "2022", "2022"},
+		{"202207", time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC), PrecisionMonth, false, "202207", "2022-07"},
+		{"20220723", time.Date(2022, 7, 23, 0, 0, 0, 0, time.UTC), PrecisionDay, false, "20220723", "2022-07-23"},
+		{"2022072310", time.Date(2022, 7, 23, 10, 0, 0, 0, time.UTC), PrecisionHour, false, "2022072310", "2022-07-23T10:00:00Z"},
+		{"202207231050", time.Date(2022, 7, 23, 10, 50, 0, 0, time.UTC), PrecisionMinute, false, "202207231050", "2022-07-23T10:50:00Z"},
+		{"20220723105012", time.Date(2022, 7, 23, 10, 50, 12, 0, time.UTC), PrecisionSecond, false, "20220723105012", "2022-07-23T10:50:12Z"},
+		{
+			"20220723105012.5",
+			time.Date(2022, 7, 23, 10, 50, 12, 500000000, time.UTC),
+			PrecisionFraction, false,
+			"20220723105012.5", "2022-07-23T10:50:12.5Z",
+		},
+		{
+			"20220723105012.1234-0500",
+			time.Date(2022, 7, 23, 10, 50, 12, 123400000, eastern),
+			PrecisionFraction, true,
+			"20220723105012.1234-0500", "2022-07-23T10:50:12.1234-05:00",
+		},
+		{
+			"20220723105000-0500",
+			time.Date(2022, 7, 23, 10, 50, 0, 0, eastern),
+			PrecisionSecond, true,
+			"20220723105000-0500", "2022-07-23T10:50:00-05:00",
+		},
+		{
+			"202207231050+0530",
+			time.Date(2022, 7, 23, 10, 50, 0, 0, time.FixedZone("", 5*60*60+30*60)),
+			PrecisionMinute, true,
+			"202207231050+0530", "2022-07-23T10:50:00+05:30",
+		},
+		{"20220723-0500", time.Date(2022, 7, 23, 0, 0, 0, 0, eastern), PrecisionDay, true, "20220723-0500", "2022-07-23"},
+	}
+	for _, c := range cases {
+		dtm, err := ParseDTM(c.value, nil)
+		if err != nil {
+			t.Logf("%s shouldn't be an error: %v", c.value, err)
+			t.Fail()
+			continue
+		}
+		if !dtm.Time.Equal(c.expected) {
+			t.Logf("%s should be %v but got %v", c.value, c.expected, dtm.Time)
+			t.Fail()
+		}
+		if dtm.Precision != c.precision || dtm.HasOffset != c.hasOffset {
+			t.Logf("%s should have precision %v and offset %v but got %v and %v", c.value, c.precision, c.hasOffset, dtm.Precision, dtm.HasOffset)
+			t.Fail()
+		}
+		if dtm.HL7() != c.hl7 {
+			t.Logf("%s should format as '%s' but got '%s'", c.value, c.hl7, dtm.HL7())
+			t.Fail()
+		}
+		if dtm.RFC3339() != c.rfc3339 {
+			t.Logf("%s should format as '%s' but got '%s'", c.value, c.rfc3339, dtm.RFC3339())
+			t.Fail()
+		}
+	}
+}
+
+func TestParseDTM_Invalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"22",
+		"20220",
+		"2022072",
+		"20221301",
+		"20220230",
+		"2022072325",
+		"202207231050.5",
+		"20220723105012.12345",
+		"20220723105012-05",
+		"20220723105012-0575",
+		"2022-07-23",
+		"19000101^30Y",
+	} {
+		if _, err := ParseDTM(value, nil); !errors.Is(err, ErrInvalidValue) {
+			t.Logf("'%s' should be an invalid value but got %v", value, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestSenderTimeZones(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("no time zone database", err)
+	}
+	zones := SenderTimeZones{
+		Default: time.FixedZone("", -5*60*60),
+		Senders: map[string]*time.Location{"mayo": chicago},
+	}
+	// a time without an offset is in the sender's zone, July in Chicago is CDT
+	dtm, err := zones.ParseDTM("mayo", "20220723105000")
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if dtm.RFC3339() != "2022-07-23T10:50:00-05:00" || dtm.HasOffset {
+		t.Logf("expected 2022-07-23T10:50:00-05:00 with no offset but got %s, %v", dtm.RFC3339(), dtm.HasOffset)
+		t.Fail()
+	}
+	// and in the default zone for anyone else
+	dtm, _ = zones.ParseDTM("sonic", "20220123105000")
+	if dtm.RFC3339() != "2022-01-23T10:50:00-05:00" {
+		t.Logf("expected 2022-01-23T10:50:00-05:00 but got %s", dtm.RFC3339())
+		t.Fail()
+	}
+	// an offset in the value always wins
+	dtm, _ = zones.ParseDTM("mayo", "20220723105000+0000")
+	if dtm.RFC3339() != "2022-07-23T10:50:00Z" {
+		t.Logf("expected 2022-07-23T10:50:00Z but got %s", dtm.RFC3339())
+		t.Fail()
+	}
+	// the HL7 form keeps what was sent, without inventing an offset
+	dtm, _ = zones.ParseDTM("mayo", "202207231050")
+	if dtm.HL7() != "202207231050" {
+		t.Logf("expected 202207231050 but got %s", dtm.HL7())
+		t.Fail()
+	}
+	if (SenderTimeZones{}).Location("anyone") != time.UTC {
+		t.Log("no zones should mean UTC")
+		t.Fail()
+	}
+}
+
+func TestTS_Parse(t *testing.T) {
+	ts := ParseTS("20220723105000-0500^S", DefaultDelimiters, "2.5.1")
+	dtm, err := ts.Parse(nil)
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if dtm.HL7() != "20220723105000-0500" {
+		t.Logf("expected 20220723105000-0500 but got %s", dtm.HL7())
+		t.Fail()
+	}
+}
@@ -0,0 +1,101 @@
+package hl7Utilities
+
+import "strings"
+
+// ER7Options - controls how a message is written out as ER7, the pipe delimited encoding
+type ER7Options struct {
+	// SegmentTerminator - written after every segment. defaults to "\r", which is what the standard
+	// requires, but "\n" or "\r\n" are handy when writing files for people to read
+	SegmentTerminator string
+	// TrimTrailingDelimiters - drops empty fields, repetitions, components and subcomponents from
+	// the end of each level, so `PID|1||ID^^^|||` is written as `PID|1||ID`
+	TrimTrailingDelimiters bool
+}
+
+// EncodeER7 - writes the message out as ER7. an unmodified message with the default options comes
+// back exactly as it was parsed, as long as the original used "\r" between segments
+func (m *ParsedMessage) EncodeER7(options ER7Options) string {
+	terminator := options.SegmentTerminator
+	if terminator == "" {
+		terminator = "\r"
+	}
+	var er7 strings.Builder
+	for _, s := range m.Segments {
+		er7.WriteString(s.encode(m.Delimiters, options.TrimTrailingDelimiters))
+		er7.WriteString(terminator)
+	}
+	return er7.String()
+}
+
+// String - the message encoded as ER7 with the default options
+func (m *ParsedMessage) String() string {
+	return m.EncodeER7(ER7Options{})
+}
+
+// EncodeER7 - parses the message and writes it back out as ER7 with the options
+func (message Hl7Message) EncodeER7(options ER7Options) (string, error) {
+	parsed, err := message.Parse()
+	if err != nil {
+		return "", err
+	}
+	return parsed.EncodeER7(options), nil
+}
+
+// encode - joins the segment back together with the delimiters
+func (s *ParsedSegment) encode(delimiters Delimiters, trim bool) string {
+	parts := []string{s.Name}
+	fields := s.Fields
+	if isHeaderSegment(s.Name) && len(fields) > 0 {
+		// MSH-1 is the field separator itself, which gets written when we join the fields
+		fields = fields[1:]
+	}
+	for _, f := range fields {
+		parts = append(parts, f.encode(delimiters, trim))
+	}
+	if trim {
+		parts = trimTrailingEmpty(parts)
+	}
+	return strings.Join(parts, delimiters.Field)
+}
+
+// encode - joins the field's repetitions, components and subcomponents back together
+func (f *Field) encode(delimiters Delimiters, trim bool) string {
+	repetitions := make([]string, 0, len(f.Repetitions))
+	for _, r := range f.Repetitions {
+		repetitions = append(repetitions, r.encode(delimiters, trim))
+	}
+	if trim {
+		repetitions = trimTrailingEmpty(repetitions)
+	}
+	return strings.Join(repetitions, delimiters.Repetition)
+}
+
+// encode - joins the repetition's components and subcomponents back together
+func (r *Repetition) encode(delimiters Delimiters, trim bool) string {
+	components := make([]string, 0, len(r.Components))
+	for _, c := range r.Components {
+		components = append(components, c.encode(delimiters, trim))
+	}
+	if trim {
+		components = trimTrailingEmpty(components)
+	}
+	return strings.Join(components, delimiters.Component)
+}
+
+// encode - joins the component's subcomponents back together
+func (c *Component) encode(delimiters Delimiters, trim bool) string {
+	subcomponents := c.Subcomponents
+	if trim {
+		subcomponents = trimTrailingEmpty(subcomponents)
+	}
+	return strings.Join(subcomponents, delimiters.Subcomponent)
+}
+
+// trimTrailingEmpty - drops the empty strings off the end of a list
+func trimTrailingEmpty(values []string) []string {
+	end := len(values)
+	for end > 0 && values[end-1] == "" {
+		end--
+	}
+	return values[:end]
+}
@@ -0,0 +1,85 @@
+package hl7Utilities
+
+import (
+	"strings"
+	"testing"
+)
+
+// toER7 - our sample messages are written with "\n" so they're readable, but real ER7 uses "\r"
+func toER7(message string) string {
+	return strings.ReplaceAll(strings.TrimLeft(message, "\n"), "\n", "\r")
+}
+
+func TestParsedMessage_EncodeER7_roundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{"MSH only", mshMessage + "\r"},
+		{"simple ORU_R01", toER7(simpleHl7Message)},
+		{
+			"custom delimiters",
+			"MSH#*!\\$#SENDER*APP#FACILITY###20220802##ORU*R01*ORU_R01#1#P#2.5.1\rPID#1##ID1*X/S/Y*AUTH$OID!ID2\r",
+		},
+		{
+			"v2.7 truncation character",
+			"MSH|^~\\&#|SENDER|FAC|||20220802||ACK^R01^ACK|1|P|2.7\rMSA|AA|1|Truncated \\P\\\r",
+		},
+		{"empty trailing fields", mshMessage + "\rPID|1||||||||||||||||\rNTE|1||a^^^&&~~|\r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseMessage(tt.message)
+			if err != nil {
+				t.Fatalf("ParseMessage() error = %v", err)
+			}
+			if got := parsed.EncodeER7(ER7Options{}); got != tt.message {
+				t.Errorf("EncodeER7() = %q, want %q", got, tt.message)
+			}
+			if got := parsed.String(); got != tt.message {
+				t.Errorf("String() = %q, want %q", got, tt.message)
+			}
+		})
+	}
+}
+
+func TestParsedMessage_EncodeER7_options(t *testing.T) {
+	raw := mshMessage + "||\rPID|1||ID^^^&&~~||\rNTE|1||note \r"
+	tests := []struct {
+		name    string
+		options ER7Options
+		want    string
+	}{
+		{"defaults", ER7Options{}, raw},
+		{"newline terminator", ER7Options{SegmentTerminator: "\n"}, strings.ReplaceAll(raw, "\r", "\n")},
+		{
+			"trim trailing delimiters",
+			ER7Options{TrimTrailingDelimiters: true},
+			mshMessage + "\rPID|1||ID\rNTE|1||note \r",
+		},
+	}
+	parsed, err := ParseMessage(raw)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsed.EncodeER7(tt.options); got != tt.want {
+				t.Errorf("EncodeER7() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHl7Message_EncodeER7(t *testing.T) {
+	got, err := Hl7Message{RawMessage: simpleHl7Message}.EncodeER7(ER7Options{SegmentTerminator: "\n"})
+	if err != nil {
+		t.Fatalf("EncodeER7() error = %v", err)
+	}
+	if got != strings.TrimLeft(simpleHl7Message, "\n") {
+		t.Errorf("EncodeER7() = %q", got)
+	}
+	if _, err := (Hl7Message{RawMessage: "PID|1"}).EncodeER7(ER7Options{}); err == nil {
+		t.Errorf("EncodeER7() should fail for a message without an MSH")
+	}
+}
@@ -0,0 +1,27 @@
+package hl7Utilities
+
+import "errors"
+
+// the errors returned by this package wrap one of these, so callers can tell what went wrong with
+// errors.Is without having to match on the message text
+var (
+	// ErrInvalidMessage - the message doesn't start with a usable MSH segment
+	ErrInvalidMessage = errors.New("invalid HL7 message")
+	// ErrInvalidSpecification - the terser specification couldn't be understood
+	ErrInvalidSpecification = errors.New("invalid terser specification")
+	// ErrSegmentNotFound - the message doesn't contain the segment the specification asked for
+	ErrSegmentNotFound = errors.New("segment not found")
+	// ErrFieldOutOfRange - the segment exists, but the field, repetition, component or subcomponent
+	// the specification asked for isn't present in it. a value that is present but empty is not
+	// an error, Get returns a pointer to an empty string for those instead
+	ErrFieldOutOfRange = errors.New("field out of range")
+	// ErrInvalidValue - a value that doesn't fit its data type, like a telephone number with no digits
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrInvalidBatch - the FHS/BHS envelope around a batch of messages is out of order, or the
+	// counts in its BTS or FTS trailers don't match the messages it holds
+	ErrInvalidBatch = errors.New("invalid HL7 batch")
+	// ErrTableNotFound - there's no HL7 table with the number that was asked for
+	ErrTableNotFound = errors.New("HL7 table not found")
+	// ErrProfileNotFound - the message doesn't name a conformance profile we have in MSH-21
+	ErrProfileNotFound = errors.New("conformance profile not found")
+)
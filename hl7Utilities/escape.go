@@ -0,0 +1,159 @@
+package hl7Utilities
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Decode - replaces the HL7 escape sequences in a primitive value with the characters they stand for,
+// using this message's own delimiters. the supported sequences are
+//
+//	\F\ \S\ \T\ \R\ \E\   the field, component, subcomponent, repetition and escape characters
+//	\P\                   the truncation character (v2.7+)
+//	\Xhh...\              hex encoded bytes
+//	\.br\ \.sp n\         line breaks, which become "\n", up to 100 of them for \.sp\
+//	\H\ \N\ \.in\ etc     highlighting and other formatting commands, which are dropped
+//
+// anything else (like \Zxx\ or the character set escapes) and any unterminated escape is left alone
+func (d Delimiters) Decode(value string) string {
+	escape := d.Escape
+	if escape == "" || !strings.Contains(value, escape) {
+		return value
+	}
+	var decoded strings.Builder
+	remainder := value
+	for {
+		start := strings.Index(remainder, escape)
+		if start < 0 {
+			decoded.WriteString(remainder)
+			break
+		}
+		end := strings.Index(remainder[start+len(escape):], escape)
+		if end < 0 {
+			// an escape character with no partner, so there's nothing to decode
+			decoded.WriteString(remainder)
+			break
+		}
+		end += start + len(escape)
+		decoded.WriteString(remainder[:start])
+		sequence := remainder[start+len(escape) : end]
+		if replacement, ok := d.decodeSequence(sequence); ok {
+			decoded.WriteString(replacement)
+		} else {
+			decoded.WriteString(remainder[start : end+len(escape)])
+		}
+		remainder = remainder[end+len(escape):]
+	}
+	return decoded.String()
+}
+
+// maxSkippedLines - the most line breaks a \.sp\ sequence can stand for. anything more is far
+// more than a report needs, and more likely a mistake or an attack than formatting
+const maxSkippedLines = 100
+
+// decodeSequence - translates the text between a pair of escape characters, returning false when
+// it isn't a sequence we understand
+func (d Delimiters) decodeSequence(sequence string) (string, bool) {
+	switch sequence {
+	case "F":
+		return d.Field, true
+	case "S":
+		return d.Component, true
+	case "T":
+		return d.Subcomponent, true
+	case "R":
+		return d.Repetition, true
+	case "E":
+		return d.Escape, true
+	case "P":
+		if d.Truncation != "" {
+			return d.Truncation, true
+		}
+		return "", false
+	case "H", "N":
+		// start and end highlighting, which means nothing in plain text
+		return "", true
+	case ".br":
+		return "\n", true
+	}
+	if strings.HasPrefix(sequence, "X") && len(sequence) > 1 {
+		decoded, err := hex.DecodeString(sequence[1:])
+		if err != nil {
+			return "", false
+		}
+		return string(decoded), true
+	}
+	if strings.HasPrefix(sequence, ".sp") {
+		// .sp takes an optional count of line breaks
+		count := 1
+		if n := strings.TrimSpace(sequence[3:]); n != "" {
+			parsed, err := strconv.Atoi(strings.TrimPrefix(n, "+"))
+			if err != nil || parsed < 0 || parsed > maxSkippedLines {
+				return "", false
+			}
+			count = parsed
+		}
+		return strings.Repeat("\n", count), true
+	}
+	for _, command := range []string{".fi", ".nf", ".in", ".ti", ".sk", ".ce"} {
+		if strings.HasPrefix(sequence, command) {
+			// the rest of the formatting commands only make sense on a fixed width display
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// Encode - escapes any characters in a primitive value that would otherwise be read as delimiters
+// by a parser using these delimiters. line breaks become \.br\
+func (d Delimiters) Encode(value string) string {
+	if value == "" {
+		return value
+	}
+	var encoded strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i : i+1]
+		switch {
+		case c == "\r":
+			// treat \r\n as a single line break
+			if i+1 < len(value) && value[i+1] == '\n' {
+				i++
+			}
+			encoded.WriteString(d.escapeSequence(".br"))
+		case c == "\n":
+			encoded.WriteString(d.escapeSequence(".br"))
+		case c == d.Escape:
+			encoded.WriteString(d.escapeSequence("E"))
+		case c == d.Field:
+			encoded.WriteString(d.escapeSequence("F"))
+		case c == d.Component:
+			encoded.WriteString(d.escapeSequence("S"))
+		case c == d.Subcomponent:
+			encoded.WriteString(d.escapeSequence("T"))
+		case c == d.Repetition:
+			encoded.WriteString(d.escapeSequence("R"))
+		case d.Truncation != "" && c == d.Truncation:
+			encoded.WriteString(d.escapeSequence("P"))
+		default:
+			encoded.WriteString(c)
+		}
+	}
+	return encoded.String()
+}
+
+// escapeSequence - wraps a sequence in our escape character
+func (d Delimiters) escapeSequence(sequence string) string {
+	return d.Escape + sequence + d.Escape
+}
+
+// containsDelimiter - true when a raw value still has structure in it, like a whole field with
+// components, which can't be decoded without losing that structure
+func (d Delimiters) containsDelimiter(value string) bool {
+	for _, delimiter := range []string{d.Field, d.Component, d.Repetition, d.Subcomponent} {
+		if delimiter != "" && strings.Contains(value, delimiter) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package hl7Utilities
+
+import "testing"
+
+func TestDelimiters_Decode(t *testing.T) {
+	truncating := DefaultDelimiters
+	truncating.Truncation = "#"
+	tests := []struct {
+		name       string
+		delimiters Delimiters
+		value      string
+		want       string
+	}{
+		{"no escapes", DefaultDelimiters, "Smith", "Smith"},
+		{"subcomponent", DefaultDelimiters, "Smith\\T\\Jones", "Smith&Jones"},
+		{"field", DefaultDelimiters, "A\\F\\B", "A|B"},
+		{"component", DefaultDelimiters, "A\\S\\B", "A^B"},
+		{"repetition", DefaultDelimiters, "A\\R\\B", "A~B"},
+		{"escape", DefaultDelimiters, "C:\\E\\temp", "C:\\temp"},
+		{"truncation", truncating, "A\\P\\B", "A#B"},
+		{"truncation without v2.7", DefaultDelimiters, "A\\P\\B", "A\\P\\B"},
+		{"hex", DefaultDelimiters, "\\X48656C6C6F\\", "Hello"},
+		{"bad hex", DefaultDelimiters, "\\XZZ\\", "\\XZZ\\"},
+		{"line break", DefaultDelimiters, "line 1\\.br\\line 2", "line 1\nline 2"},
+		{"skip lines", DefaultDelimiters, "a\\.sp 2\\b", "a\n\nb"},
+		{"skip negative lines", DefaultDelimiters, "a\\.sp-1\\b", "a\\.sp-1\\b"},
+		{"skip too many lines", DefaultDelimiters, "a\\.sp999999999999\\b", "a\\.sp999999999999\\b"},
+		{"skip one line too many", DefaultDelimiters, "\\.sp101\\", "\\.sp101\\"},
+		{"highlighting", DefaultDelimiters, "\\H\\POSITIVE\\N\\", "POSITIVE"},
+		{"formatting", DefaultDelimiters, "\\.in+4\\indented", "indented"},
+		{"local escape", DefaultDelimiters, "\\Zabc\\", "\\Zabc\\"},
+		{"unterminated", DefaultDelimiters, "trailing \\", "trailing \\"},
+		{
+			"custom delimiters",
+			Delimiters{Field: "#", Component: "*", Repetition: "!", Escape: "/", Subcomponent: "$"},
+			"A/S/B/T/C/E/D",
+			"A*B$C/D",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.delimiters.Decode(tt.value); got != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelimiters_Encode(t *testing.T) {
+	truncating := DefaultDelimiters
+	truncating.Truncation = "#"
+	tests := []struct {
+		name       string
+		delimiters Delimiters
+		value      string
+		want       string
+	}{
+		{"nothing to escape", DefaultDelimiters, "Smith", "Smith"},
+		{"every delimiter", DefaultDelimiters, "a|b^c&d~e\\f", "a\\F\\b\\S\\c\\T\\d\\R\\e\\E\\f"},
+		{"truncation", truncating, "#1", "\\P\\1"},
+		{"hash without v2.7", DefaultDelimiters, "#1", "#1"},
+		{"line breaks", DefaultDelimiters, "a\nb\r\nc\rd", "a\\.br\\b\\.br\\c\\.br\\d"},
+		{
+			"custom delimiters",
+			Delimiters{Field: "#", Component: "*", Repetition: "!", Escape: "/", Subcomponent: "$"},
+			"A*B$C/D^",
+			"A/S/B/T/C/E/D^",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := tt.delimiters.Encode(tt.value)
+			if encoded != tt.want {
+				t.Errorf("Encode() = %q, want %q", encoded, tt.want)
+			}
+			// and it has to decode back to what we started with, line breaks aside
+			if decoded := tt.delimiters.Decode(encoded); tt.name != "line breaks" && decoded != tt.value {
+				t.Errorf("Decode(Encode()) = %q, want %q", decoded, tt.value)
+			}
+		})
+	}
+}
+
+func TestHl7Message_GetDecoded(t *testing.T) {
+	hl7Message := Hl7Message{
+		RawMessage: mshMessage + "\r" +
+			"PID|1||ID1||Smith\\T\\Jones^Mary||19000101\r" +
+			"NTE|1|L|Line one\\.br\\Line two",
+	}
+	tests := []struct {
+		spec    string
+		want    string
+		wantRaw string
+	}{
+		{"PID-5-1", "Smith&Jones", "Smith\\T\\Jones"},
+		{"PID-5", "Smith\\T\\Jones^Mary", "Smith\\T\\Jones^Mary"},
+		{"NTE-3", "Line one\nLine two", "Line one\\.br\\Line two"},
+		{"MSH-2", "^~\\&", "^~\\&"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := hl7Message.Get(tt.spec)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Get() = %q, want %q", *got, tt.want)
+			}
+			raw, err := hl7Message.GetRaw(tt.spec)
+			if err != nil {
+				t.Fatalf("GetRaw() error = %v", err)
+			}
+			if *raw != tt.wantRaw {
+				t.Errorf("GetRaw() = %q, want %q", *raw, tt.wantRaw)
+			}
+		})
+	}
+}
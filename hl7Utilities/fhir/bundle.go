@@ -0,0 +1,988 @@
+package fhir
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// ErrUnsupportedMessage - the message isn't an ORU^R01, the only kind we know how to convert
+var ErrUnsupportedMessage = errors.New("fhir: only ORU_R01 messages can be converted")
+
+// the code systems we write codes from HL7 v2 messages in
+const (
+	systemLoinc               = "http://loinc.org"
+	systemSnomed              = "http://snomed.info/sct"
+	systemUcum                = "http://unitsofmeasure.org"
+	systemCdcRace             = "urn:oid:2.16.840.1.113883.6.238"
+	systemNullFlavor          = "http://terminology.hl7.org/CodeSystem/v3-NullFlavor"
+	systemObservationCategory = "http://terminology.hl7.org/CodeSystem/observation-category"
+	systemV2Table             = "http://terminology.hl7.org/CodeSystem/v2-"
+	extensionRace             = "http://hl7.org/fhir/us/core/StructureDefinition/us-core-race"
+	extensionEthnicity        = "http://hl7.org/fhir/us/core/StructureDefinition/us-core-ethnicity"
+)
+
+// codingSystems - the FHIR systems for the names HL7 v2 gives code systems in table 0396. HL7 tables,
+// like HL70078, are worked out from their number
+var codingSystems = map[string]string{
+	"LN":     systemLoinc,
+	"SCT":    systemSnomed,
+	"SNM":    systemSnomed,
+	"UCUM":   systemUcum,
+	"CDCREC": systemCdcRace,
+	"I9CM":   "http://hl7.org/fhir/sid/icd-9-cm",
+	"I10":    "http://hl7.org/fhir/sid/icd-10",
+	"I10C":   "http://hl7.org/fhir/sid/icd-10-cm",
+	"NULLFL": systemNullFlavor,
+}
+
+// idNamespace - the namespace for the name based UUIDs we give resources
+var idNamespace, _ = hex.DecodeString("8c3f5e0a7d2b4c1e9f6a0b3d5e7c9a12")
+
+// Converter - turns ORU^R01 lab results into FHIR R4 transaction bundles. the zero value is ready to
+// use
+type Converter struct {
+	// TimeZones - the time zones senders mean when they leave the UTC offset off a time, keyed by the
+	// sending facility's namespace ID in MSH-4-1. FHIR times always have an offset, so without one
+	// the times are taken to be UTC
+	TimeZones hl7Utilities.SenderTimeZones
+	// DefaultCountryCode - the country code for telephone numbers sent without one. empty means 1
+	DefaultCountryCode string
+}
+
+// ConvertORU - converts the message with a zero Converter, see [Converter.Convert]
+func ConvertORU(message hl7Utilities.Hl7Message) (*Bundle, error) {
+	return (&Converter{}).Convert(message)
+}
+
+// Convert - turns an ORU^R01 into a transaction bundle. each patient result becomes a Patient, and
+// each order in it a ServiceRequest and a DiagnosticReport, with an Observation for each OBX and a
+// Specimen for each SPM. the sending facility in MSH-4 and the ordering facility in ORC-21 become
+// Organizations, and the ordering provider in ORC-12 a Practitioner.
+//
+// resource IDs are name based UUIDs, built from the identifiers in the message, so converting the
+// same message twice gives the same bundle, and a patient, provider or facility shows up with the
+// same ID in every message the sender mentions them in. entries are PUTs to those IDs, so loading a
+// corrected result updates the resources from the original instead of adding to them
+func (c *Converter) Convert(message hl7Utilities.Hl7Message) (*Bundle, error) {
+	parsed, err := message.Parse()
+	if err != nil {
+		return nil, err
+	}
+	structure, err := parsed.Structure()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedMessage, err)
+	}
+	if structure.Name != "ORU_R01" {
+		return nil, fmt.Errorf("%w: got %s", ErrUnsupportedMessage, structure.Name)
+	}
+	root := parsed.Groups(structure)
+	msh := parsed.Segment("MSH", 0)
+	version := msh.Field(12).Value()
+	sendingFacility := hl7Utilities.NewHD(msh.Field(4).Repetition(0), parsed.Delimiters, version)
+	v := &conversion{
+		converter:  c,
+		delimiters: parsed.Delimiters,
+		version:    version,
+		sender:     joinKey(sendingFacility.UniversalId, sendingFacility.NamespaceId),
+		timeZone:   sendingFacility.NamespaceId,
+		added:      make(map[string]bool),
+	}
+	controlId := parsed.Delimiters.Decode(msh.Field(10).Value())
+	v.bundle = &Bundle{
+		DomainResource: DomainResource{ResourceType: "Bundle", Id: v.id("Bundle", controlId)},
+		Type:           "transaction",
+		Timestamp:      v.dateTime(msh.Field(7)),
+	}
+	if controlId != "" {
+		v.bundle.Identifier = &Identifier{System: hdSystem(sendingFacility), Value: controlId}
+	}
+	v.labOrganization = v.addHD(sendingFacility)
+	for _, patientResult := range root.GroupsNamed("PATIENT_RESULT") {
+		v.patientResult(patientResult)
+	}
+	return v.bundle, nil
+}
+
+// JSON - the bundle as indented JSON. comparators and text like <5 are left as they are, rather than
+// escaped the way encoding/json does for HTML
+func (b *Bundle) JSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(b); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// conversion - what we need while converting one message
+type conversion struct {
+	converter  *Converter
+	delimiters hl7Utilities.Delimiters
+	version    string
+	// sender - the sending facility, which makes the keys for the IDs of the sender's resources unique
+	sender string
+	// timeZone - who the sender is for Converter.TimeZones
+	timeZone        string
+	bundle          *Bundle
+	labOrganization *Reference
+	added           map[string]bool
+}
+
+// id - a name based UUID, version 5 in RFC 4122, for the resource type and the parts of its key
+func (v *conversion) id(resourceType string, parts ...string) string {
+	hash := sha1.New()
+	hash.Write(idNamespace)
+	hash.Write([]byte(joinKey(append([]string{resourceType, v.sender}, parts...)...)))
+	sum := hash.Sum(nil)[:16]
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	encoded := hex.EncodeToString(sum)
+	return strings.Join([]string{encoded[:8], encoded[8:12], encoded[12:16], encoded[16:20], encoded[20:]}, "-")
+}
+
+// add - adds the resource to the bundle, unless one with the same ID is already there, and returns the
+// reference to it
+func (v *conversion) add(resource Resource) *Reference {
+	header := resource.domainResource()
+	reference := &Reference{Reference: "urn:uuid:" + header.Id}
+	if v.added[header.Id] {
+		return reference
+	}
+	v.added[header.Id] = true
+	v.bundle.Entry = append(v.bundle.Entry, &BundleEntry{
+		FullUrl:  reference.Reference,
+		Resource: resource,
+		Request:  &BundleEntryRequest{Method: "PUT", Url: header.ResourceType + "/" + header.Id},
+	})
+	return reference
+}
+
+// patientResult - converts a PATIENT_RESULT group, the patient and their orders
+func (v *conversion) patientResult(group *hl7Utilities.MessageGroup) {
+	var subject *Reference
+	if pid := group.Group("PATIENT", 0).Segment("PID", 0); pid != nil {
+		subject = v.patient(pid)
+	}
+	for _, order := range group.GroupsNamed("ORDER_OBSERVATION") {
+		v.order(order, subject)
+	}
+}
+
+// patient - converts a PID into a Patient
+func (v *conversion) patient(segment *hl7Utilities.ParsedSegment) *Reference {
+	pid, _ := hl7Utilities.NewSegment[hl7Utilities.PID](segment, v.delimiters)
+	patient := &Patient{DomainResource: DomainResource{ResourceType: "Patient"}}
+	for _, r := range repetitions(pid.PatientIdentifierList()) {
+		cx := hl7Utilities.NewCX(r, v.delimiters, v.version)
+		if cx.IdNumber == "" {
+			continue
+		}
+		identifier := &Identifier{System: hdSystem(cx.AssigningAuthority), Value: cx.IdNumber}
+		if cx.IdentifierTypeCode != "" {
+			identifier.Type = v2Concept("0203", cx.IdentifierTypeCode, "")
+		}
+		patient.Identifier = append(patient.Identifier, identifier)
+	}
+	for _, r := range repetitions(pid.PatientName()) {
+		if name := humanName(hl7Utilities.NewXPN(r, v.delimiters, v.version)); name != nil {
+			patient.Name = append(patient.Name, name)
+		}
+	}
+	for _, r := range repetitions(pid.PhoneNumberHome()) {
+		if telecom := v.contactPoint(hl7Utilities.NewXTN(r, v.delimiters, v.version), "home"); telecom != nil {
+			patient.Telecom = append(patient.Telecom, telecom)
+		}
+	}
+	switch v.delimiters.Decode(pid.AdministrativeSex().Value()) {
+	case "M":
+		patient.Gender = "male"
+	case "F":
+		patient.Gender = "female"
+	case "O", "A":
+		patient.Gender = "other"
+	case "U", "N":
+		patient.Gender = "unknown"
+	}
+	if birth := v.dtm(pid.DateTimeOfBirth()); !birth.IsZero() {
+		patient.BirthDate = birth.RFC3339()
+		if birth.Precision > hl7Utilities.PrecisionDay {
+			patient.BirthDate = birth.Time.Format("2006-01-02")
+		}
+	}
+	if death := v.dateTime(pid.PatientDeathDateAndTime()); death != "" {
+		patient.DeceasedDateTime = death
+	} else if indicator := v.delimiters.Decode(pid.PatientDeathIndicator().Value()); indicator == "Y" || indicator == "N" {
+		deceased := indicator == "Y"
+		patient.DeceasedBoolean = &deceased
+	}
+	for _, r := range repetitions(pid.PatientAddress()) {
+		if address := address(hl7Utilities.NewXAD(r, v.delimiters, v.version)); address != nil {
+			patient.Address = append(patient.Address, address)
+		}
+	}
+	if race := v.raceExtension(extensionRace, pid.Race(), nil); race != nil {
+		patient.Extension = append(patient.Extension, race)
+	}
+	// HL7 table 0189 is what ELR uses for ethnicity, so its codes are mapped onto the CDC ones
+	ethnicGroups := map[string]string{"H": "2135-2", "N": "2186-5"}
+	if ethnicity := v.raceExtension(extensionEthnicity, pid.EthnicGroup(), ethnicGroups); ethnicity != nil {
+		patient.Extension = append(patient.Extension, ethnicity)
+	}
+	if len(patient.Identifier) > 0 {
+		patient.Id = v.id("Patient", patient.Identifier[0].System, patient.Identifier[0].Value)
+	} else {
+		// no identifier to key on, so the best we can do is the name and birth date
+		name := ""
+		if len(patient.Name) > 0 {
+			name = patient.Name[0].Text
+		}
+		patient.Id = v.id("Patient", name, patient.BirthDate)
+	}
+	return v.add(patient)
+}
+
+// raceExtension - the US Core race or ethnicity extension for PID-10 or PID-22. CDC race and
+// ethnicity codes, and the ones the mapping turns into them, go in ombCategory, unknown and asked
+// but unknown become null flavors, and everything else is only text
+func (v *conversion) raceExtension(url string, field *hl7Utilities.Field, mapping map[string]string) *Extension {
+	var extension *Extension
+	var texts []string
+	for _, r := range repetitions(field) {
+		cwe := hl7Utilities.NewCWE(r, v.delimiters, v.version)
+		if cwe.Identifier == "" && cwe.Text == "" {
+			continue
+		}
+		if extension == nil {
+			extension = &Extension{Url: url}
+		}
+		var coding *Coding
+		switch {
+		case cwe.Identifier == "UNK" || cwe.Identifier == "ASKU" || (mapping != nil && cwe.Identifier == "U"):
+			code := cwe.Identifier
+			if code == "U" {
+				code = "UNK"
+			}
+			coding = &Coding{System: systemNullFlavor, Code: code}
+		case cwe.NameOfCodingSystem == "CDCREC":
+			coding = &Coding{System: systemCdcRace, Code: cwe.Identifier, Display: cwe.Text}
+		case mapping[cwe.Identifier] != "":
+			coding = &Coding{System: systemCdcRace, Code: mapping[cwe.Identifier], Display: cwe.Text}
+		}
+		if coding != nil {
+			extension.Extension = append(extension.Extension, &Extension{Url: "ombCategory", ValueCoding: coding})
+		}
+		texts = append(texts, cwe.DisplayText())
+	}
+	if extension != nil {
+		extension.Extension = append(extension.Extension, &Extension{Url: "text", ValueString: strings.Join(texts, ", ")})
+	}
+	return extension
+}
+
+// order - converts an ORDER_OBSERVATION group into a ServiceRequest and the DiagnosticReport with its
+// results
+func (v *conversion) order(group *hl7Utilities.MessageGroup, subject *Reference) {
+	obrSegment := group.Segment("OBR", 0)
+	if obrSegment == nil {
+		return
+	}
+	obr, _ := hl7Utilities.NewSegment[hl7Utilities.OBR](obrSegment, v.delimiters)
+	// an order without an ORC is left as the zero ORC, whose fields are all nil
+	var orc hl7Utilities.ORC
+	if orcSegment := group.Segment("ORC", 0); orcSegment != nil {
+		orc, _ = hl7Utilities.NewSegment[hl7Utilities.ORC](orcSegment, v.delimiters)
+	}
+	placer := v.ei(obr.PlacerOrderNumber(), orc.PlacerOrderNumber())
+	filler := v.ei(obr.FillerOrderNumber(), orc.FillerOrderNumber())
+	// the filler order number is the lab's accession number, which is what stays the same when a
+	// result is corrected
+	orderKey := joinKey(filler.UniversalId, filler.NamespaceId, filler.EntityIdentifier)
+	if filler.EntityIdentifier == "" {
+		orderKey = joinKey(placer.UniversalId, placer.NamespaceId, placer.EntityIdentifier, v.delimiters.Decode(obr.SetId().Value()))
+	}
+	var identifiers []*Identifier
+	if placer.EntityIdentifier != "" {
+		identifiers = append(identifiers, eiIdentifier(placer, "PLAC", "Placer Identifier"))
+	}
+	if filler.EntityIdentifier != "" {
+		identifiers = append(identifiers, eiIdentifier(filler, "FILL", "Filler Identifier"))
+	}
+	code := v.concept(obr.UniversalServiceIdentifier())
+	reportStatus := diagnosticReportStatus(v.delimiters.Decode(obr.ResultStatus().Value()))
+	request := &ServiceRequest{
+		DomainResource: DomainResource{ResourceType: "ServiceRequest", Id: v.id("ServiceRequest", orderKey)},
+		Identifier:     identifiers,
+		Status:         "active",
+		Intent:         "order",
+		Code:           code,
+		Subject:        subject,
+		AuthoredOn:     v.dateTime(orc.OrderEffectiveDateTime()),
+		Requester:      v.requester(orc, obr),
+	}
+	orderControl := v.delimiters.Decode(orc.OrderControl().Value())
+	switch {
+	case orderControl == "CA" || orderControl == "OC":
+		request.Status = "revoked"
+	case reportStatus == "final" || reportStatus == "corrected":
+		request.Status = "completed"
+	}
+	requestReference := &Reference{Reference: "urn:uuid:" + request.Id}
+	report := &DiagnosticReport{
+		DomainResource:    DomainResource{ResourceType: "DiagnosticReport", Id: v.id("DiagnosticReport", orderKey)},
+		Identifier:        identifiers,
+		BasedOn:           []*Reference{requestReference},
+		Status:            reportStatus,
+		Category:          []*CodeableConcept{v2Concept("0074", "LAB", "Laboratory")},
+		Code:              code,
+		Subject:           subject,
+		EffectiveDateTime: v.dateTime(obr.ObservationDateTime()),
+		Issued:            v.instant(obr.ResultsReportStatusChangeDateTime()),
+	}
+	if v.labOrganization != nil {
+		report.Performer = []*Reference{v.labOrganization}
+	}
+	// specimens first, so the observations can point at them
+	for i, specimenGroup := range group.GroupsNamed("SPECIMEN") {
+		spm := specimenGroup.Segment("SPM", 0)
+		if spm == nil {
+			continue
+		}
+		specimen := v.specimen(spm, joinKey(orderKey, strconv.Itoa(i)), subject, requestReference)
+		request.Specimen = append(request.Specimen, specimen)
+		report.Specimen = append(report.Specimen, specimen)
+	}
+	var specimen *Reference
+	if len(report.Specimen) > 0 {
+		specimen = report.Specimen[0]
+	}
+	v.add(request)
+	observations := 0
+	observation := func(obx *hl7Utilities.ParsedSegment, notes []*hl7Utilities.ParsedSegment, specimen *Reference) {
+		observations++
+		result := v.observation(obx, notes, joinKey(orderKey, strconv.Itoa(observations)), subject, specimen, report)
+		report.Result = append(report.Result, result)
+	}
+	for _, observationGroup := range group.GroupsNamed("OBSERVATION") {
+		if obx := observationGroup.Segment("OBX", 0); obx != nil {
+			observation(obx, observationGroup.SegmentsNamed("NTE"), specimen)
+		}
+	}
+	for i, specimenGroup := range group.GroupsNamed("SPECIMEN") {
+		// the OBX segments after an SPM are about the specimen, like how it was collected
+		for _, obx := range specimenGroup.SegmentsNamed("OBX") {
+			observation(obx, nil, report.Specimen[i])
+		}
+	}
+	v.add(report)
+}
+
+// requester - whoever ordered the test. a provider ordering for a facility becomes a
+// PractitionerRole tying the two together, otherwise it's whichever of them we have
+func (v *conversion) requester(orc hl7Utilities.ORC, obr hl7Utilities.OBR) *Reference {
+	provider := orc.OrderingProvider()
+	if repetitions(provider) == nil {
+		provider = obr.OrderingProvider()
+	}
+	practitioner := v.practitioner(provider, orc.OrderingProviderAddress())
+	organization := v.organization(orc.OrderingFacilityName(), orc.OrderingFacilityAddress(), orc.OrderingFacilityPhoneNumber())
+	if practitioner == nil || organization == nil {
+		if practitioner != nil {
+			return practitioner
+		}
+		return organization
+	}
+	role := &PractitionerRole{
+		DomainResource: DomainResource{
+			ResourceType: "PractitionerRole",
+			Id:           v.id("PractitionerRole", practitioner.Reference, organization.Reference),
+		},
+		Practitioner: practitioner,
+		Organization: organization,
+	}
+	return v.add(role)
+}
+
+// practitioner - converts an XCN, like ORC-12, into a Practitioner, or returns nil when it's empty
+func (v *conversion) practitioner(field, addresses *hl7Utilities.Field) *Reference {
+	r := firstRepetition(field)
+	if r == nil {
+		return nil
+	}
+	xcn := hl7Utilities.NewXCN(r, v.delimiters, v.version)
+	practitioner := &Practitioner{DomainResource: DomainResource{ResourceType: "Practitioner"}}
+	if xcn.IdNumber != "" {
+		identifier := &Identifier{System: hdSystem(xcn.AssigningAuthority), Value: xcn.IdNumber}
+		if xcn.IdentifierTypeCode != "" {
+			identifier.Type = v2Concept("0203", xcn.IdentifierTypeCode, "")
+		}
+		practitioner.Identifier = []*Identifier{identifier}
+	}
+	name := humanName(hl7Utilities.XPN{
+		FamilyName:                 xcn.FamilyName,
+		GivenName:                  xcn.GivenName,
+		SecondAndFurtherGivenNames: xcn.SecondAndFurtherGivenNames,
+		Suffix:                     xcn.Suffix,
+		Prefix:                     xcn.Prefix,
+		Degree:                     xcn.Degree,
+		NameTypeCode:               xcn.NameTypeCode,
+		ProfessionalSuffix:         xcn.ProfessionalSuffix,
+	})
+	if name != nil {
+		practitioner.Name = []*HumanName{name}
+	}
+	for _, r := range repetitions(addresses) {
+		if address := address(hl7Utilities.NewXAD(r, v.delimiters, v.version)); address != nil {
+			practitioner.Address = append(practitioner.Address, address)
+		}
+	}
+	if practitioner.Identifier == nil && practitioner.Name == nil {
+		return nil
+	}
+	nameText := ""
+	if name != nil {
+		nameText = name.Text
+	}
+	practitioner.Id = v.id("Practitioner", hdSystem(xcn.AssigningAuthority), xcn.IdNumber, nameText)
+	return v.add(practitioner)
+}
+
+// organization - converts an XON, like ORC-21, along with its address and phone number into an
+// Organization, or returns nil when it's empty
+func (v *conversion) organization(name, addresses, phones *hl7Utilities.Field) *Reference {
+	r := firstRepetition(name)
+	if r == nil {
+		return nil
+	}
+	xon := hl7Utilities.NewXON(r, v.delimiters, v.version)
+	organization := &Organization{DomainResource: DomainResource{ResourceType: "Organization"}, Name: xon.OrganizationName}
+	if xon.OrganizationIdentifier != "" {
+		organization.Identifier = []*Identifier{{System: hdSystem(xon.AssigningAuthority), Value: xon.OrganizationIdentifier}}
+	}
+	for _, r := range repetitions(addresses) {
+		if address := address(hl7Utilities.NewXAD(r, v.delimiters, v.version)); address != nil {
+			organization.Address = append(organization.Address, address)
+		}
+	}
+	for _, r := range repetitions(phones) {
+		if telecom := v.contactPoint(hl7Utilities.NewXTN(r, v.delimiters, v.version), "work"); telecom != nil {
+			organization.Telecom = append(organization.Telecom, telecom)
+		}
+	}
+	if organization.Name == "" && organization.Identifier == nil {
+		return nil
+	}
+	organization.Id = v.id("Organization", hdSystem(xon.AssigningAuthority), xon.OrganizationIdentifier, xon.OrganizationName)
+	return v.add(organization)
+}
+
+// addHD - converts a facility like MSH-4 into an Organization, or returns nil when it's empty
+func (v *conversion) addHD(hd hl7Utilities.HD) *Reference {
+	if hd.NamespaceId == "" && hd.UniversalId == "" {
+		return nil
+	}
+	organization := &Organization{
+		DomainResource: DomainResource{ResourceType: "Organization", Id: v.id("Organization", hd.UniversalId, hd.NamespaceId)},
+		Name:           hd.NamespaceId,
+	}
+	if hd.UniversalId != "" {
+		organization.Identifier = []*Identifier{{System: "urn:ietf:rfc:3986", Value: hdSystem(hd)}}
+	}
+	return v.add(organization)
+}
+
+// specimen - converts an SPM into a Specimen
+func (v *conversion) specimen(segment *hl7Utilities.ParsedSegment, key string, subject, request *Reference) *Reference {
+	spm, _ := hl7Utilities.NewSegment[hl7Utilities.SPM](segment, v.delimiters)
+	specimen := &Specimen{
+		DomainResource: DomainResource{ResourceType: "Specimen"},
+		Type:           v.concept(spm.SpecimenType()),
+		Subject:        subject,
+		ReceivedTime:   v.dateTime(spm.SpecimenReceivedDateTime()),
+		Request:        []*Reference{request},
+	}
+	// SPM-2 is an EIP, the placer's ID and then the filler's, each an EI in the subcomponents
+	if r := firstRepetition(spm.SpecimenId()); r != nil {
+		for i, kind := range []struct{ code, display string }{{"PLAC", "Placer Identifier"}, {"FILL", "Filler Identifier"}} {
+			component := r.Component(i + 1)
+			ei := hl7Utilities.EI{
+				EntityIdentifier: v.delimiters.Decode(component.Subcomponent(1)),
+				NamespaceId:      v.delimiters.Decode(component.Subcomponent(2)),
+				UniversalId:      v.delimiters.Decode(component.Subcomponent(3)),
+				UniversalIdType:  v.delimiters.Decode(component.Subcomponent(4)),
+			}
+			if ei.EntityIdentifier != "" {
+				specimen.Identifier = append(specimen.Identifier, eiIdentifier(ei, kind.code, kind.display))
+			}
+		}
+	}
+	collection := &SpecimenCollection{BodySite: v.concept(spm.SpecimenSourceSite())}
+	if r := firstRepetition(spm.SpecimenCollectionDateTime()); r != nil {
+		// SPM-17 is a DR, and the time the collection started is the DTM in its first component
+		collection.CollectedDateTime = v.formatDateTime(r.Component(1).Subcomponent(1))
+	}
+	if collection.CollectedDateTime != "" || collection.BodySite != nil {
+		specimen.Collection = collection
+	}
+	if len(specimen.Identifier) > 0 {
+		last := specimen.Identifier[len(specimen.Identifier)-1]
+		key = joinKey(last.System, last.Value)
+	}
+	specimen.Id = v.id("Specimen", key)
+	return v.add(specimen)
+}
+
+// observation - converts an OBX, and the NTE segments following it, into an Observation
+func (v *conversion) observation(
+	segment *hl7Utilities.ParsedSegment,
+	notes []*hl7Utilities.ParsedSegment,
+	key string,
+	subject, specimen *Reference,
+	report *DiagnosticReport,
+) *Reference {
+	obx, _ := hl7Utilities.NewSegment[hl7Utilities.OBX](segment, v.delimiters)
+	observation := &Observation{
+		DomainResource:    DomainResource{ResourceType: "Observation", Id: v.id("Observation", key)},
+		BasedOn:           report.BasedOn,
+		Status:            observationStatus(v.delimiters.Decode(obx.ObservationResultStatus().Value())),
+		Category:          []*CodeableConcept{{Coding: []*Coding{{System: systemObservationCategory, Code: "laboratory", Display: "Laboratory"}}}},
+		Code:              v.concept(obx.ObservationIdentifier()),
+		Subject:           subject,
+		EffectiveDateTime: v.dateTime(obx.DateTimeOfTheObservation()),
+		Issued:            report.Issued,
+		Performer:         report.Performer,
+		Method:            v.concept(obx.ObservationMethod()),
+		Specimen:          specimen,
+	}
+	if observation.Code == nil {
+		observation.Code = &CodeableConcept{Text: "unknown"}
+	}
+	if observation.EffectiveDateTime == "" {
+		observation.EffectiveDateTime = report.EffectiveDateTime
+	}
+	v.observationValue(observation, obx)
+	for _, r := range repetitions(obx.AbnormalFlags()) {
+		code := v.delimiters.Decode(r.Value())
+		if code == "" {
+			continue
+		}
+		display, _ := hl7Utilities.DefaultTables.Display("0078", code)
+		observation.Interpretation = append(observation.Interpretation, v2Concept("0078", code, display))
+	}
+	if referenceRange := v.delimiters.Decode(obx.ReferencesRange().Value()); referenceRange != "" {
+		observation.ReferenceRange = []*ObservationReferenceRange{{Text: referenceRange}}
+	}
+	for _, note := range notes {
+		var lines []string
+		for _, r := range repetitions(note.Field(3)) {
+			lines = append(lines, v.delimiters.Decode(r.Value()))
+		}
+		if text := strings.Join(lines, "\n"); text != "" {
+			observation.Note = append(observation.Note, &Annotation{Text: text})
+		}
+	}
+	return v.add(observation)
+}
+
+// observationValue - sets the value[x] for OBX-5, picking the type from OBX-2
+func (v *conversion) observationValue(observation *Observation, obx hl7Utilities.OBX) {
+	r := firstRepetition(obx.ObservationValue())
+	if r == nil {
+		return
+	}
+	switch v.delimiters.Decode(obx.ValueType().Value()) {
+	case "NM":
+		if number, ok := decimal(v.delimiters.Decode(r.Value())); ok {
+			observation.ValueQuantity = v.quantity(number, "", obx.Units())
+			return
+		}
+	case "SN":
+		// SN is a comparator, a number, and then a separator and a second number for ratios and ranges,
+		// which we can only give as text
+		comparator := v.delimiters.Decode(r.Component(1).Value())
+		separator := v.delimiters.Decode(r.Component(3).Value())
+		if number, ok := decimal(v.delimiters.Decode(r.Component(2).Value())); ok && separator == "" {
+			switch comparator {
+			case "", "=":
+				comparator = ""
+			case "<", "<=", ">", ">=":
+			default:
+				comparator = "invalid"
+			}
+			if comparator != "invalid" {
+				observation.ValueQuantity = v.quantity(number, comparator, obx.Units())
+				return
+			}
+		}
+		var parts []string
+		for i := 1; i <= 4; i++ {
+			parts = append(parts, v.delimiters.Decode(r.Component(i).Value()))
+		}
+		observation.ValueString = strings.Join(parts, "")
+		return
+	case "CE", "CWE", "CNE", "CF":
+		observation.ValueCodeableConcept = v.concept(obx.ObservationValue())
+		return
+	case "DT", "TS", "DTM":
+		if value := v.formatDateTime(r.Value()); value != "" {
+			observation.ValueDateTime = value
+			return
+		}
+	case "TM":
+		if t := v.delimiters.Decode(r.Value()); len(t) >= 4 {
+			seconds := "00"
+			if len(t) >= 6 {
+				seconds = t[4:6]
+			}
+			observation.ValueTime = t[0:2] + ":" + t[2:4] + ":" + seconds
+			return
+		}
+	}
+	var lines []string
+	for _, r := range repetitions(obx.ObservationValue()) {
+		var parts []string
+		for i := range r.Components {
+			parts = append(parts, v.delimiters.Decode(r.Component(i+1).Value()))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(parts, " "), " "))
+	}
+	observation.ValueString = strings.Join(lines, "\n")
+}
+
+// quantity - a number with the units from a field like OBX-6
+func (v *conversion) quantity(number json.Number, comparator string, units *hl7Utilities.Field) *Quantity {
+	quantity := &Quantity{Value: number, Comparator: comparator}
+	if r := firstRepetition(units); r != nil {
+		unit := hl7Utilities.NewCWE(r, v.delimiters, v.version)
+		quantity.Unit = unit.DisplayText()
+		if unit.NameOfCodingSystem == "UCUM" {
+			quantity.System, quantity.Code = systemUcum, unit.Identifier
+		}
+	}
+	return quantity
+}
+
+// concept - converts the first repetition of a coded field, or returns nil when it's empty
+func (v *conversion) concept(field *hl7Utilities.Field) *CodeableConcept {
+	r := firstRepetition(field)
+	if r == nil {
+		return nil
+	}
+	cwe := hl7Utilities.NewCWE(r, v.delimiters, v.version)
+	concept := &CodeableConcept{Text: cwe.OriginalText}
+	if cwe.Identifier != "" || cwe.Text != "" {
+		concept.Coding = append(concept.Coding, &Coding{
+			System:  codingSystem(cwe.NameOfCodingSystem),
+			Version: cwe.CodingSystemVersionId,
+			Code:    cwe.Identifier,
+			Display: cwe.Text,
+		})
+	}
+	if cwe.AlternateIdentifier != "" || cwe.AlternateText != "" {
+		concept.Coding = append(concept.Coding, &Coding{
+			System:  codingSystem(cwe.NameOfAlternateCodingSystem),
+			Version: cwe.AlternateCodingSystemVersionId,
+			Code:    cwe.AlternateIdentifier,
+			Display: cwe.AlternateText,
+		})
+	}
+	if concept.Text == "" {
+		concept.Text = cwe.DisplayText()
+	}
+	if concept.Coding == nil && concept.Text == "" {
+		return nil
+	}
+	return concept
+}
+
+// contactPoint - converts a telephone number or email address, or returns nil when it's empty
+func (v *conversion) contactPoint(xtn hl7Utilities.XTN, defaultUse string) *ContactPoint {
+	contactPoint := &ContactPoint{System: "phone", Use: defaultUse}
+	switch xtn.TelecommunicationUseCode {
+	case "PRN", "ORN", "VHN":
+		contactPoint.Use = "home"
+	case "WPN":
+		contactPoint.Use = "work"
+	}
+	switch xtn.TelecommunicationEquipmentType {
+	case "Internet", "X.400":
+		contactPoint.System, contactPoint.Value = "email", xtn.EmailAddress
+	case "FX":
+		contactPoint.System = "fax"
+	case "CP":
+		contactPoint.Use = "mobile"
+	case "BP":
+		contactPoint.System = "pager"
+	}
+	if xtn.TelecommunicationUseCode == "NET" {
+		contactPoint.System, contactPoint.Value = "email", xtn.EmailAddress
+	}
+	if contactPoint.System != "email" {
+		countryCode := v.converter.DefaultCountryCode
+		if countryCode == "" {
+			countryCode = "1"
+		}
+		number, err := xtn.E164(countryCode)
+		if err != nil {
+			// not something we can make sense of, but it's still better than nothing
+			number = strings.TrimSpace(xtn.TelephoneNumber)
+		}
+		contactPoint.Value = number
+	}
+	if contactPoint.Value == "" {
+		return nil
+	}
+	return contactPoint
+}
+
+// ei - the first entity identifier in the field, or in the fallback field when the first is empty
+func (v *conversion) ei(field, fallback *hl7Utilities.Field) hl7Utilities.EI {
+	for _, f := range []*hl7Utilities.Field{field, fallback} {
+		if r := firstRepetition(f); r != nil {
+			return hl7Utilities.NewEI(r, v.delimiters, v.version)
+		}
+	}
+	return hl7Utilities.EI{}
+}
+
+// dtm - parses the first repetition of a time field, which is a TS before v2.6 and a DTM after,
+// giving a zero DTM when it's empty or can't be parsed
+func (v *conversion) dtm(field *hl7Utilities.Field) hl7Utilities.DTM {
+	r := firstRepetition(field)
+	if r == nil {
+		return hl7Utilities.DTM{}
+	}
+	dtm, err := v.converter.TimeZones.ParseDTM(v.timeZone, v.delimiters.Decode(r.Value()))
+	if err != nil {
+		return hl7Utilities.DTM{}
+	}
+	return dtm
+}
+
+// dateTime - a time field formatted as a FHIR dateTime, or empty when it's empty or can't be parsed
+func (v *conversion) dateTime(field *hl7Utilities.Field) string {
+	return v.dtm(field).RFC3339()
+}
+
+// formatDateTime - a DTM value formatted as a FHIR dateTime
+func (v *conversion) formatDateTime(value string) string {
+	dtm, err := v.converter.TimeZones.ParseDTM(v.timeZone, v.delimiters.Decode(value))
+	if err != nil {
+		return ""
+	}
+	return dtm.RFC3339()
+}
+
+// instant - a time field formatted as a FHIR instant, which needs a time as well as a date, or empty
+// when it's only a date
+func (v *conversion) instant(field *hl7Utilities.Field) string {
+	dtm := v.dtm(field)
+	if dtm.Precision < hl7Utilities.PrecisionHour {
+		return ""
+	}
+	return dtm.RFC3339()
+}
+
+// repetitions - the repetitions of the field that have something in them
+func repetitions(field *hl7Utilities.Field) []*hl7Utilities.Repetition {
+	if field == nil {
+		return nil
+	}
+	var valued []*hl7Utilities.Repetition
+	for _, r := range field.Repetitions {
+		for _, c := range r.Components {
+			if strings.Join(c.Subcomponents, "") != "" {
+				valued = append(valued, r)
+				break
+			}
+		}
+	}
+	return valued
+}
+
+// firstRepetition - the first repetition of the field with something in it, or nil
+func firstRepetition(field *hl7Utilities.Field) *hl7Utilities.Repetition {
+	if valued := repetitions(field); len(valued) > 0 {
+		return valued[0]
+	}
+	return nil
+}
+
+// humanName - converts a person's name, or returns nil when it's empty
+func humanName(xpn hl7Utilities.XPN) *HumanName {
+	name := &HumanName{Family: xpn.FamilyName}
+	for _, given := range []string{xpn.GivenName, xpn.SecondAndFurtherGivenNames} {
+		if given != "" {
+			name.Given = append(name.Given, given)
+		}
+	}
+	if xpn.Prefix != "" {
+		name.Prefix = []string{xpn.Prefix}
+	}
+	for _, suffix := range []string{xpn.Suffix, xpn.Degree, xpn.ProfessionalSuffix} {
+		if suffix != "" {
+			name.Suffix = append(name.Suffix, suffix)
+		}
+	}
+	switch xpn.NameTypeCode {
+	case "L":
+		name.Use = "official"
+	case "D":
+		name.Use = "usual"
+	case "M":
+		name.Use = "maiden"
+	case "N":
+		name.Use = "nickname"
+	}
+	name.Text = xpn.FullName()
+	if name.Family == "" && name.Given == nil {
+		return nil
+	}
+	return name
+}
+
+// address - converts an address, or returns nil when it's empty
+func address(xad hl7Utilities.XAD) *Address {
+	a := &Address{
+		City:       xad.City,
+		District:   xad.CountyParishCode,
+		State:      xad.StateOrProvince,
+		PostalCode: xad.ZipOrPostalCode,
+		Country:    xad.Country,
+	}
+	for _, line := range []string{xad.StreetAddress, xad.OtherDesignation} {
+		if line != "" {
+			a.Line = append(a.Line, line)
+		}
+	}
+	switch xad.AddressType {
+	case "H":
+		a.Use = "home"
+	case "B", "O":
+		a.Use = "work"
+	case "C":
+		a.Use = "temp"
+	}
+	if a.Line == nil && a.City == "" && a.State == "" && a.PostalCode == "" && a.Country == "" {
+		return nil
+	}
+	return a
+}
+
+// eiIdentifier - converts an order or specimen number into an identifier of the type
+func eiIdentifier(ei hl7Utilities.EI, typeCode, typeDisplay string) *Identifier {
+	return &Identifier{
+		Type:   v2Concept("0203", typeCode, typeDisplay),
+		System: hdSystem(hl7Utilities.HD{NamespaceId: ei.NamespaceId, UniversalId: ei.UniversalId, UniversalIdType: ei.UniversalIdType}),
+		Value:  ei.EntityIdentifier,
+	}
+}
+
+// hdSystem - the identifier system for an assigning authority. OIDs and UUIDs become URNs, CLIA
+// numbers use the CLIA OID, and anything else is left as the namespace ID
+func hdSystem(hd hl7Utilities.HD) string {
+	switch {
+	case hd.UniversalId != "" && hd.UniversalIdType == "ISO":
+		return "urn:oid:" + hd.UniversalId
+	case hd.UniversalId != "" && hd.UniversalIdType == "UUID":
+		return "urn:uuid:" + strings.ToLower(hd.UniversalId)
+	case hd.UniversalId != "" && hd.UniversalIdType == "CLIA":
+		return "urn:oid:2.16.840.1.113883.4.7"
+	case hd.UniversalId != "" && strings.Contains(hd.UniversalId, ":"):
+		return hd.UniversalId
+	}
+	return hd.NamespaceId
+}
+
+// codingSystem - the FHIR system for the name of an HL7 v2 coding system, or the name itself when we
+// don't know one, which is how local codes like L and 99ZZZ end up
+func codingSystem(name string) string {
+	if system, ok := codingSystems[name]; ok {
+		return system
+	}
+	if strings.HasPrefix(name, "HL7") && len(name) == 7 {
+		return systemV2Table + name[3:]
+	}
+	return name
+}
+
+// v2Concept - a code from an HL7 table
+func v2Concept(table, code, display string) *CodeableConcept {
+	return &CodeableConcept{Coding: []*Coding{{System: systemV2Table + table, Code: code, Display: display}}}
+}
+
+// observationStatus - the Observation status for OBX-11, from table 0085
+func observationStatus(code string) string {
+	switch code {
+	case "C":
+		return "corrected"
+	case "D", "W":
+		return "entered-in-error"
+	case "F", "U":
+		return "final"
+	case "I", "O":
+		return "registered"
+	case "P", "R", "S":
+		return "preliminary"
+	case "X":
+		return "cancelled"
+	case "A":
+		return "amended"
+	}
+	return "unknown"
+}
+
+// diagnosticReportStatus - the DiagnosticReport status for OBR-25, from table 0123
+func diagnosticReportStatus(code string) string {
+	switch code {
+	case "C":
+		return "corrected"
+	case "F":
+		return "final"
+	case "I", "O", "S":
+		return "registered"
+	case "P":
+		return "preliminary"
+	case "A", "R":
+		return "partial"
+	case "X":
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// decimal - the number the way FHIR writes decimals, keeping the digits it was sent with, like 5.0
+func decimal(value string) (json.Number, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "+")
+	if _, err := strconv.ParseFloat(value, 64); err != nil || strings.ContainsAny(value, "eEnNiI") {
+		return "", false
+	}
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+	if strings.HasPrefix(value, ".") {
+		value = "0" + value
+	}
+	value = strings.TrimSuffix(value, ".")
+	// JSON numbers can't have leading zeros
+	for len(value) > 1 && value[0] == '0' && value[1] != '.' {
+		value = value[1:]
+	}
+	if negative {
+		value = "-" + value
+	}
+	return json.Number(value), true
+}
+
+// joinKey - joins the parts of a key, with a separator that can't be confused with anything in them
+func joinKey(parts ...string) string {
+	return strings.Join(parts, "\x1f")
+}
@@ -0,0 +1,202 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+const labResult = `
+MSH|^~\&|Ketchup Clinic RD^2.16.840.1.113883.3.2.12.1^ISO|Ketchup Clinic DLMP^2.16.840.1.113883.3.2.12.1.1^ISO|251-CDC-PRIORITY|251-CDC-PRIORITY|20220802003337-0500||ORU^R01^ORU_R01|2022080205333719454131|P|2.5.1|||NE|NE|USA||||PHLabReport-NoAck^HL7^2.16.840.1.113883.9.11^ISO
+SFT|Lawson^L^^^^Ketchup RD&2.16.840.1.113883.3.2.12.1&ISO^XX^^^99999|19.1|Cloverleaf IE|9999||20101113
+PID|1||M177323145^^^Ketchup Clinic DLMP&2.16.840.1.113883.3.2.12.1.1&ISO^PI^MCLab-RO Main Campus&2.16.840.1.113883.3.2.12.1.2.1&ISO||LASTNAME^FIRSTNAME^MIDDLE|MAIDEN|19000101|M|ALIAS|2106-3^White^CDCREC|STREET1^STREET2^CITY^CA^90210^COUNTRY^^^COUNTY||^PRN^PH^^1^507^5551212|||||||||H^Hispanic or Latino^HL70189
+ORC|RE|B523004918^Placer Order Number^2.16.840.1.113883.3.2.12.1.99^ISO|H823018568^Filler Order Number^2.16.840.1.113883.3.2.12.1.1^ISO|||||||||NPI^HOWSER^DOUGLAS^^^^^^Eastman Medical Center&2.16.840.1.113883.3.2.12.1.99&ISO^L^^^PRN^Ketchup Clinic DLMP&2.16.840.1.113883.3.2.12.1.1&ISO^^^^^^^MD|7018377|^^^^^^|||||||Eastman Medical Center|1 Eastman Dr^^Beverly Hills^CA^90210|^WPN^PH^^1^555^5555555
+OBR|1|B523004918^Placer Order Number^2.16.840.1.113883.3.2.12.1.99^ISO|H823018568^Filler Order Number^2.16.840.1.113883.3.2.12.1.1^ISO|^^^MPXDX^Orthopoxvirus DNA, PCR, Swab^L^^U|||202207231050-0500|||7018377^Eastman Medical Center^9856465060|||||^^groin|||||||20220801145700-0500|||F
+OBX|1|CE|100434-0^Orthopoxvirus.non-variola DNA XXX Ql NAA+non-probe^LN^618596^Orthopoxvirus DNA, PCR^L^2.40^U||260415000^Undetected^SCT||Undetected||||F|||202207231050-0500
+NTE|1|L|Non-variola Orthopoxvirus DNA is not detected.
+OBX|2|NM|2345-7^Glucose^LN||05.50|mg/dL^mg/dL^UCUM|70-99|H|||C
+SPM|1|B523004918&Placer_LIS&2.16.840.1.113883.3.2.12.1.99&ISO^H823018568&Ketchup_LIS&2.16.840.113883.1.3.2.11.1&ISO||^^^groin^groin^L^^v1|||||||P^Patient^HL70369|1^{#}&Number&UCUM|||||20220723105000-0500|20220726152000-0500
+`
+
+func convert(t *testing.T, message string) *Bundle {
+	bundle, err := ConvertORU(hl7Utilities.Hl7Message{RawMessage: message})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+// resources - the resources in the bundle by their full URL
+func resources(bundle *Bundle) map[string]Resource {
+	found := make(map[string]Resource)
+	for _, entry := range bundle.Entry {
+		found[entry.FullUrl] = entry.Resource
+	}
+	return found
+}
+
+func TestConvertORU(t *testing.T) {
+	bundle := convert(t, labResult)
+	counts := make(map[string]int)
+	for _, entry := range bundle.Entry {
+		resourceType := entry.Resource.domainResource().ResourceType
+		counts[resourceType]++
+		if entry.Request.Url != resourceType+"/"+entry.Resource.domainResource().Id {
+			t.Logf("the %s entry is a PUT to %s", resourceType, entry.Request.Url)
+			t.Fail()
+		}
+	}
+	expectedCounts := map[string]int{
+		"Patient": 1, "Organization": 2, "Practitioner": 1, "PractitionerRole": 1,
+		"ServiceRequest": 1, "Specimen": 1, "Observation": 2, "DiagnosticReport": 1,
+	}
+	for resourceType, expected := range expectedCounts {
+		if counts[resourceType] != expected {
+			t.Logf("expected %d %s but got %d", expected, resourceType, counts[resourceType])
+			t.Fail()
+		}
+	}
+	// every reference has to be to something in the bundle
+	encoded, _ := bundle.JSON()
+	byUrl := resources(bundle)
+	for _, part := range strings.Split(string(encoded), `"reference": "`)[1:] {
+		reference := part[:strings.Index(part, `"`)]
+		if byUrl[reference] == nil {
+			t.Logf("%s isn't in the bundle", reference)
+			t.Fail()
+		}
+	}
+	if bundle.Type != "transaction" || bundle.Timestamp != "2022-08-02T00:33:37-05:00" {
+		t.Logf("got a %s bundle at %s", bundle.Type, bundle.Timestamp)
+		t.Fail()
+	}
+}
+
+func TestConvertORU_Resources(t *testing.T) {
+	bundle := convert(t, labResult)
+	var patient *Patient
+	var report *DiagnosticReport
+	var observations []*Observation
+	for _, entry := range bundle.Entry {
+		switch resource := entry.Resource.(type) {
+		case *Patient:
+			patient = resource
+		case *DiagnosticReport:
+			report = resource
+		case *Observation:
+			observations = append(observations, resource)
+		}
+	}
+	if patient == nil || report == nil || len(observations) != 2 {
+		t.Fatal("the bundle is missing resources")
+	}
+	if patient.Gender != "male" || patient.BirthDate != "1900-01-01" || patient.Name[0].Family != "LASTNAME" {
+		t.Logf("got patient %s, %s, born %s", patient.Name[0].Family, patient.Gender, patient.BirthDate)
+		t.Fail()
+	}
+	if identifier := patient.Identifier[0]; identifier.System != "urn:oid:2.16.840.1.113883.3.2.12.1.1" || identifier.Value != "M177323145" {
+		t.Logf("got patient identifier %s|%s", identifier.System, identifier.Value)
+		t.Fail()
+	}
+	if telecom := patient.Telecom[0]; telecom.Value != "+15075551212" || telecom.Use != "home" {
+		t.Logf("got telecom %s %s", telecom.Value, telecom.Use)
+		t.Fail()
+	}
+	if race := patient.Extension[0].Extension[0].ValueCoding; race.System != systemCdcRace || race.Code != "2106-3" {
+		t.Logf("got race %s|%s", race.System, race.Code)
+		t.Fail()
+	}
+	if ethnicity := patient.Extension[1].Extension[0].ValueCoding; ethnicity.Code != "2135-2" {
+		t.Logf("got ethnicity %s", ethnicity.Code)
+		t.Fail()
+	}
+	if report.Status != "final" || len(report.Result) != 2 || report.Issued != "2022-08-01T14:57:00-05:00" {
+		t.Logf("got a %s report with %d results issued %s", report.Status, len(report.Result), report.Issued)
+		t.Fail()
+	}
+	coded, numeric := observations[0], observations[1]
+	if coded.Status != "final" || coded.ValueCodeableConcept.Coding[0].System != systemSnomed ||
+		coded.Code.Coding[0].System != systemLoinc || len(coded.Note) != 1 {
+		t.Logf("got coded observation %+v", coded)
+		t.Fail()
+	}
+	quantity := numeric.ValueQuantity
+	if numeric.Status != "corrected" || quantity.Value != "5.50" || quantity.System != systemUcum || quantity.Code != "mg/dL" {
+		t.Logf("got numeric observation %s with %+v", numeric.Status, quantity)
+		t.Fail()
+	}
+	if numeric.Interpretation[0].Coding[0].Code != "H" || numeric.ReferenceRange[0].Text != "70-99" {
+		t.Log("the numeric observation should have its flag and range")
+		t.Fail()
+	}
+	// OBX-14 is empty, so it was observed when the order says
+	if numeric.EffectiveDateTime != "2022-07-23T10:50:00-05:00" {
+		t.Logf("got effective %s", numeric.EffectiveDateTime)
+		t.Fail()
+	}
+}
+
+func TestConvertORU_Deterministic(t *testing.T) {
+	first, _ := convert(t, labResult).JSON()
+	second, _ := convert(t, labResult).JSON()
+	if !bytes.Equal(first, second) {
+		t.Log("converting the same message twice should give the same JSON")
+		t.Fail()
+	}
+	// a correction is a different message about the same things, so everything but the bundle keeps
+	// its ID
+	correction := strings.Replace(labResult, "|2022080205333719454131|", "|2022080305333719454131|", 1)
+	original, corrected := resources(convert(t, labResult)), resources(convert(t, correction))
+	for url, resource := range original {
+		if corrected[url] == nil {
+			t.Logf("the %s is a new resource in the correction", resource.domainResource().ResourceType)
+			t.Fail()
+		}
+	}
+}
+
+func TestConvertORU_Values(t *testing.T) {
+	cases := []struct {
+		valueType, value, expected string
+	}{
+		{"SN", ">^100", `"valueQuantity":{"value":100,"comparator":">","unit":"mg/dL","system":"http://unitsofmeasure.org","code":"mg/dL"}`},
+		{"SN", "^1^:^128", `"valueString":"1:128"`},
+		{"NM", "-.5", `"valueQuantity":{"value":-0.5,`},
+		{"NM", "positive", `"valueString":"positive"`},
+		{"ST", "see note", `"valueString":"see note"`},
+		{"DT", "20220801", `"valueDateTime":"2022-08-01"`},
+		{"TM", "1432", `"valueTime":"14:32:00"`},
+	}
+	for _, c := range cases {
+		message := strings.Replace(labResult, "OBX|2|NM|2345-7^Glucose^LN||05.50|", "OBX|2|"+c.valueType+"|2345-7^Glucose^LN||"+c.value+"|", 1)
+		bundle := convert(t, message)
+		encoded := ""
+		for _, entry := range bundle.Entry {
+			if observation, ok := entry.Resource.(*Observation); ok && observation.Code.Coding[0].Code == "2345-7" {
+				var buffer bytes.Buffer
+				encoder := json.NewEncoder(&buffer)
+				encoder.SetEscapeHTML(false)
+				if err := encoder.Encode(observation); err != nil {
+					t.Fatal(err)
+				}
+				encoded = buffer.String()
+			}
+		}
+		if !strings.Contains(encoded, c.expected) {
+			t.Logf("%s %s: expected %s in %s", c.valueType, c.value, c.expected, encoded)
+			t.Fail()
+		}
+	}
+}
+
+func TestConvertORU_Unsupported(t *testing.T) {
+	message := strings.Replace(labResult, "ORU^R01^ORU_R01", "ADT^A01^ADT_A01", 1)
+	if _, err := ConvertORU(hl7Utilities.Hl7Message{RawMessage: message}); !errors.Is(err, ErrUnsupportedMessage) {
+		t.Log("expected ErrUnsupportedMessage but got", err)
+		t.Fail()
+	}
+}
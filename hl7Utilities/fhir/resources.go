@@ -0,0 +1,236 @@
+package fhir
+
+import "encoding/json"
+
+// the resources and data types below are the parts of FHIR R4 lab results need, with the JSON names
+// the specification uses. anything that's empty is left out of the JSON
+
+// Resource - one of the resources below, which all embed DomainResource
+type Resource interface {
+	domainResource() *DomainResource
+}
+
+// DomainResource - the type and ID every resource has, which come first in its JSON
+type DomainResource struct {
+	ResourceType string `json:"resourceType"`
+	Id           string `json:"id,omitempty"`
+}
+
+// domainResource - lets the embedding resources satisfy Resource
+func (r *DomainResource) domainResource() *DomainResource {
+	return r
+}
+
+// Bundle - a set of resources, which for us is a transaction to be stored all at once
+type Bundle struct {
+	DomainResource
+	Identifier *Identifier    `json:"identifier,omitempty"`
+	Type       string         `json:"type"`
+	Timestamp  string         `json:"timestamp,omitempty"`
+	Entry      []*BundleEntry `json:"entry,omitempty"`
+}
+
+// BundleEntry - a resource in a bundle, along with what a transaction should do with it
+type BundleEntry struct {
+	FullUrl  string              `json:"fullUrl,omitempty"`
+	Resource Resource            `json:"resource"`
+	Request  *BundleEntryRequest `json:"request,omitempty"`
+}
+
+// BundleEntryRequest - the HTTP method and URL a transaction uses for an entry
+type BundleEntryRequest struct {
+	Method string `json:"method"`
+	Url    string `json:"url"`
+}
+
+// Patient - the person the results are about, from PID
+type Patient struct {
+	DomainResource
+	Extension        []*Extension    `json:"extension,omitempty"`
+	Identifier       []*Identifier   `json:"identifier,omitempty"`
+	Name             []*HumanName    `json:"name,omitempty"`
+	Telecom          []*ContactPoint `json:"telecom,omitempty"`
+	Gender           string          `json:"gender,omitempty"`
+	BirthDate        string          `json:"birthDate,omitempty"`
+	DeceasedBoolean  *bool           `json:"deceasedBoolean,omitempty"`
+	DeceasedDateTime string          `json:"deceasedDateTime,omitempty"`
+	Address          []*Address      `json:"address,omitempty"`
+}
+
+// Organization - a facility, like the lab sending the results or the one that ordered the test
+type Organization struct {
+	DomainResource
+	Identifier []*Identifier   `json:"identifier,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	Telecom    []*ContactPoint `json:"telecom,omitempty"`
+	Address    []*Address      `json:"address,omitempty"`
+}
+
+// Practitioner - a person who ordered the test
+type Practitioner struct {
+	DomainResource
+	Identifier []*Identifier `json:"identifier,omitempty"`
+	Name       []*HumanName  `json:"name,omitempty"`
+	Address    []*Address    `json:"address,omitempty"`
+}
+
+// PractitionerRole - a practitioner ordering on behalf of an organization
+type PractitionerRole struct {
+	DomainResource
+	Practitioner *Reference `json:"practitioner,omitempty"`
+	Organization *Reference `json:"organization,omitempty"`
+}
+
+// ServiceRequest - the order for the test, from ORC and OBR
+type ServiceRequest struct {
+	DomainResource
+	Identifier []*Identifier    `json:"identifier,omitempty"`
+	Status     string           `json:"status"`
+	Intent     string           `json:"intent"`
+	Code       *CodeableConcept `json:"code,omitempty"`
+	Subject    *Reference       `json:"subject"`
+	AuthoredOn string           `json:"authoredOn,omitempty"`
+	Requester  *Reference       `json:"requester,omitempty"`
+	Specimen   []*Reference     `json:"specimen,omitempty"`
+}
+
+// Observation - a single result, from OBX
+type Observation struct {
+	DomainResource
+	Identifier           []*Identifier                `json:"identifier,omitempty"`
+	BasedOn              []*Reference                 `json:"basedOn,omitempty"`
+	Status               string                       `json:"status"`
+	Category             []*CodeableConcept           `json:"category,omitempty"`
+	Code                 *CodeableConcept             `json:"code"`
+	Subject              *Reference                   `json:"subject,omitempty"`
+	EffectiveDateTime    string                       `json:"effectiveDateTime,omitempty"`
+	Issued               string                       `json:"issued,omitempty"`
+	Performer            []*Reference                 `json:"performer,omitempty"`
+	ValueQuantity        *Quantity                    `json:"valueQuantity,omitempty"`
+	ValueCodeableConcept *CodeableConcept             `json:"valueCodeableConcept,omitempty"`
+	ValueString          string                       `json:"valueString,omitempty"`
+	ValueDateTime        string                       `json:"valueDateTime,omitempty"`
+	ValueTime            string                       `json:"valueTime,omitempty"`
+	Interpretation       []*CodeableConcept           `json:"interpretation,omitempty"`
+	Note                 []*Annotation                `json:"note,omitempty"`
+	Method               *CodeableConcept             `json:"method,omitempty"`
+	Specimen             *Reference                   `json:"specimen,omitempty"`
+	ReferenceRange       []*ObservationReferenceRange `json:"referenceRange,omitempty"`
+}
+
+// ObservationReferenceRange - the normal range for a result, which we only have as text
+type ObservationReferenceRange struct {
+	Text string `json:"text"`
+}
+
+// Specimen - the sample that was tested, from SPM
+type Specimen struct {
+	DomainResource
+	Identifier   []*Identifier       `json:"identifier,omitempty"`
+	Type         *CodeableConcept    `json:"type,omitempty"`
+	Subject      *Reference          `json:"subject,omitempty"`
+	ReceivedTime string              `json:"receivedTime,omitempty"`
+	Request      []*Reference        `json:"request,omitempty"`
+	Collection   *SpecimenCollection `json:"collection,omitempty"`
+}
+
+// SpecimenCollection - when and where the specimen was collected
+type SpecimenCollection struct {
+	CollectedDateTime string           `json:"collectedDateTime,omitempty"`
+	BodySite          *CodeableConcept `json:"bodySite,omitempty"`
+}
+
+// DiagnosticReport - the results of an order, grouping its observations
+type DiagnosticReport struct {
+	DomainResource
+	Identifier        []*Identifier      `json:"identifier,omitempty"`
+	BasedOn           []*Reference       `json:"basedOn,omitempty"`
+	Status            string             `json:"status"`
+	Category          []*CodeableConcept `json:"category,omitempty"`
+	Code              *CodeableConcept   `json:"code"`
+	Subject           *Reference         `json:"subject,omitempty"`
+	EffectiveDateTime string             `json:"effectiveDateTime,omitempty"`
+	Issued            string             `json:"issued,omitempty"`
+	Performer         []*Reference       `json:"performer,omitempty"`
+	Specimen          []*Reference       `json:"specimen,omitempty"`
+	Result            []*Reference       `json:"result,omitempty"`
+}
+
+// Identifier - an ID along with the system that assigned it
+type Identifier struct {
+	Use    string           `json:"use,omitempty"`
+	Type   *CodeableConcept `json:"type,omitempty"`
+	System string           `json:"system,omitempty"`
+	Value  string           `json:"value,omitempty"`
+}
+
+// HumanName - a person's name
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Prefix []string `json:"prefix,omitempty"`
+	Suffix []string `json:"suffix,omitempty"`
+}
+
+// Address - a postal address
+type Address struct {
+	Use        string   `json:"use,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+// ContactPoint - a phone number or email address
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+// CodeableConcept - a coded value, with the codes it was sent with and its text
+type CodeableConcept struct {
+	Coding []*Coding `json:"coding,omitempty"`
+	Text   string    `json:"text,omitempty"`
+}
+
+// Coding - a single code from a code system
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Version string `json:"version,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// Quantity - a measured amount. the value is kept as the number was sent, since FHIR decimals keep
+// their precision
+type Quantity struct {
+	Value      json.Number `json:"value,omitempty"`
+	Comparator string      `json:"comparator,omitempty"`
+	Unit       string      `json:"unit,omitempty"`
+	System     string      `json:"system,omitempty"`
+	Code       string      `json:"code,omitempty"`
+}
+
+// Reference - a reference to another resource, which within a transaction is its full URL
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+// Annotation - a comment, from the NTE segments following an OBX
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+// Extension - an extension, like the US Core race and ethnicity ones
+type Extension struct {
+	Url         string       `json:"url"`
+	Extension   []*Extension `json:"extension,omitempty"`
+	ValueCoding *Coding      `json:"valueCoding,omitempty"`
+	ValueString string       `json:"valueString,omitempty"`
+}
@@ -0,0 +1,155 @@
+package hl7Utilities
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the usage codes the standard gives fields
+const (
+	UsageRequired           = "R"
+	UsageOptional           = "O"
+	UsageConditional        = "C"
+	UsageBackwardCompatible = "B"
+	UsageNotSupported       = "X"
+)
+
+// FieldDefinition - what the standard says about one field of a segment
+type FieldDefinition struct {
+	Position int
+	Name     string
+	// DataType - like ST, NM or CWE. OBX-5 is "varies", since OBX-2 says what type it is
+	DataType string
+	// Usage - R, O, C, B or X
+	Usage string
+	// MaxRepetitions - how many times the field can repeat, zero meaning as often as you like
+	MaxRepetitions int
+	// MaxLength - the longest each repetition can be, zero meaning there's no limit
+	MaxLength int
+	// Table - the HL7 table the values come from, like 0001, or empty if there isn't one
+	Table string
+}
+
+// Required - true when the field has to be valued
+func (f *FieldDefinition) Required() bool {
+	return f.Usage == UsageRequired
+}
+
+// SegmentDefinition - the fields of a segment in a version of the standard
+type SegmentDefinition struct {
+	Name    string
+	Version string
+	// Fields - the definitions in position order. positions the standard reserves are left out
+	Fields []*FieldDefinition
+}
+
+// Field - the definition of the field at the HL7 position, or nil if the segment doesn't define one
+func (d *SegmentDefinition) Field(position int) *FieldDefinition {
+	for _, f := range d.Fields {
+		if f.Position == position {
+			return f
+		}
+	}
+	return nil
+}
+
+// ParseSegmentDefinition - reads the fields of a segment from the tab separated layout the bundled
+// definitions use, one field per line:
+//
+//	position	type	usage	repetitions	length	table	name
+//	3	CX	R	*	250	-	Patient Identifier List
+//
+// with * for fields that can repeat without limit and - for no length or table. lines starting with
+// # are comments
+func ParseSegmentDefinition(name, version, definition string) (*SegmentDefinition, error) {
+	segment := &SegmentDefinition{Name: name, Version: version}
+	for i, line := range strings.Split(definition, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		field, err := parseFieldDefinition(line)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the %s %s definition, line %d: %w", name, version, i+1, err)
+		}
+		if last := len(segment.Fields); last > 0 && segment.Fields[last-1].Position >= field.Position {
+			return nil, fmt.Errorf("unable to parse the %s %s definition, line %d: fields are out of order", name, version, i+1)
+		}
+		segment.Fields = append(segment.Fields, field)
+	}
+	return segment, nil
+}
+
+// parseFieldDefinition - reads a single line of a segment definition
+func parseFieldDefinition(line string) (*FieldDefinition, error) {
+	parts := strings.Split(line, "\t")
+	if len(parts) != 7 {
+		return nil, fmt.Errorf("expected 7 columns but got %d", len(parts))
+	}
+	position, err := strconv.Atoi(parts[0])
+	if err != nil || position < 1 {
+		return nil, fmt.Errorf("'%s' is not a field position", parts[0])
+	}
+	field := &FieldDefinition{Position: position, DataType: parts[1], Usage: parts[2], Name: parts[6]}
+	switch field.Usage {
+	case UsageRequired, UsageOptional, UsageConditional, UsageBackwardCompatible, UsageNotSupported:
+	default:
+		return nil, fmt.Errorf("'%s' is not a usage code", field.Usage)
+	}
+	if parts[3] != "*" {
+		if field.MaxRepetitions, err = strconv.Atoi(parts[3]); err != nil || field.MaxRepetitions < 1 {
+			return nil, fmt.Errorf("'%s' is not a number of repetitions", parts[3])
+		}
+	}
+	if parts[4] != "-" {
+		if field.MaxLength, err = strconv.Atoi(parts[4]); err != nil || field.MaxLength < 1 {
+			return nil, fmt.Errorf("'%s' is not a length", parts[4])
+		}
+	}
+	if parts[5] != "-" {
+		field.Table = parts[5]
+	}
+	return field, nil
+}
+
+// fieldFiles - the segment definitions we ship with, one file per segment under a directory for each
+// version, like fields/2.5.1/PID.txt. they cover the segments the structures we ship with use most,
+// and versions we don't have fall back the same way structures do
+//
+//go:embed fields
+var fieldFiles embed.FS
+
+// segmentDefinitionCache - definitions we've already parsed, keyed by name and version
+var segmentDefinitionCache = struct {
+	sync.Mutex
+	segments map[string]*SegmentDefinition
+}{segments: make(map[string]*SegmentDefinition)}
+
+// LookupSegmentDefinition - returns the definition of a segment like PID for a version like 2.5.1,
+// picking the version the same way [LookupStructure] does
+func LookupSegmentDefinition(segmentName, version string) (*SegmentDefinition, error) {
+	selected, err := nearestVersion(fieldFiles, "fields", segmentName+".txt", version)
+	if err != nil {
+		return nil, fmt.Errorf("no segment definition for %s", segmentName)
+	}
+	key := segmentName + "/" + selected
+	segmentDefinitionCache.Lock()
+	defer segmentDefinitionCache.Unlock()
+	if segment, ok := segmentDefinitionCache.segments[key]; ok {
+		return segment, nil
+	}
+	definition, err := fieldFiles.ReadFile(path.Join("fields", selected, segmentName+".txt"))
+	if err != nil {
+		return nil, err
+	}
+	segment, err := ParseSegmentDefinition(segmentName, selected, string(definition))
+	if err != nil {
+		return nil, err
+	}
+	segmentDefinitionCache.segments[key] = segment
+	return segment, nil
+}
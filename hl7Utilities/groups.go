@@ -0,0 +1,325 @@
+package hl7Utilities
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MessageGroup - one occurrence of a group from a message structure, like a single
+// ORDER_OBSERVATION, holding the segments and nested groups that belong to it in message order.
+// the message itself is the outermost group, named after its structure
+type MessageGroup struct {
+	Name     string
+	Children []*GroupChild
+}
+
+// GroupChild - an entry in a group, which is either a segment or a nested group
+type GroupChild struct {
+	Segment *ParsedSegment
+	Group   *MessageGroup
+}
+
+// Group - returns an occurrence of a nested group, counting from 0, or nil if there isn't one
+func (g *MessageGroup) Group(name string, repetition int) *MessageGroup {
+	groups := g.GroupsNamed(name)
+	if repetition < 0 || repetition >= len(groups) {
+		return nil
+	}
+	return groups[repetition]
+}
+
+// GroupsNamed - returns every occurrence of a nested group, in message order
+func (g *MessageGroup) GroupsNamed(name string) []*MessageGroup {
+	var groups []*MessageGroup
+	if g == nil {
+		return groups
+	}
+	for _, c := range g.Children {
+		if c.Group != nil && c.Group.Name == name {
+			groups = append(groups, c.Group)
+		}
+	}
+	return groups
+}
+
+// Segment - returns an occurrence of a segment directly inside this group, counting from 0, or nil
+// if there isn't one
+func (g *MessageGroup) Segment(name string, repetition int) *ParsedSegment {
+	segments := g.SegmentsNamed(name)
+	if repetition < 0 || repetition >= len(segments) {
+		return nil
+	}
+	return segments[repetition]
+}
+
+// SegmentsNamed - returns every segment with the name directly inside this group, in message order
+func (g *MessageGroup) SegmentsNamed(name string) []*ParsedSegment {
+	var segments []*ParsedSegment
+	if g == nil {
+		return segments
+	}
+	for _, c := range g.Children {
+		if c.Segment != nil && c.Segment.Name == name {
+			segments = append(segments, c.Segment)
+		}
+	}
+	return segments
+}
+
+// AllSegmentsNamed - returns every segment with the name in this group or any group nested in it
+func (g *MessageGroup) AllSegmentsNamed(name string) []*ParsedSegment {
+	var segments []*ParsedSegment
+	if g == nil {
+		return segments
+	}
+	for _, c := range g.Children {
+		if c.Segment != nil && c.Segment.Name == name {
+			segments = append(segments, c.Segment)
+		}
+		if c.Group != nil {
+			segments = append(segments, c.Group.AllSegmentsNamed(name)...)
+		}
+	}
+	return segments
+}
+
+// groupFrame - where we are in one level of the structure while matching segments to it
+type groupFrame struct {
+	element  *StructureElement
+	instance *MessageGroup
+	// index - the child element we last matched a segment or group to
+	index int
+	// used - whether anything has been matched to the element at index yet
+	used bool
+}
+
+// StructureIssue - a segment that doesn't fit where it appears in the message structure
+type StructureIssue struct {
+	Segment *ParsedSegment
+	// Position - where the segment is in the message, counting from 0
+	Position    int
+	Description string
+}
+
+// Groups - arranges the message's segments into the groups of the structure. segments are matched in
+// order, opening and closing groups as we go the same way HAPI does, so the OBX segments following
+// an OBR end up in that OBR's ORDER_OBSERVATION group. segments that don't fit anywhere in the
+// structure, like Z segments, are kept in whichever group we were in when we found them
+func (m *ParsedMessage) Groups(structure *MessageStructure) *MessageGroup {
+	root, _ := m.arrange(structure)
+	return root
+}
+
+// MessageGroups - arranges the message into the groups of the structure picked by MSH-9 and MSH-12
+func (m *ParsedMessage) MessageGroups() (*MessageGroup, error) {
+	structure, err := m.Structure()
+	if err != nil {
+		return nil, err
+	}
+	return m.Groups(structure), nil
+}
+
+// StructureIssues - reports the segments that are out of order, or aren't part of the structure at
+// all. Z segments are site defined and allowed anywhere, so they never count
+func (m *ParsedMessage) StructureIssues(structure *MessageStructure) []StructureIssue {
+	_, issues := m.arrange(structure)
+	return issues
+}
+
+// arrange - does the work for Groups and StructureIssues
+func (m *ParsedMessage) arrange(structure *MessageStructure) (*MessageGroup, []StructureIssue) {
+	var issues []StructureIssue
+	root := &MessageGroup{Name: structure.Name}
+	rootElement := &StructureElement{Name: structure.Name, Required: true, Children: structure.Elements}
+	stack := []*groupFrame{{element: rootElement, instance: root, index: 0}}
+	for i, segment := range m.Segments {
+		if placed := placeSegment(&stack, segment); placed {
+			continue
+		}
+		top := stack[len(stack)-1]
+		top.instance.Children = append(top.instance.Children, &GroupChild{Segment: segment})
+		if strings.HasPrefix(segment.Name, "Z") {
+			continue
+		}
+		description := fmt.Sprintf("%s is not part of the %s %s structure", segment.Name, structure.Name, structure.Version)
+		if structureContains(structure.Elements, segment.Name) {
+			description = fmt.Sprintf("%s is out of order for the %s %s structure", segment.Name, structure.Name, structure.Version)
+		}
+		issues = append(issues, StructureIssue{Segment: segment, Position: i, Description: description})
+	}
+	return root, issues
+}
+
+// structureContains - true when the segment appears anywhere in the elements or their groups
+func structureContains(elements []*StructureElement, segmentName string) bool {
+	for _, e := range elements {
+		if (!e.IsGroup() && e.Name == segmentName) || (e.IsGroup() && structureContains(e.Children, segmentName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeSegment - looks for the next place in the structure the segment can go, starting where we
+// are now and working outward through the enclosing groups
+func placeSegment(stack *[]*groupFrame, segment *ParsedSegment) bool {
+	for depth := len(*stack) - 1; depth >= 0; depth-- {
+		frame := (*stack)[depth]
+		for i := frame.index; i < len(frame.element.Children); i++ {
+			child := frame.element.Children[i]
+			if i == frame.index && frame.used && !child.Repeating {
+				// we've already filled this one
+				continue
+			}
+			if !child.IsGroup() && child.Name == segment.Name {
+				*stack = (*stack)[:depth+1]
+				frame.index, frame.used = i, true
+				frame.instance.Children = append(frame.instance.Children, &GroupChild{Segment: segment})
+				return true
+			}
+			if child.IsGroup() && groupStartsWith(child, segment.Name) {
+				*stack = (*stack)[:depth+1]
+				frame.index, frame.used = i, true
+				instance := &MessageGroup{Name: child.Name}
+				frame.instance.Children = append(frame.instance.Children, &GroupChild{Group: instance})
+				*stack = append(*stack, &groupFrame{element: child, instance: instance})
+				// the new group is on top of the stack now, so this can't fail
+				return placeSegment(stack, segment)
+			}
+		}
+	}
+	return false
+}
+
+// groupStartsWith - true when a new occurrence of the group can begin with the segment, meaning
+// it's the first segment in the group or only has optional elements in front of it
+func groupStartsWith(group *StructureElement, segmentName string) bool {
+	for _, child := range group.Children {
+		if !child.IsGroup() && child.Name == segmentName {
+			return true
+		}
+		if child.IsGroup() && groupStartsWith(child, segmentName) {
+			return true
+		}
+		if child.Required {
+			return false
+		}
+	}
+	return false
+}
+
+// groupPathPartPattern - a group in a terser path, like ORDER_OBSERVATION or OBSERVATION(2)
+var groupPathPartPattern = regexp.MustCompile(`^([A-Z0-9_]+)(\(([0-9]+)\))?$`)
+
+// segmentPathPartPattern - the segment at the end of a terser path, like OBX-5-2 or NTE(1)-3. a
+// leading dot means search every group below, not just the one the path has led to
+var segmentPathPartPattern = regexp.MustCompile(`^(\.)?([A-Z][A-Z0-9]{2})(\(([0-9]+)\))?(-.*)$`)
+
+// groupPath - a terser path like /PATIENT_RESULT(0)/ORDER_OBSERVATION(1)/OBX-5 broken into the groups
+// it goes through and the segment it ends at
+type groupPath struct {
+	groups []groupPathStep
+	// search - the segment can be in any group below the last one, for a path like /.OBX-5
+	search     bool
+	segment    string
+	repetition int
+	terserSpec TerserSpecification
+}
+
+// groupPathStep - a group along a group path, and which of its repetitions
+type groupPathStep struct {
+	name       string
+	repetition int
+}
+
+// parseGroupPath - reads a group path without following it, so a path can be checked before
+// there's a message to follow it through
+func parseGroupPath(path string) (groupPath, error) {
+	var parsed groupPath
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for _, part := range parts[:len(parts)-1] {
+		matches := groupPathPartPattern.FindStringSubmatch(part)
+		if matches == nil {
+			return groupPath{}, fmt.Errorf("%w: unable to parse '%s' in %s", ErrInvalidSpecification, part, path)
+		}
+		step := groupPathStep{name: matches[1]}
+		if matches[3] != "" {
+			step.repetition, _ = strconv.Atoi(matches[3])
+		}
+		parsed.groups = append(parsed.groups, step)
+	}
+	matches := segmentPathPartPattern.FindStringSubmatch(parts[len(parts)-1])
+	if matches == nil {
+		return groupPath{}, fmt.Errorf("%w: unable to parse the segment in %s", ErrInvalidSpecification, path)
+	}
+	parsed.search = matches[1] == "."
+	parsed.segment = matches[2]
+	if matches[4] != "" {
+		parsed.repetition, _ = strconv.Atoi(matches[4])
+	}
+	terserSpec, err := parseTerserSpecification(parsed.segment + matches[5])
+	if err != nil {
+		return groupPath{}, err
+	}
+	parsed.terserSpec = terserSpec
+	return parsed, nil
+}
+
+// findGroupPathSegment - follows a group path like /PATIENT_RESULT(0)/ORDER_OBSERVATION(1)/OBX-5 down
+// to the segment it names, returning the segment and the field specification that's left over.
+// repetitions count from 0 for groups and segments alike, the same as HAPI
+func findGroupPathSegment(root *MessageGroup, path string) (*ParsedSegment, TerserSpecification, error) {
+	parsed, err := parseGroupPath(path)
+	if err != nil {
+		return nil, TerserSpecification{}, err
+	}
+	group := root
+	for _, step := range parsed.groups {
+		next := group.Group(step.name, step.repetition)
+		if next == nil {
+			return nil, TerserSpecification{}, fmt.Errorf(
+				"%w: %s has no %s(%d) group in %s",
+				ErrSegmentNotFound,
+				group.Name,
+				step.name,
+				step.repetition,
+				path,
+			)
+		}
+		group = next
+	}
+	var segments []*ParsedSegment
+	if parsed.search {
+		segments = group.AllSegmentsNamed(parsed.segment)
+	} else {
+		segments = group.SegmentsNamed(parsed.segment)
+	}
+	if parsed.repetition >= len(segments) {
+		return nil, TerserSpecification{}, fmt.Errorf(
+			"%w: %s has no %s(%d) segment in %s",
+			ErrSegmentNotFound,
+			group.Name,
+			parsed.segment,
+			parsed.repetition,
+			path,
+		)
+	}
+	return segments[parsed.repetition], parsed.terserSpec, nil
+}
+
+// Structure - the structure definition for this message, picked using MSH-9 and MSH-12
+func (m *ParsedMessage) Structure() (*MessageStructure, error) {
+	msh := m.Segment("MSH", 0)
+	if msh == nil {
+		return nil, fmt.Errorf("%w: HL7 message does not start with MSH", ErrInvalidMessage)
+	}
+	messageType := msh.Field(9).Repetition(0)
+	structureName := StructureName(
+		messageType.Component(1).Value(),
+		messageType.Component(2).Value(),
+		messageType.Component(3).Value(),
+	)
+	return LookupStructure(structureName, msh.Field(12).Repetition(0).Component(1).Value())
+}
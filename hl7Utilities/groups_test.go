@@ -0,0 +1,150 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// multiOrderHl7Message - two orders with their own observations, where the OBX set IDs start over
+// for each OBR, and a specimen with its own OBX
+const multiOrderHl7Message = "MSH|^~\\&|LAB|FAC|||20220802003337-0500||ORU^R01^ORU_R01|1|P|2.5.1\r" +
+	"SFT|Lawson|19.1\r" +
+	"PID|1||M1||LASTNAME^FIRSTNAME\r" +
+	"NTE|1||patient note\r" +
+	"ORC|RE|P1|F1\r" +
+	"OBR|1|P1|F1|TEST1\r" +
+	"OBX|1|CE|A^First^LN||POS^Positive^L\r" +
+	"NTE|1||first observation note\r" +
+	"OBX|2|NM|B^Second^LN||42\r" +
+	"SPM|1|S1||SWAB\r" +
+	"OBX|1|NM|AGE^Age^LN||30\r" +
+	"ORC|RE|P2|F2\r" +
+	"OBR|2|P2|F2|TEST2\r" +
+	"OBX|1|CE|C^Third^LN||NEG^Negative^L\r" +
+	"ZZZ|custom\r" +
+	"OBX|2|ST|D^Fourth^LN||done\r"
+
+func TestParsedMessage_Groups(t *testing.T) {
+	parsed, err := ParseMessage(multiOrderHl7Message)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	structure, err := parsed.Structure()
+	if err != nil {
+		t.Fatalf("Structure() error = %v", err)
+	}
+	root := parsed.Groups(structure)
+	if root.Name != "ORU_R01" {
+		t.Errorf("root group = %s, want ORU_R01", root.Name)
+	}
+	patientResult := root.Group("PATIENT_RESULT", 0)
+	if got := len(root.GroupsNamed("PATIENT_RESULT")); got != 1 {
+		t.Errorf("PATIENT_RESULT count = %d, want 1", got)
+	}
+	if got := patientResult.Group("PATIENT", 0).Segment("NTE", 0).Field(3).Value(); got != "patient note" {
+		t.Errorf("PATIENT NTE = %s", got)
+	}
+	orders := patientResult.GroupsNamed("ORDER_OBSERVATION")
+	if len(orders) != 2 {
+		t.Fatalf("ORDER_OBSERVATION count = %d, want 2", len(orders))
+	}
+	tests := []struct {
+		name  string
+		group *MessageGroup
+		want  []string
+	}{
+		{"first order", orders[0], []string{"ORC", "OBR", "OBSERVATION", "OBSERVATION", "SPECIMEN"}},
+		{"second order", orders[1], []string{"ORC", "OBR", "OBSERVATION", "OBSERVATION"}},
+		{"first observation", orders[0].Group("OBSERVATION", 0), []string{"OBX", "NTE"}},
+		{"specimen", orders[0].Group("SPECIMEN", 0), []string{"SPM", "OBX"}},
+		// a Z segment stays in whatever group we were in
+		{"observation with Z segment", orders[1].Group("OBSERVATION", 0), []string{"OBX", "ZZZ"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range tt.group.Children {
+				if c.Segment != nil {
+					got = append(got, c.Segment.Name)
+				} else {
+					got = append(got, c.Group.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("children = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHl7Message_GetGroupPath(t *testing.T) {
+	hl7Message := Hl7Message{RawMessage: multiOrderHl7Message}
+	tests := []struct {
+		spec      string
+		want      string
+		wantError error
+	}{
+		{"/MSH-10", "1", nil},
+		{"/PATIENT_RESULT/PATIENT/PID-5-2", "FIRSTNAME", nil},
+		{"/PATIENT_RESULT(0)/ORDER_OBSERVATION(0)/OBSERVATION(1)/OBX-3-2", "Second", nil},
+		{"/PATIENT_RESULT(0)/ORDER_OBSERVATION(1)/OBSERVATION(1)/OBX-5", "done", nil},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION(1)/OBSERVATION/OBX-5-2", "Negative", nil},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION/OBSERVATION/NTE-3", "first observation note", nil},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION/SPECIMEN/OBX-5", "30", nil},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION(1)/OBR-4", "TEST2", nil},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION(1)/.OBX(1)-3-1", "D", nil},
+		{"/.OBX(2)-3-1", "AGE", nil},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION(2)/OBR-4", "", ErrSegmentNotFound},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION/OBSERVATION(5)/OBX-5", "", ErrSegmentNotFound},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION/OBR-99", "", ErrFieldOutOfRange},
+		{"/PATIENT_RESULT/order_observation/OBR-4", "", ErrInvalidSpecification},
+		{"/PATIENT_RESULT/ORDER_OBSERVATION/OBR", "", ErrInvalidSpecification},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := hl7Message.Get(tt.spec)
+			if !errors.Is(err, tt.wantError) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantError)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("Get() = '%s', want '%s'", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHl7Message_GetSegmentWithoutSetId(t *testing.T) {
+	// ORC doesn't have a set ID, so the repeat is its position instead
+	value, err := Hl7Message{RawMessage: multiOrderHl7Message}.Get("ORC(2)-2")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if *value != "P2" {
+		t.Errorf("Get() = '%s', want 'P2'", *value)
+	}
+}
+
+func TestParseStructureDefinition(t *testing.T) {
+	structure, err := ParseStructureDefinition("TST_T01", "2.5.1", "MSH [{SFT}] (PATIENT: PID [PV1]) {ORDER: OBR}")
+	if err != nil {
+		t.Fatalf("ParseStructureDefinition() error = %v", err)
+	}
+	want := []*StructureElement{
+		{Name: "MSH", Required: true},
+		{Name: "SFT", Repeating: true},
+		{Name: "PATIENT", Required: true, Children: []*StructureElement{
+			{Name: "PID", Required: true},
+			{Name: "PV1"},
+		}},
+		{Name: "ORDER", Required: true, Repeating: true, Children: []*StructureElement{{Name: "OBR", Required: true}}},
+	}
+	if !reflect.DeepEqual(structure.Elements, want) {
+		t.Errorf("ParseStructureDefinition() = %v, want %v", structure.Elements, want)
+	}
+	for _, definition := range []string{"MSH [SFT", "MSH SFT]", "MSH [GROUP: ]", "MSH pid", "MSH [SFT PID]"} {
+		if _, err := ParseStructureDefinition("TST_T01", "2.5.1", definition); err == nil {
+			t.Errorf("ParseStructureDefinition(%s) should fail", definition)
+		}
+	}
+}
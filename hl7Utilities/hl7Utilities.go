@@ -1,23 +1,22 @@
 package hl7Utilities
 
 import (
-	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
-type Segment interface {
-	MSH | SFT
-	New(rawSegment string)
-}
-
 type Terser interface {
 	Get(specification string) (*string, error)
+	Set(specification string, value string) error
 	MessageSegments() []string
-	Preprocess() MSH
+	Preprocess() (MSH, error)
 }
 
+var _ Terser = (*Hl7Message)(nil)
+
 type FieldIndex struct {
 	Index  int64
 	Repeat int64
@@ -37,9 +36,6 @@ type MSH struct {
 	MessageParts       []string
 }
 
-type SFT struct {
-}
-
 type Hl7Message struct {
 	RawMessage         string
 	version            string
@@ -56,11 +52,14 @@ func (message Hl7Message) Preprocess() (MSH, error) {
 	// we need to look at the MSH message because that tells us what the encoding characters are
 	// and what the field separator are
 	msh := segments[0]
-	if msh[0:3] != "MSH" {
-		return MSH{}, errors.New(fmt.Sprintf("HL7 message does not start with MSH"))
+	if !strings.HasPrefix(msh, "MSH") {
+		return MSH{}, fmt.Errorf("%w: HL7 message does not start with MSH", ErrInvalidMessage)
 	}
 	// remove the `MSH` value from the front
 	msh = msh[3:]
+	if len(msh) == 0 {
+		return MSH{}, fmt.Errorf("%w: MSH segment has no field separator", ErrInvalidMessage)
+	}
 	// remove the separator, which defaults to "|" but could be ANYTHING really
 	separator := msh[0:1]
 	// split the value by the separator now
@@ -70,9 +69,14 @@ func (message Hl7Message) Preprocess() (MSH, error) {
 	mshParts = append([]string{""}, mshParts...)
 	// get the encoding characters, typically `^~\&`
 	encodingCharacters := mshParts[2]
+	if len(encodingCharacters) == 0 {
+		return MSH{}, fmt.Errorf("%w: MSH segment has no encoding characters", ErrInvalidMessage)
+	}
 	// get the first subfield separator
 	subfieldSeparator := encodingCharacters[0:1]
-	messageEvent := mshParts[9]
+	// a truncated MSH still tells us the delimiters, so leave the event and version empty rather
+	// than failing outright
+	messageEvent := mshField(mshParts, 9)
 	if strings.Contains(messageEvent, subfieldSeparator) {
 		eventParts := strings.Split(messageEvent, subfieldSeparator)
 		switch len(eventParts) {
@@ -81,55 +85,106 @@ func (message Hl7Message) Preprocess() (MSH, error) {
 		case 2:
 			messageEvent = fmt.Sprintf("%s_%s", eventParts[0], eventParts[1])
 		default:
-			return MSH{}, errors.New(fmt.Sprintf("unable to determine event type from %s", messageEvent))
+			return MSH{}, fmt.Errorf("%w: unable to determine event type from %s", ErrInvalidMessage, messageEvent)
 		}
 	}
-	version := mshParts[12]
+	version := mshField(mshParts, 12)
 	// return our MSH object
 	return MSH{encodingCharacters, separator, version, messageEvent, mshParts}, nil
 }
 
+// mshField - returns the MSH field at the position, or an empty string if the MSH is too short
+func mshField(mshParts []string, position int) string {
+	if position >= len(mshParts) {
+		return ""
+	}
+	return mshParts[position]
+}
+
+// Delimiters - the delimiters this message declares in its MSH header
+func (message Hl7Message) Delimiters() (Delimiters, error) {
+	msh, err := message.Preprocess()
+	if err != nil {
+		return Delimiters{}, err
+	}
+	return msh.Delimiters()
+}
+
+// Delimiters - the delimiters declared by MSH-1 and MSH-2
+func (msh MSH) Delimiters() (Delimiters, error) {
+	return NewDelimiters(msh.FieldSeparator, msh.EncodingCharacters)
+}
+
 // MessageSegments - return the raw message split by our delimiter
 func (message Hl7Message) MessageSegments() []string {
-	// trim off the spaces
-	hl7Message := strings.TrimSpace(message.RawMessage)
+	// trim off the spaces in front and the line breaks at the end. trailing spaces are left alone
+	// since they can be part of the last value in the message
+	hl7Message := strings.TrimRight(strings.TrimLeftFunc(message.RawMessage, unicode.IsSpace), "\r\n")
 	// replace any \r with \n because the HL7 spec requires \r as the delimiter
 	hl7Message = strings.ReplaceAll(hl7Message, "\r", "\n")
 	// split the string
 	return strings.Split(hl7Message, "\n")
 }
 
-// Get - implement the interface
+// Get - implement the interface. primitive values have their escape sequences decoded, so
+// `Smith\T\Jones` comes back as `Smith&Jones`. values that still contain delimiters, like a whole
+// field with components, are returned as-is since decoding them would lose their structure.
+//
+// Get tells "empty but present" apart from "not present": a value that's in the message but empty,
+// like the `||` in `PID|1||ID`, comes back as a pointer to an empty string with no error, while a
+// segment or position the message doesn't have returns nil and an error wrapping
+// ErrSegmentNotFound or ErrFieldOutOfRange. the HL7 null value `""` is present, and is returned as-is
 func (message Hl7Message) Get(specification string) (*string, error) {
+	return message.get(specification, true)
+}
+
+// GetRaw - same as Get, but returns the value exactly as it appears in the message
+func (message Hl7Message) GetRaw(specification string) (*string, error) {
+	return message.get(specification, false)
+}
+
+// get - does the actual work of looking up the value for a specification
+func (message Hl7Message) get(specification string, decode bool) (*string, error) {
 	// do some sanity-checking on the specification
 	if len(specification) == 0 {
-		return nil, errors.New("invalid specification passed in")
-	}
-	if len(specification) == 0 && specification != "." {
-		return nil, errors.New(fmt.Sprintf("invalid specification passed in: %s", specification))
+		return nil, fmt.Errorf("%w: empty specification", ErrInvalidSpecification)
 	}
 	// return the whole message
 	if specification == "." {
 		return &message.RawMessage, nil
 	}
+	// group paths need the whole message arranged into its structure
+	if strings.HasPrefix(specification, "/") {
+		parsed, err := message.Parse()
+		if err != nil {
+			return nil, err
+		}
+		return parsed.get(specification, decode)
+	}
 	// split the message into its segments
 	segments := message.MessageSegments()
 	// we need to look at the MSH message because that tells us what the encoding characters are
 	// and what the field separator are
 	msh, err := message.Preprocess()
 	if err != nil {
-		return nil, errors.Unwrap(err)
+		return nil, err
 	}
 	// set the encoding characters for the message
 	message.encodingCharacters = msh.EncodingCharacters
 	message.messageEvent = msh.MessageEvent
 	message.version = msh.Version
-	// split our encoding characters into a slice so we can use each one
-	encodingChars := strings.Split(msh.EncodingCharacters, "")
+	// every level of the message gets split by the delimiters declared in MSH-1 and MSH-2
+	delimiters, err := msh.Delimiters()
+	if err != nil {
+		return nil, err
+	}
 	// parse our specification
 	terserSpec, err := parseTerserSpecification(specification)
 	if err != nil {
-		return nil, errors.Unwrap(err)
+		return nil, err
+	}
+	if len(terserSpec.FieldIndices) > 3 {
+		return nil, fmt.Errorf("%w: %s is nested too deeply", ErrInvalidSpecification, specification)
 	}
 	// we need to find our segment. this is a hack to replace the segment with the MSH one we preprocessed
 	// versus the one we match by segment name (OBR, ORC, etc)
@@ -139,57 +194,107 @@ func (message Hl7Message) Get(specification string) (*string, error) {
 		targetSegment = msh.MessageParts
 	} else {
 		// find our matching segment
-		matchingSegment, err := findSegment(segments, terserSpec.Segment, terserSpec.SetId, msh.FieldSeparator)
+		matchingSegment, err := findSegment(segments, terserSpec.Segment, terserSpec.SetId, delimiters.Field)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		targetSegment = strings.Split((matchingSegment)[3:], msh.FieldSeparator)
+		targetSegment = strings.Split((matchingSegment)[len(terserSpec.Segment):], delimiters.Field)
 	}
 	// load the first value
 	fieldIndex := terserSpec.FieldIndices[0]
+	if fieldIndex.Index >= int64(len(targetSegment)) {
+		return nil, fmt.Errorf(
+			"%w: %s only has %d fields, %s asked for field %d",
+			ErrFieldOutOfRange,
+			terserSpec.Segment,
+			len(targetSegment)-1,
+			specification,
+			fieldIndex.Index,
+		)
+	}
 	value := targetSegment[fieldIndex.Index]
-	// handle repetition
-	if fieldIndex.Repeat != 0 {
-		repeatedFields := strings.Split(value, "~")
-		if int64(len(repeatedFields)) >= fieldIndex.Repeat {
-			value = repeatedFields[fieldIndex.Repeat]
+	// MSH-1 and MSH-2 hold the delimiters themselves, so there's nothing to split
+	if terserSpec.Segment == "MSH" && fieldIndex.Index <= 2 {
+		if fieldIndex.Index == 1 {
+			value = delimiters.Field
 		}
+		return &value, nil
+	}
+	// handle repetition, which only ever applies to the field itself
+	repeatedFields := strings.Split(value, delimiters.Repetition)
+	if fieldIndex.Repeat >= int64(len(repeatedFields)) {
+		return nil, fmt.Errorf(
+			"%w: %s has %d repetitions, %s asked for repetition %d",
+			ErrFieldOutOfRange,
+			terserSpec.Segment,
+			len(repeatedFields),
+			specification,
+			fieldIndex.Repeat,
+		)
 	}
-	// loop through the indices and split each time resetting the value of `value` based on the encoding char
+	value = repeatedFields[fieldIndex.Repeat]
+	// loop through the indices and split each time resetting the value of `value` based on the
+	// delimiter for that depth, component first and then subcomponent
 	for i, fieldIndex := range terserSpec.FieldIndices[1:] {
-		if fieldIndex.Repeat != 0 {
-			repeatedFields := strings.Split(value, "~")
-			if int64(len(repeatedFields)) >= fieldIndex.Repeat {
-				value = repeatedFields[fieldIndex.Repeat]
-			}
+		separator, err := delimiters.separatorForDepth(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		list := strings.Split(value, separator)
+		if fieldIndex.Index > int64(len(list)) {
+			return nil, fmt.Errorf(
+				"%w: %s has %d parts at that level, asked for %d",
+				ErrFieldOutOfRange,
+				specification,
+				len(list),
+				fieldIndex.Index,
+			)
 		}
-		list := strings.Split(value, encodingChars[i])
 		value = list[fieldIndex.Index-1]
 	}
+	if decode && !delimiters.containsDelimiter(value) {
+		value = delimiters.Decode(value)
+	}
 	return &value, nil
 }
 
-// findSegment - looks for the segment in a list
+// Set - writes a value into the message at the terser specification, creating anything that's
+// missing along the way, and then re-serializes RawMessage as ER7
+func (message *Hl7Message) Set(specification string, value string) error {
+	parsed, err := message.Parse()
+	if err != nil {
+		return err
+	}
+	if err := parsed.Set(specification, value); err != nil {
+		return err
+	}
+	message.RawMessage = parsed.String()
+	return nil
+}
+
+// findSegment - looks for the segment in a list. repeats are found by their set ID in field 1, and
+// for segments that don't have a set ID, like ORC, by their position counting from 1
 func findSegment(segments []string, segment string, repeat int64, fieldSeparator string) (string, error) {
 	if repeat == 1 {
 		for _, s := range segments {
-			if s[0:3] == segment {
+			if segmentName(s, fieldSeparator) == segment {
 				return s, nil
 			}
 		}
 	} else {
+		var occurrence int64
 		for _, s := range segments {
-			if s[0:3] == segment {
+			if segmentName(s, fieldSeparator) == segment {
+				occurrence++
 				segmentParts := strings.Split(s, fieldSeparator)
-				segmentNumber, err := strconv.ParseInt(segmentParts[1], 10, 0)
+				setId := ""
+				if len(segmentParts) > 1 {
+					setId = segmentParts[1]
+				}
+				segmentNumber, err := strconv.ParseInt(setId, 10, 0)
 				if err != nil {
-					return "", errors.New(
-						fmt.Sprintf(
-							"requested %d repeat of %s but that segment does not support repeating",
-							repeat,
-							segment,
-						),
-					)
+					// no set ID, so go by position instead
+					segmentNumber = occurrence
 				}
 				if segmentNumber == repeat {
 					return s, nil
@@ -198,11 +303,26 @@ func findSegment(segments []string, segment string, repeat int64, fieldSeparator
 		}
 	}
 
-	return "", errors.New(fmt.Sprintf("segment matching %s not found", segment))
+	return "", fmt.Errorf("%w: no segment matching %s", ErrSegmentNotFound, segment)
 }
 
+// segmentName - the name of a raw segment is everything up to the first field separator
+func segmentName(rawSegment string, fieldSeparator string) string {
+	return strings.SplitN(rawSegment, fieldSeparator, 2)[0]
+}
+
+// fieldIndexPattern - what every part of a specification after the segment has to look like, a
+// position with an optional repetition, like 11 or 11(1)
+var fieldIndexPattern = regexp.MustCompile(`^[0-9]+(\([0-9]+\))?$`)
+
+// segmentNamePattern - segment names are three letters or numbers, like PID or ZP1
+var segmentNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{2}$`)
+
 func parseTerserSpecification(specification string) (TerserSpecification, error) {
 	var fieldIndices []FieldIndex
+	if len(specification) < 3 || !segmentNamePattern.MatchString(specification[0:3]) {
+		return TerserSpecification{}, fmt.Errorf("%w: %s", ErrInvalidSpecification, specification)
+	}
 	// get the segment the specification is for
 	segment := specification[0:3]
 	// get the rest of the specification
@@ -218,7 +338,7 @@ func parseTerserSpecification(specification string) (TerserSpecification, error)
 		if len(specParts) == 1 {
 			// in this case, we're looking at an invalid spec like NTE(3), where spec parts would be ["(3)"]
 			// this is a meaningless spec
-			return TerserSpecification{}, errors.New(fmt.Sprintf("invalid specification passed in: %s", specification))
+			return TerserSpecification{}, fmt.Errorf("%w: %s", ErrInvalidSpecification, specification)
 		}
 
 		setId := specParts[0]
@@ -227,9 +347,12 @@ func parseTerserSpecification(specification string) (TerserSpecification, error)
 			setId = setId[0:strings.LastIndex(setId, ")")]
 		}
 		value, err := strconv.ParseInt(setId, 10, 0)
-		if err != nil {
-			newError := fmt.Errorf("error parsing desired repeat [%w]", err)
-			return TerserSpecification{}, errors.Unwrap(newError)
+		if err != nil || !strings.HasPrefix(specParts[0], "(") {
+			return TerserSpecification{}, fmt.Errorf(
+				"%w: unable to parse the desired repeat from %s",
+				ErrInvalidSpecification,
+				specification,
+			)
 		}
 		// set our variable
 		repeat = value
@@ -241,7 +364,17 @@ func parseTerserSpecification(specification string) (TerserSpecification, error)
 		if s == "" {
 			continue
 		}
-		fieldIndices = append(fieldIndices, parseFieldIndex(s))
+		if !fieldIndexPattern.MatchString(s) {
+			return TerserSpecification{}, fmt.Errorf("%w: unable to parse '%s' in %s", ErrInvalidSpecification, s, specification)
+		}
+		fieldIndex := parseFieldIndex(s)
+		if fieldIndex.Index < 1 {
+			return TerserSpecification{}, fmt.Errorf("%w: positions start at 1 in %s", ErrInvalidSpecification, specification)
+		}
+		fieldIndices = append(fieldIndices, fieldIndex)
+	}
+	if len(fieldIndices) == 0 {
+		return TerserSpecification{}, fmt.Errorf("%w: %s doesn't name a field", ErrInvalidSpecification, specification)
 	}
 
 	return TerserSpecification{segment, repeat, fieldIndices}, nil
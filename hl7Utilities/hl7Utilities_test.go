@@ -1,6 +1,7 @@
 package hl7Utilities
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -66,6 +67,97 @@ func TestHl7Message_Get(t *testing.T) {
 		t.Logf("Value should be '%s' but got '%s' instead", "STREET3", *value)
 		t.Fail()
 	}
+	// the third level of a path is a subcomponent, not a repetition
+	cases = []struct{ spec, expectedValue string }{
+		{"MSH-1", "|"},
+		{"MSH-2", "^~\\&"},
+		{"PID-3-4-2", "2.16.840.1.113883.3.2.12.1.1"},
+		{"PID-11-9", "COUNTY"},
+		{"PID-11(1)-2", "STREET4"},
+		{"SPM-2-2-2", "Ketchup_LIS"},
+	}
+	for _, c := range cases {
+		value, err := hl7Message.Get(c.spec)
+		if err != nil {
+			t.Log("error should be nil", err)
+			t.Fail()
+			continue
+		}
+		if *value != c.expectedValue {
+			t.Logf("Value for %s should be '%s' but got '%s'", c.spec, c.expectedValue, *value)
+			t.Fail()
+		}
+	}
+	// and custom delimiters have to be honored everywhere
+	hl7Message = Hl7Message{
+		RawMessage: "MSH#*!\\$#SENDER*APP#FACILITY###20220802##ORU*R01*ORU_R01#1#P#2.5.1\r" +
+			"PID#1##ID1*X^Y*AUTH$OID!ID2",
+	}
+	cases = []struct{ spec, expectedValue string }{
+		{"MSH-3-2", "APP"},
+		{"MSH-9-3", "ORU_R01"},
+		{"PID-3-2", "X^Y"},
+		{"PID-3-3-2", "OID"},
+		{"PID-3(1)-1", "ID2"},
+	}
+	for _, c := range cases {
+		value, err := hl7Message.Get(c.spec)
+		if err != nil {
+			t.Log("error should be nil", err)
+			t.Fail()
+			continue
+		}
+		if *value != c.expectedValue {
+			t.Logf("Value for %s should be '%s' but got '%s'", c.spec, c.expectedValue, *value)
+			t.Fail()
+		}
+	}
+}
+
+func TestHl7Message_GetErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		spec      string
+		want      *string
+		wantError error
+	}{
+		{"empty but present field", simpleHl7Message, "PID-2", ptr(""), nil},
+		{"empty but present component", simpleHl7Message, "PID-11-7", ptr(""), nil},
+		{"field not present", simpleHl7Message, "PID-99", nil, ErrFieldOutOfRange},
+		{"repetition not present", simpleHl7Message, "PID-11(5)-1", nil, ErrFieldOutOfRange},
+		{"component not present", simpleHl7Message, "PID-5-9", nil, ErrFieldOutOfRange},
+		{"subcomponent not present", simpleHl7Message, "PID-5-1-2", nil, ErrFieldOutOfRange},
+		{"segment not present", simpleHl7Message, "PV1-2", nil, ErrSegmentNotFound},
+		{"segment repeat not present", simpleHl7Message, "OBX(2)-5", nil, ErrSegmentNotFound},
+		{"empty specification", simpleHl7Message, "", nil, ErrInvalidSpecification},
+		{"lower case segment", simpleHl7Message, "pid-3", nil, ErrInvalidSpecification},
+		{"not a number", simpleHl7Message, "PID-x", nil, ErrInvalidSpecification},
+		{"positions start at one", simpleHl7Message, "PID-0", nil, ErrInvalidSpecification},
+		{"no field", simpleHl7Message, "PID", nil, ErrInvalidSpecification},
+		{"nested too deep", simpleHl7Message, "PID-3-4-2-1", nil, ErrInvalidSpecification},
+		{"not an HL7 message", "PID|1||ID", "PID-3", nil, ErrInvalidMessage},
+		{"bare MSH", "MSH", "MSH-3", nil, ErrInvalidMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Hl7Message{RawMessage: tt.message}.Get(tt.spec)
+			if !errors.Is(err, tt.wantError) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantError)
+			}
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("Get() got = %v, want %v", got, tt.want)
+			}
+			if got != nil && *got != *tt.want {
+				t.Errorf("Get() got = '%s', want '%s'", *got, *tt.want)
+			}
+		})
+	}
+}
+
+// ptr - returns a pointer to the string so we can compare against Get
+func ptr(value string) *string {
+	return &value
 }
 
 // tests the findSegment method and lets us verify its functionality
@@ -235,3 +327,64 @@ func Test_parseFieldIndex(t *testing.T) {
 		})
 	}
 }
+
+func TestHl7Message_Set(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		value   string
+		getSpec string
+		want    string
+		wantErr bool
+	}{
+		{"overwrite a component", "MSH-3-1", "Mustard Clinic", "MSH-3-1", "Mustard Clinic", false},
+		{"add a component to a repetition", "PID-11(1)-4", "MN", "PID-11(1)-4", "MN", false},
+		{"add a repetition", "PID-11(2)-3", "DULUTH", "PID-11(2)-3", "DULUTH", false},
+		{"add a subcomponent", "PID-3-4-4", "EXTRA", "PID-3-4-4", "EXTRA", false},
+		{"pad out missing fields", "PID-40", "LAST", "PID-40", "LAST", false},
+		{"create a missing segment", "ZZZ-3-2", "custom", "ZZZ-3-2", "custom", false},
+		{"create a missing repeat", "NTE(3)-3", "third note", "NTE(3)-3", "third note", false},
+		{"escape the value", "PID-5-1", "Smith&Jones", "PID-5-1", "Smith&Jones", false},
+		{"cannot set the delimiters", "MSH-2", "*!\\$", "", "", true},
+		{"need a field", "PID", "", "", "", true},
+		{"field too far", "PID-99999999", "x", "", "", true},
+		{"repetition too far", "PID-3(50000000)", "x", "", "", true},
+		{"component too far", "PID-3-1000", "x", "", "", true},
+		{"subcomponent too far", "PID-3-4-1000", "x", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hl7Message := Hl7Message{RawMessage: simpleHl7Message}
+			err := hl7Message.Set(tt.spec, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := hl7Message.Get(tt.getSpec)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Get() after Set() = '%s', want '%s'", *got, tt.want)
+			}
+		})
+	}
+	// the rest of the message should be left alone
+	hl7Message := Hl7Message{RawMessage: simpleHl7Message}
+	if err := hl7Message.Set("PID-11(1)-4", "MN"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	value, _ := hl7Message.Get("PID-11(1)")
+	if *value != "STREET3^STREET4^CITY^MN^90210^COUNTRY^^^COUNTY" {
+		t.Errorf("PID-11(1) = '%s'", *value)
+	}
+	value, _ = hl7Message.GetRaw("PID-11")
+	if *value != "STREET1^STREET2^CITY^CA^90210^COUNTRY^^^COUNTY" {
+		t.Errorf("PID-11 = '%s'", *value)
+	}
+	if !strings.HasSuffix(hl7Message.RawMessage, "\r") || strings.Contains(hl7Message.RawMessage, "\n") {
+		t.Errorf("Set() should re-serialize the message with \\r segment terminators")
+	}
+}
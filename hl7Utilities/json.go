@@ -0,0 +1,203 @@
+package hl7Utilities
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONOptions - controls how a message is written out as JSON
+type JSONOptions struct {
+	// FieldNames - adds the name the standard gives each field, like "Patient Name" for PID-5, for
+	// the segments we have definitions for
+	FieldNames bool
+	// Indent - indents nested values with this, rather than writing everything on one line
+	Indent string
+}
+
+// jsonMessage - the JSON form of a message. every value has the same type wherever it appears, so
+// the schema doesn't change from one message to the next:
+//
+//	{
+//	  "fieldSeparator": "|",
+//	  "encodingCharacters": "^~\\&",
+//	  "segments": [
+//	    {"name": "PID", "fields": [
+//	      {"position": 5, "name": "Patient Name", "repetitions": [[["DOE"], ["JANE"]]]}
+//	    ]}
+//	  ]
+//	}
+//
+// each field holds its repetitions, each repetition its components and each component its
+// subcomponents. only valued fields are written, and the separator and encoding characters in
+// MSH-1 and MSH-2 are only written at the top
+type jsonMessage struct {
+	FieldSeparator     string        `json:"fieldSeparator"`
+	EncodingCharacters string        `json:"encodingCharacters"`
+	Segments           []jsonSegment `json:"segments"`
+}
+
+// jsonSegment - the JSON form of a segment
+type jsonSegment struct {
+	Name   string      `json:"name"`
+	Fields []jsonField `json:"fields"`
+}
+
+// jsonField - the JSON form of a field, with escape sequences decoded in every value
+type jsonField struct {
+	Position    int          `json:"position"`
+	Name        string       `json:"name,omitempty"`
+	Repetitions [][][]string `json:"repetitions"`
+}
+
+// MarshalJSON - writes the message out as JSON without field names, see [ParsedMessage.EncodeJSON].
+// json.Marshal escapes characters like & and < in what this returns, which [ParsedMessage.EncodeJSON]
+// doesn't
+func (m *ParsedMessage) MarshalJSON() ([]byte, error) {
+	return m.EncodeJSON(JSONOptions{})
+}
+
+// EncodeJSON - writes the message out as JSON, for tools that want to read messages without an HL7
+// parser. values have their escape sequences decoded, so a value sent as `A\T\B` is written as
+// `A&B`. formatting commands like \H\ are dropped when they're decoded, so they don't survive a
+// trip through JSON and back
+func (m *ParsedMessage) EncodeJSON(options JSONOptions) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", options.Indent)
+	if err := encoder.Encode(m.jsonMessage(options.FieldNames)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// EncodeJSON - parses the message and writes it out as JSON with the options
+func (message Hl7Message) EncodeJSON(options JSONOptions) ([]byte, error) {
+	parsed, err := message.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return parsed.EncodeJSON(options)
+}
+
+// jsonMessage - builds the JSON form of the message
+func (m *ParsedMessage) jsonMessage(fieldNames bool) jsonMessage {
+	message := jsonMessage{
+		FieldSeparator:     m.Delimiters.Field,
+		EncodingCharacters: m.Delimiters.EncodingCharacters(),
+		Segments:           []jsonSegment{},
+	}
+	version := ""
+	if value, err := m.GetRaw("MSH-12"); err == nil {
+		version = *value
+	}
+	for _, s := range m.Segments {
+		var definition *SegmentDefinition
+		if fieldNames {
+			definition, _ = LookupSegmentDefinition(s.Name, version)
+		}
+		segment := jsonSegment{Name: s.Name, Fields: []jsonField{}}
+		for i, f := range s.Fields {
+			position := i + 1
+			if (isHeaderSegment(s.Name) && position <= 2) || fieldEmpty(f) {
+				continue
+			}
+			field := jsonField{Position: position}
+			if definition != nil {
+				if d := definition.Field(position); d != nil {
+					field.Name = d.Name
+				}
+			}
+			for _, r := range f.Repetitions {
+				components := make([][]string, 0, len(r.Components))
+				for _, c := range r.Components {
+					subcomponents := make([]string, 0, len(c.Subcomponents))
+					for _, value := range c.Subcomponents {
+						subcomponents = append(subcomponents, m.Delimiters.Decode(value))
+					}
+					components = append(components, subcomponents)
+				}
+				field.Repetitions = append(field.Repetitions, components)
+			}
+			segment.Fields = append(segment.Fields, field)
+		}
+		message.Segments = append(message.Segments, segment)
+	}
+	return message
+}
+
+// UnmarshalJSON - rebuilds the message from the JSON [ParsedMessage.EncodeJSON] writes, escaping the
+// values for the delimiters it declares, or the default ones when it doesn't declare any. field names
+// are ignored, so JSON written with or without them reads the same
+func (m *ParsedMessage) UnmarshalJSON(data []byte) error {
+	var message jsonMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	delimiters := DefaultDelimiters
+	if message.FieldSeparator != "" || message.EncodingCharacters != "" {
+		var err error
+		if delimiters, err = NewDelimiters(message.FieldSeparator, message.EncodingCharacters); err != nil {
+			return err
+		}
+	}
+	parsed := ParsedMessage{Delimiters: delimiters}
+	for _, s := range message.Segments {
+		if s.Name == "" {
+			return fmt.Errorf("%w: segment has no name", ErrInvalidMessage)
+		}
+		if !segmentNamePattern.MatchString(s.Name) {
+			return fmt.Errorf("%w: '%s' isn't a segment name", ErrInvalidMessage, s.Name)
+		}
+		segment := &ParsedSegment{Name: s.Name}
+		if isHeaderSegment(s.Name) {
+			segment.Fields = []*Field{newPrimitiveField(delimiters.Field), newPrimitiveField(delimiters.EncodingCharacters())}
+		}
+		for _, f := range s.Fields {
+			if f.Position < 1 || f.Position <= len(segment.Fields) {
+				return fmt.Errorf("%w: %s-%d is out of order", ErrInvalidMessage, s.Name, f.Position)
+			}
+			if f.Position > maxPosition {
+				return fmt.Errorf("%w: %s-%d is past the last position we accept, %d", ErrInvalidMessage, s.Name, f.Position, maxPosition)
+			}
+			for len(segment.Fields) < f.Position-1 {
+				segment.Fields = append(segment.Fields, newPrimitiveField(""))
+			}
+			field := &Field{}
+			for _, r := range f.Repetitions {
+				repetition := &Repetition{}
+				for _, c := range r {
+					component := &Component{}
+					for _, value := range c {
+						component.Subcomponents = append(component.Subcomponents, delimiters.Encode(value))
+					}
+					if len(component.Subcomponents) == 0 {
+						component.Subcomponents = []string{""}
+					}
+					repetition.Components = append(repetition.Components, component)
+				}
+				if len(repetition.Components) == 0 {
+					repetition.Components = newPrimitiveField("").Repetitions[0].Components
+				}
+				field.Repetitions = append(field.Repetitions, repetition)
+			}
+			if len(field.Repetitions) == 0 {
+				field = newPrimitiveField("")
+			}
+			segment.Fields = append(segment.Fields, field)
+		}
+		parsed.Segments = append(parsed.Segments, segment)
+	}
+	*m = parsed
+	return nil
+}
+
+// ParseJSON - reads a message from the JSON [ParsedMessage.EncodeJSON] writes
+func ParseJSON(data []byte) (*ParsedMessage, error) {
+	parsed := &ParsedMessage{}
+	if err := parsed.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
@@ -0,0 +1,135 @@
+package hl7Utilities
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsedMessage_EncodeJSON_roundTrip(t *testing.T) {
+	// JSON holds the decoded values, so whatever was escaped has to be escaped again on the way back
+	tests := []struct {
+		name    string
+		message string
+		json    string
+	}{
+		{
+			"escaped delimiters and line breaks",
+			"MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rNTE|1||a\\F\\b\\S\\c\\T\\d\\R\\e\\E\\f\\.br\\g\r",
+			`"repetitions":[[["a|b^c&d~e\\f\ng"]]]`,
+		},
+		{
+			"custom delimiters",
+			"MSH#*!\\$#SENDER*APP#FACILITY###20220802##ORU*R01*ORU_R01#1#P#2.5.1\rNTE#1##a|b^c&d~e\\F\\f\r",
+			`"repetitions":[[["a|b^c&d~e#f"]]]`,
+		},
+		{
+			"empty repetitions, components and subcomponents",
+			"MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rPID|1||~~ID3^^^AUTH&&ISO\r",
+			`"repetitions":[[[""]],[[""]],[["ID3"],[""],[""],["AUTH","","ISO"]]]`,
+		},
+	}
+	for _, tt := range tests {
+		parsed, err := ParseMessage(tt.message)
+		if err != nil {
+			t.Fatalf("%s: ParseMessage() error = %v", tt.name, err)
+		}
+		// the field names are only there for people reading it, and shouldn't change what's read back
+		for _, fieldNames := range []bool{false, true} {
+			data, err := parsed.EncodeJSON(JSONOptions{FieldNames: fieldNames})
+			if err != nil {
+				t.Fatalf("%s: EncodeJSON() error = %v", tt.name, err)
+			}
+			if !strings.Contains(string(data), tt.json) {
+				t.Errorf("%s: expected %s in %s", tt.name, tt.json, data)
+			}
+			var decoded ParsedMessage
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Errorf("%s: Unmarshal() error = %v\n%s", tt.name, err, data)
+				continue
+			}
+			if got, want := decoded.String(), parsed.String(); got != want {
+				t.Errorf("%s: round trip = %q, want %q\n%s", tt.name, got, want, data)
+			}
+		}
+		// json.Marshal escapes the & and < in values, which reads back the same
+		data, err := json.Marshal(parsed)
+		if err != nil {
+			t.Fatalf("%s: Marshal() error = %v", tt.name, err)
+		}
+		if decoded, err := ParseJSON(data); err != nil || decoded.String() != parsed.String() {
+			t.Errorf("%s: Marshal() didn't round trip, error = %v\n%s", tt.name, err, data)
+		}
+	}
+}
+
+func TestParsedMessage_EncodeJSON(t *testing.T) {
+	message := "MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rPID|1||M1^^^LAB&1.2.3~M2||DOE\\T\\SMITH^JANE\rZPI|1"
+	parsed, err := ParseMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.EncodeJSON(JSONOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"name":"PID","fields":[` +
+		`{"position":1,"repetitions":[[["1"]]]},` +
+		`{"position":3,"repetitions":[[["M1"],[""],[""],["LAB","1.2.3"]],[["M2"]]]},` +
+		`{"position":5,"repetitions":[[["DOE&SMITH"],["JANE"]]]}]}`
+	if !strings.Contains(string(data), expected) {
+		t.Logf("expected %s in %s", expected, data)
+		t.Fail()
+	}
+	if start := `{"fieldSeparator":"|","encodingCharacters":"^~\\&","segments":[{"name":"MSH","fields":[{"position":3,`; !strings.HasPrefix(string(data), start) {
+		t.Logf("expected %s to start with %s", data, start)
+		t.Fail()
+	}
+	named, err := parsed.EncodeJSON(JSONOptions{FieldNames: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{
+		`{"position":5,"name":"Patient Name","repetitions"`,
+		`{"position":9,"name":"Message Type","repetitions"`,
+		// we don't know the names of a Z segment's fields
+		`{"name":"ZPI","fields":[{"position":1,"repetitions":[[["1"]]]}]}`,
+	} {
+		if !strings.Contains(string(named), e) {
+			t.Logf("expected %s in %s", e, named)
+			t.Fail()
+		}
+	}
+	// the names don't get in the way of reading it back
+	decoded, err := ParseJSON(named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := decoded.Get("PID-5-1"); err != nil || *value != "DOE&SMITH" {
+		t.Logf("expected DOE&SMITH but got %v, %v", value, err)
+		t.Fail()
+	}
+}
+
+func TestParseJSON_errors(t *testing.T) {
+	cases := map[string]string{
+		"not JSON":          "MSH|^~\\&|LAB",
+		"wrong shape":       `{"segments":{"name":"MSH"}}`,
+		"no name":           `{"segments":[{"fields":[]}]}`,
+		"delimiter in name": `{"segments":[{"name":"PID|X","fields":[]}]}`,
+		"component in name": `{"segments":[{"name":"P^D","fields":[]}]}`,
+		"lower case name":   `{"segments":[{"name":"pid","fields":[]}]}`,
+		"delimiters":        `{"fieldSeparator":"|","encodingCharacters":"^^~\\&","segments":[]}`,
+		"position":          `{"segments":[{"name":"PID","fields":[{"position":0,"repetitions":[]}]}]}`,
+		"out of order":      `{"segments":[{"name":"PID","fields":[{"position":3,"repetitions":[]},{"position":2,"repetitions":[]}]}]}`,
+		"huge position":     `{"segments":[{"name":"PID","fields":[{"position":30000000,"repetitions":[[["x"]]]}]}]}`,
+		"MSH-2":             `{"segments":[{"name":"MSH","fields":[{"position":2,"repetitions":[[["^~\\&"]]]}]}]}`,
+	}
+	for name, data := range cases {
+		if _, err := ParseJSON([]byte(data)); !errors.Is(err, ErrInvalidMessage) {
+			t.Logf("%s: expected ErrInvalidMessage but got %v", name, err)
+			t.Fail()
+		}
+	}
+}
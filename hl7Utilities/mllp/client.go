@@ -0,0 +1,371 @@
+package mllp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// acknowledgment codes for the enhanced acknowledgment mode, where the receiver first commits to
+// having stored the message
+const (
+	// CommitAccept - the message was stored safely
+	CommitAccept = "CA"
+	// CommitError - the message couldn't be stored
+	CommitError = "CE"
+	// CommitReject - the message was refused
+	CommitReject = "CR"
+)
+
+var (
+	// ErrAckMismatch - the ACK we got back is for some other message, since its MSA-2 doesn't match
+	// the MSH-10 we sent
+	ErrAckMismatch = errors.New("mllp: ACK is for a different message")
+	// ErrInvalidAck - the response isn't an ACK we can read
+	ErrInvalidAck = errors.New("mllp: invalid ACK")
+	// ErrClientClosed - Send was called after Close
+	ErrClientClosed = errors.New("mllp: client closed")
+)
+
+// Ack - the acknowledgment a receiver sent back for a message
+type Ack struct {
+	// Code - MSA-1, one of AA, AE, AR, CA, CE or CR
+	Code string
+	// ControlId - MSA-2, the MSH-10 of the message being acknowledged
+	ControlId string
+	// Text - MSA-3, the receiver's explanation when it didn't accept the message
+	Text    string
+	Message *hl7Utilities.ParsedMessage
+}
+
+// Accepted - true for AA and CA
+func (a *Ack) Accepted() bool {
+	return a.Code == ApplicationAccept || a.Code == CommitAccept
+}
+
+// Errored - true for AE and CE, which mean the receiver had a problem and the message can be sent again
+func (a *Ack) Errored() bool {
+	return a.Code == ApplicationError || a.Code == CommitError
+}
+
+// Rejected - true for AR and CR, which mean the message shouldn't be sent again as it is
+func (a *Ack) Rejected() bool {
+	return a.Code == ApplicationReject || a.Code == CommitReject
+}
+
+// Commit - true for the enhanced mode codes, CA, CE and CR
+func (a *Ack) Commit() bool {
+	return strings.HasPrefix(a.Code, "C")
+}
+
+// Client - sends messages to a single MLLP receiver and waits for their ACKs. it's safe to share
+// between goroutines, each Send uses its own connection, and connections are kept open between sends
+// so a busy feed doesn't pay for a new one every message
+type Client struct {
+	// Addr - the receiver's TCP address, like "lab.example.com:2575"
+	Addr string
+	// DialTimeout - how long we wait to connect. zero means 10 seconds
+	DialTimeout time.Duration
+	// AckTimeout - how long we wait for the ACK after sending a message. zero means 30 seconds
+	AckTimeout time.Duration
+	// MaxRetries - how many more times we try a message after a timeout or a dropped connection. an
+	// idle connection the receiver has since closed doesn't count, we just open a new one
+	MaxRetries int
+	// RetryBackoff - how long we wait before the first retry, doubling for each one after. zero
+	// means 200 milliseconds
+	RetryBackoff time.Duration
+	// MaxBackoff - the longest we ever wait between retries. zero means 5 seconds
+	MaxBackoff time.Duration
+	// MaxConnections - how many connections can be open at once, with Send waiting for one to free
+	// up when they're all busy. zero means no limit
+	MaxConnections int
+	// MaxIdleConnections - how many connections we keep open between sends. zero means 2
+	MaxIdleConnections int
+	// MaxFrameSize - the largest ACK we read, DefaultMaxFrameSize when it's zero
+	MaxFrameSize int
+
+	mu      sync.Mutex
+	idle    []*clientConnection
+	slots   chan struct{}
+	closed  bool
+	sleepFn func(ctx context.Context, d time.Duration) error
+}
+
+// clientConnection - a connection to the receiver along with its reader, which can hold bytes we
+// haven't used yet
+type clientConnection struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Send - sends the message and returns the receiver's ACK. timeouts and dropped connections are
+// retried with backoff, up to MaxRetries times, but an ACK of any kind is returned as is, so check
+// Accepted, Errored and Rejected to see what the receiver thought of the message
+func (c *Client) Send(ctx context.Context, message hl7Utilities.Hl7Message) (*Ack, error) {
+	controlId, err := message.GetRaw("MSH-10")
+	if err != nil || *controlId == "" {
+		return nil, fmt.Errorf("%w: the message has no MSH-10 to match the ACK to", hl7Utilities.ErrInvalidMessage)
+	}
+	payload := []byte(strings.Join(message.MessageSegments(), "\r"))
+	backoff := c.RetryBackoff
+	if backoff <= 0 {
+		backoff = 200 * time.Millisecond
+	}
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		ack, err := c.send(ctx, payload, *controlId)
+		if err == nil || !retryable(err) || attempt >= c.MaxRetries || ctx.Err() != nil {
+			return ack, err
+		}
+		if err := c.sleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Close - closes the idle connections and stops any more sends. sends that are already running
+// finish, and their connections are closed when they do
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, conn := range c.idle {
+		conn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// send - one attempt at sending the message
+func (c *Client) send(ctx context.Context, payload []byte, controlId string) (*Ack, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+	conn, err := c.idleConnection()
+	if err != nil {
+		return nil, err
+	}
+	reused := conn != nil
+	if !reused {
+		if conn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ack, answered, err := c.exchange(ctx, conn, payload)
+	if err != nil && reused && !answered && stale(ctx, err) {
+		// receivers routinely hang up on connections that sit idle, which we only find out about by
+		// using one, so that's not worth a retry of its own. try again once on a new connection
+		conn.Close()
+		if conn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+		ack, _, err = c.exchange(ctx, conn, payload)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.putIdle(conn)
+	if ack.ControlId != controlId {
+		return ack, fmt.Errorf("%w: sent %s but got an ACK for %s", ErrAckMismatch, controlId, ack.ControlId)
+	}
+	return ack, nil
+}
+
+// exchange - writes the message and reads the ACK, giving up when the context ends or the ACK
+// takes too long. answered is true once any of the ACK has arrived
+func (c *Client) exchange(ctx context.Context, conn *clientConnection, payload []byte) (ack *Ack, answered bool, err error) {
+	ackTimeout := c.AckTimeout
+	if ackTimeout <= 0 {
+		ackTimeout = 30 * time.Second
+	}
+	deadline := time.Now().Add(ackTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	// unblock the read if the context is cancelled before the deadline
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	if err := WriteFrame(conn, payload); err != nil {
+		return nil, false, c.contextError(ctx, err)
+	}
+	// wait for the first byte on its own so we know whether the receiver said anything at all
+	if _, err := conn.reader.Peek(1); err != nil {
+		return nil, false, c.contextError(ctx, err)
+	}
+	frame, err := ReadFrame(conn.reader, c.MaxFrameSize)
+	if err != nil {
+		return nil, true, c.contextError(ctx, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	ack, err = parseAck(frame)
+	return ack, true, err
+}
+
+// contextError - reports the context's error rather than the timeout it caused on the connection
+func (c *Client) contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// parseAck - reads the MSA out of an ACK
+func parseAck(frame []byte) (*Ack, error) {
+	parsed, err := hl7Utilities.ParseMessage(string(frame))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAck, err)
+	}
+	msa := parsed.Segment("MSA", 0)
+	if msa == nil {
+		return nil, fmt.Errorf("%w: no MSA segment", ErrInvalidAck)
+	}
+	ack := &Ack{
+		Code:      msa.Field(1).Value(),
+		ControlId: parsed.Delimiters.Decode(msa.Field(2).Value()),
+		Text:      parsed.Delimiters.Decode(msa.Field(3).Value()),
+		Message:   parsed,
+	}
+	switch ack.Code {
+	case ApplicationAccept, ApplicationError, ApplicationReject, CommitAccept, CommitError, CommitReject:
+		return ack, nil
+	}
+	return nil, fmt.Errorf("%w: unknown acknowledgment code '%s'", ErrInvalidAck, ack.Code)
+}
+
+// retryable - true for the errors that mean the message may never have arrived, so sending it again
+// is the right thing to do. the receiver is expected to cope with the odd duplicate, the same as
+// with any MLLP sender
+func retryable(err error) bool {
+	if errors.Is(err, ErrAckMismatch) || errors.Is(err, ErrInvalidAck) || errors.Is(err, ErrClientClosed) ||
+		errors.Is(err, ErrFrameTooLarge) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return true
+}
+
+// stale - true when the error from a reused connection looks like the receiver closed it while it
+// was idle, rather than the receiver being slow or us giving up
+func stale(ctx context.Context, err error) bool {
+	var netErr net.Error
+	if ctx.Err() != nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return false
+	}
+	return retryable(err)
+}
+
+// idleConnection - an idle connection if we have one, otherwise nil
+func (c *Client) idleConnection() (*clientConnection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	n := len(c.idle)
+	if n == 0 {
+		return nil, nil
+	}
+	conn := c.idle[n-1]
+	c.idle = c.idle[:n-1]
+	return conn, nil
+}
+
+// dial - opens a new connection to the receiver
+func (c *Client) dial(ctx context.Context) (*clientConnection, error) {
+	dialTimeout := c.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = 10 * time.Second
+	}
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &clientConnection{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// putIdle - keeps the connection for the next send, or closes it when we have enough already
+func (c *Client) putIdle(conn *clientConnection) {
+	maxIdle := c.MaxIdleConnections
+	if maxIdle <= 0 {
+		maxIdle = 2
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= maxIdle || conn.reader.Buffered() > 0 {
+		// anything left in the reader is something we didn't ask for, so the connection can't be trusted
+		conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+// acquire - waits for a free connection slot when MaxConnections is set
+func (c *Client) acquire(ctx context.Context) error {
+	if c.MaxConnections <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	if c.slots == nil {
+		c.slots = make(chan struct{}, c.MaxConnections)
+	}
+	slots := c.slots
+	c.mu.Unlock()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release - frees the slot acquire took
+func (c *Client) release() {
+	if c.MaxConnections <= 0 {
+		return
+	}
+	c.mu.Lock()
+	slots := c.slots
+	c.mu.Unlock()
+	<-slots
+}
+
+// sleep - waits between retries, or until the context ends
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	if c.sleepFn != nil {
+		return c.sleepFn(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
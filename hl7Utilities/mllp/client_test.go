@@ -0,0 +1,345 @@
+package mllp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// fakeReceiver - a receiver that answers each frame however respond says, counting the frames and
+// connections it sees. a nil reply hangs up without answering
+func fakeReceiver(t *testing.T, respond func(frame int, message []byte) []byte) (string, *receiverStats) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("unable to listen", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	stats := &receiverStats{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			stats.add(&stats.connections)
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					message, err := ReadFrame(reader, 0)
+					if err != nil {
+						return
+					}
+					reply := respond(stats.add(&stats.frames), message)
+					if reply == nil {
+						return
+					}
+					if len(reply) > 0 {
+						if err := WriteFrame(conn, reply); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), stats
+}
+
+// receiverStats - what a fake receiver has seen
+type receiverStats struct {
+	mu          sync.Mutex
+	connections int
+	frames      int
+}
+
+// add - increments a count, returning its new value
+func (s *receiverStats) add(count *int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*count++
+	return *count
+}
+
+// get - reads a count
+func (s *receiverStats) get(count *int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *count
+}
+
+// ackFor - an ACK with the code for the message
+func ackFor(message []byte, code string) []byte {
+	controlId, _ := hl7Utilities.Hl7Message{RawMessage: string(message)}.GetRaw("MSH-10")
+	return []byte(fmt.Sprintf("MSH|^~\\&|EHR||LAB||20220802||ACK^R01^ACK|ACK1|P|2.5.1\rMSA|%s|%s|", code, *controlId))
+}
+
+// noSleep - records the backoffs instead of waiting
+func noSleep(backoffs *[]time.Duration) func(context.Context, time.Duration) error {
+	return func(_ context.Context, d time.Duration) error {
+		*backoffs = append(*backoffs, d)
+		return nil
+	}
+}
+
+func TestClient_SendToServer(t *testing.T) {
+	var addresses []string
+	var mu sync.Mutex
+	server := &Server{Handler: HandlerFunc(func(_ context.Context, request *Request) error {
+		mu.Lock()
+		addresses = append(addresses, request.RemoteAddr.String())
+		mu.Unlock()
+		switch request.Parsed.Segment("PID", 0).Field(3).Value() {
+		case "ERROR":
+			return fmt.Errorf("unable to store the result")
+		case "REJECT":
+			return fmt.Errorf("%w: unknown patient", ErrRejected)
+		}
+		return nil
+	})}
+	client := &Client{Addr: startServer(t, server)}
+	defer client.Close()
+	cases := []struct {
+		patient, code               string
+		accepted, errored, rejected bool
+	}{
+		{"M177323145", "AA", true, false, false},
+		{"ERROR", "AE", false, true, false},
+		{"REJECT", "AR", false, false, true},
+	}
+	for _, c := range cases {
+		message := hl7Utilities.Hl7Message{RawMessage: strings.Replace(inboundMessage, "M177323145", c.patient, 1)}
+		ack, err := client.Send(context.Background(), message)
+		if err != nil {
+			t.Fatalf("%s: error should be nil: %v", c.patient, err)
+		}
+		if ack.Code != c.code || ack.Accepted() != c.accepted || ack.Errored() != c.errored || ack.Rejected() != c.rejected || ack.Commit() {
+			t.Logf("%s: unexpected ACK %+v", c.patient, ack)
+			t.Fail()
+		}
+		if ack.ControlId != "CTRL123" {
+			t.Logf("%s: expected the ACK for CTRL123 but got %s", c.patient, ack.ControlId)
+			t.Fail()
+		}
+	}
+	// every message went over the same pooled connection
+	for _, address := range addresses {
+		if address != addresses[0] {
+			t.Logf("expected a single connection but got %v", addresses)
+			t.Fail()
+			break
+		}
+	}
+}
+
+func TestClient_CommitAcks(t *testing.T) {
+	codes := []string{"CA", "CE", "CR"}
+	address, _ := fakeReceiver(t, func(frame int, message []byte) []byte {
+		return ackFor(message, codes[frame-1])
+	})
+	client := &Client{Addr: address}
+	defer client.Close()
+	for _, code := range codes {
+		ack, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage})
+		if err != nil {
+			t.Fatalf("%s: error should be nil: %v", code, err)
+		}
+		if ack.Code != code || !ack.Commit() {
+			t.Logf("expected a %s commit ACK but got %+v", code, ack)
+			t.Fail()
+		}
+	}
+}
+
+func TestClient_RetriesDroppedConnections(t *testing.T) {
+	// hang up on the first two tries, then accept
+	address, stats := fakeReceiver(t, func(frame int, message []byte) []byte {
+		if frame < 3 {
+			return nil
+		}
+		return ackFor(message, "AA")
+	})
+	var backoffs []time.Duration
+	client := &Client{Addr: address, MaxRetries: 3, RetryBackoff: 100 * time.Millisecond, sleepFn: noSleep(&backoffs)}
+	defer client.Close()
+	ack, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage})
+	if err != nil || !ack.Accepted() {
+		t.Fatalf("expected the third try to be accepted but got %+v, %v", ack, err)
+	}
+	if stats.get(&stats.connections) != 3 {
+		t.Logf("expected a new connection for each try but got %d", stats.get(&stats.connections))
+		t.Fail()
+	}
+	if fmt.Sprint(backoffs) != "[100ms 200ms]" {
+		t.Logf("expected the backoff to double but got %v", backoffs)
+		t.Fail()
+	}
+}
+
+func TestClient_ReconnectsAfterIdleHangUp(t *testing.T) {
+	// answer one message on each connection and then hang up, like receivers that close idle connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("unable to listen", err)
+	}
+	defer listener.Close()
+	stats := &receiverStats{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			stats.add(&stats.connections)
+			go func() {
+				defer conn.Close()
+				if message, err := ReadFrame(bufio.NewReader(conn), 0); err == nil {
+					stats.add(&stats.frames)
+					_ = WriteFrame(conn, ackFor(message, "AA"))
+				}
+			}()
+		}
+	}()
+	var backoffs []time.Duration
+	client := &Client{Addr: listener.Addr().String(), sleepFn: noSleep(&backoffs)}
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		ack, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage})
+		if err != nil || !ack.Accepted() {
+			t.Fatalf("send %d: expected the message to be accepted but got %+v, %v", i+1, ack, err)
+		}
+	}
+	if stats.get(&stats.connections) != 3 || stats.get(&stats.frames) != 3 {
+		t.Logf("expected a new connection for each message but got %d connections and %d frames",
+			stats.get(&stats.connections), stats.get(&stats.frames))
+		t.Fail()
+	}
+	if len(backoffs) != 0 {
+		t.Logf("a closed idle connection shouldn't count as a retry but we backed off %v", backoffs)
+		t.Fail()
+	}
+}
+
+func TestClient_GivesUpAfterMaxRetries(t *testing.T) {
+	// read the message but never answer
+	address, stats := fakeReceiver(t, func(int, []byte) []byte { return []byte{} })
+	var backoffs []time.Duration
+	client := &Client{
+		Addr:       address,
+		AckTimeout: 50 * time.Millisecond,
+		MaxRetries: 2,
+		MaxBackoff: 150 * time.Millisecond,
+		sleepFn:    noSleep(&backoffs),
+	}
+	defer client.Close()
+	_, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Logf("expected a timeout but got %v", err)
+		t.Fail()
+	}
+	if stats.get(&stats.frames) != 3 {
+		t.Logf("expected 3 tries but got %d", stats.get(&stats.frames))
+		t.Fail()
+	}
+	if fmt.Sprint(backoffs) != "[150ms 150ms]" {
+		t.Logf("expected the backoff to be capped but got %v", backoffs)
+		t.Fail()
+	}
+}
+
+func TestClient_AckMismatch(t *testing.T) {
+	address, stats := fakeReceiver(t, func(_ int, message []byte) []byte {
+		return []byte("MSH|^~\\&|EHR||LAB||20220802||ACK^R01^ACK|ACK1|P|2.5.1\rMSA|AA|SOMETHING ELSE")
+	})
+	client := &Client{Addr: address, MaxRetries: 3}
+	defer client.Close()
+	ack, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage})
+	if !errors.Is(err, ErrAckMismatch) || ack == nil || ack.ControlId != "SOMETHING ELSE" {
+		t.Logf("expected a mismatch but got %+v, %v", ack, err)
+		t.Fail()
+	}
+	// it may well have been stored, so sending it again could make a duplicate
+	if stats.get(&stats.frames) != 1 {
+		t.Logf("a mismatched ACK shouldn't be retried, but we sent %d", stats.get(&stats.frames))
+		t.Fail()
+	}
+}
+
+func TestClient_InvalidAck(t *testing.T) {
+	address, _ := fakeReceiver(t, func(_ int, message []byte) []byte {
+		return []byte("MSH|^~\\&|EHR||LAB||20220802||ACK^R01^ACK|ACK1|P|2.5.1\rMSA|XX|CTRL123")
+	})
+	client := &Client{Addr: address}
+	defer client.Close()
+	if _, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage}); !errors.Is(err, ErrInvalidAck) {
+		t.Logf("expected an invalid ACK but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	client := &Client{Addr: "127.0.0.1:1"}
+	if _, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: "MSH|^~\\&|LAB"}); !errors.Is(err, hl7Utilities.ErrInvalidMessage) {
+		t.Logf("a message without MSH-10 should be invalid, but got %v", err)
+		t.Fail()
+	}
+	client.Close()
+	if _, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage}); !errors.Is(err, ErrClientClosed) {
+		t.Logf("expected the client to be closed but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestClient_ContextCancelled(t *testing.T) {
+	address, _ := fakeReceiver(t, func(int, []byte) []byte { return []byte{} })
+	client := &Client{Addr: address, MaxRetries: 5}
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := client.Send(ctx, hl7Utilities.Hl7Message{RawMessage: inboundMessage}); !errors.Is(err, context.Canceled) {
+		t.Logf("expected the send to be cancelled but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestClient_MaxConnections(t *testing.T) {
+	release := make(chan struct{})
+	address, stats := fakeReceiver(t, func(_ int, message []byte) []byte {
+		<-release
+		return ackFor(message, "AA")
+	})
+	client := &Client{Addr: address, MaxConnections: 2}
+	defer client.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Send(context.Background(), hl7Utilities.Hl7Message{RawMessage: inboundMessage}); err != nil {
+				t.Log("error should be nil", err)
+				t.Fail()
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	if stats.get(&stats.connections) != 2 {
+		t.Logf("expected only 2 connections but got %d", stats.get(&stats.connections))
+		t.Fail()
+	}
+	close(release)
+	wg.Wait()
+	if stats.get(&stats.frames) != 4 {
+		t.Logf("expected all 4 messages to be sent but got %d", stats.get(&stats.frames))
+		t.Fail()
+	}
+}
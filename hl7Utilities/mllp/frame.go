@@ -0,0 +1,87 @@
+// Package mllp sends and receives HL7 messages over the minimal lower layer protocol, which wraps
+// each message in a start block character and an end block character followed by a carriage return
+package mllp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// StartBlock - the vertical tab that opens a frame
+	StartBlock byte = 0x0b
+	// EndBlock - the file separator that closes a frame, followed by a carriage return
+	EndBlock byte = 0x1c
+	// CarriageReturn - the last byte of a frame
+	CarriageReturn byte = 0x0d
+)
+
+// DefaultMaxFrameSize - the largest frame we read unless told otherwise, which leaves room for the
+// odd base64 encoded PDF in an OBX
+const DefaultMaxFrameSize = 16 << 20
+
+var (
+	// ErrFrameTooLarge - the frame is bigger than the maximum we were willing to read
+	ErrFrameTooLarge = errors.New("mllp frame too large")
+	// ErrInvalidFrame - the bytes on the wire aren't an MLLP frame
+	ErrInvalidFrame = errors.New("invalid mllp frame")
+)
+
+// ReadFrame - reads the next frame and returns the message inside it. anything in front of the
+// start block is discarded, since some senders put line breaks between frames
+func ReadFrame(r *bufio.Reader, maxFrameSize int) ([]byte, error) {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == StartBlock {
+			break
+		}
+	}
+	var frame bytes.Buffer
+	for {
+		chunk, err := r.ReadSlice(EndBlock)
+		if frame.Len()+len(chunk) > maxFrameSize+1 {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, maxFrameSize)
+		}
+		frame.Write(chunk)
+		if err == nil {
+			break
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: the connection closed in the middle of a frame", ErrInvalidFrame)
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+	message := frame.Bytes()[:frame.Len()-1]
+	if bytes.IndexByte(message, StartBlock) >= 0 {
+		return nil, fmt.Errorf("%w: start block inside a frame", ErrInvalidFrame)
+	}
+	// only take the carriage return when it's already arrived, so we never wait on a sender that
+	// left it off. if it turns up later the next ReadFrame skips it on the way to the start block
+	if r.Buffered() > 0 {
+		if next, _ := r.Peek(1); len(next) == 1 && next[0] == CarriageReturn {
+			_, _ = r.ReadByte()
+		}
+	}
+	return message, nil
+}
+
+// WriteFrame - wraps the message in a frame and writes it in a single write
+func WriteFrame(w io.Writer, message []byte) error {
+	frame := make([]byte, 0, len(message)+3)
+	frame = append(frame, StartBlock)
+	frame = append(frame, message...)
+	frame = append(frame, EndBlock, CarriageReturn)
+	_, err := w.Write(frame)
+	return err
+}
@@ -0,0 +1,61 @@
+package mllp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadFrame(t *testing.T) {
+	input := "\r\n\x0bMSH|^~\\&|A\rPID|1\x1c\r\x0bMSH|^~\\&|B\x1c\x0bMSH|^~\\&|C\x1c\r"
+	// a byte at a time, so frames and their end blocks arrive in pieces
+	reader := bufio.NewReader(iotest.OneByteReader(strings.NewReader(input)))
+	for _, expected := range []string{"MSH|^~\\&|A\rPID|1", "MSH|^~\\&|B", "MSH|^~\\&|C"} {
+		frame, err := ReadFrame(reader, 0)
+		if err != nil {
+			t.Fatal("error should be nil", err)
+		}
+		if string(frame) != expected {
+			t.Logf("expected %q but got %q", expected, frame)
+			t.Fail()
+		}
+	}
+}
+
+func TestReadFrame_Errors(t *testing.T) {
+	cases := []struct {
+		name, input  string
+		maxFrameSize int
+		err          error
+	}{
+		{"too large", "\x0b0123456789\x1c\r", 5, ErrFrameTooLarge},
+		{"unterminated", "\x0bMSH|^~\\&|A", 0, ErrInvalidFrame},
+		{"start block inside", "\x0bMSH\x0bMSH\x1c\r", 0, ErrInvalidFrame},
+	}
+	for _, c := range cases {
+		_, err := ReadFrame(bufio.NewReader(strings.NewReader(c.input)), c.maxFrameSize)
+		if !errors.Is(err, c.err) {
+			t.Logf("%s: expected %v but got %v", c.name, c.err, err)
+			t.Fail()
+		}
+	}
+	// exactly at the limit is fine
+	if frame, err := ReadFrame(bufio.NewReader(strings.NewReader("\x0b01234\x1c\r")), 5); err != nil || string(frame) != "01234" {
+		t.Logf("expected 01234 but got %q, %v", frame, err)
+		t.Fail()
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteFrame(&buffer, []byte("MSH|^~\\&")); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if buffer.String() != "\x0bMSH|^~\\&\x1c\r" {
+		t.Logf("unexpected frame %q", buffer.String())
+		t.Fail()
+	}
+}
@@ -0,0 +1,379 @@
+package mllp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// acknowledgment codes for the original acknowledgment mode, sent back in MSA-1
+const (
+	// ApplicationAccept - the message was received and processed
+	ApplicationAccept = hl7Utilities.AckApplicationAccept
+	// ApplicationError - the message was received, but processing it failed
+	ApplicationError = hl7Utilities.AckApplicationError
+	// ApplicationReject - the message was refused, because it couldn't be parsed or the handler
+	// decided it should never be sent again as is
+	ApplicationReject = hl7Utilities.AckApplicationReject
+)
+
+var (
+	// ErrRejected - wrap this in the error a handler returns to answer AR rather than AE
+	ErrRejected = errors.New("message rejected")
+	// ErrServerClosed - returned by Serve and ListenAndServe after Shutdown or Close
+	ErrServerClosed = errors.New("mllp: server closed")
+)
+
+// Request - a message received over MLLP
+type Request struct {
+	Message    hl7Utilities.Hl7Message
+	Parsed     *hl7Utilities.ParsedMessage
+	RemoteAddr net.Addr
+}
+
+// Handler - processes the messages the server receives. returning nil accepts the message with an
+// AA, an error wrapping ErrRejected rejects it with an AR and anything else is an AE. the error text
+// goes back to the sender in MSA-3 and an ERR segment
+type Handler interface {
+	HandleMessage(ctx context.Context, request *Request) error
+}
+
+// HandlerFunc - lets an ordinary function be a [Handler]
+type HandlerFunc func(ctx context.Context, request *Request) error
+
+// HandleMessage - calls the function
+func (f HandlerFunc) HandleMessage(ctx context.Context, request *Request) error {
+	return f(ctx, request)
+}
+
+// Server - accepts MLLP connections and answers every message with an ACK. messages on a single
+// connection are handled one at a time in the order they arrive, since MLLP senders wait for each
+// ACK before sending the next message
+type Server struct {
+	// Addr - the TCP address to listen on for ListenAndServe, like ":2575"
+	Addr    string
+	Handler Handler
+	// ReadTimeout - how long a connection can go without sending a complete frame before we close
+	// it. zero means no limit
+	ReadTimeout time.Duration
+	// WriteTimeout - how long we wait to send an ACK. zero means no limit
+	WriteTimeout time.Duration
+	// MaxFrameSize - the largest message we accept, DefaultMaxFrameSize when it's zero. a sender that
+	// goes over is disconnected, since there's no way to find the next frame reliably
+	MaxFrameSize int
+	// ErrorLog - where connection errors go, the standard logger when it's nil
+	ErrorLog *log.Logger
+
+	mu          sync.Mutex
+	listeners   map[net.Listener]struct{}
+	connections map[*serverConnection]struct{}
+	inShutdown  bool
+	cancel      context.CancelFunc
+	baseContext context.Context
+}
+
+// serverConnection - a connection and whether it's waiting for the next frame, which is when it's
+// safe for Shutdown to close it
+type serverConnection struct {
+	net.Conn
+	idle   bool
+	closed bool
+}
+
+// ListenAndServe - listens on Addr and serves connections until the server is shut down
+func (s *Server) ListenAndServe() error {
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve - accepts connections on the listener, handling each one on its own goroutine, until the
+// server is shut down. the listener is closed when Serve returns
+func (s *Server) Serve(listener net.Listener) error {
+	if !s.trackListener(listener) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(listener)
+	var retryDelay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// back off the same way net/http does, rather than spinning
+				if retryDelay == 0 {
+					retryDelay = 5 * time.Millisecond
+				} else if retryDelay *= 2; retryDelay > time.Second {
+					retryDelay = time.Second
+				}
+				s.logf("mllp: accept error: %v; retrying in %v", err, retryDelay)
+				time.Sleep(retryDelay)
+				continue
+			}
+			return err
+		}
+		retryDelay = 0
+		connection := &serverConnection{Conn: conn, idle: true}
+		if !s.trackConnection(connection) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConnection(connection)
+	}
+}
+
+// Shutdown - stops accepting connections, closes the ones waiting for a message, and waits for the
+// ones handling a message to send their ACK and finish. if the context ends first the remaining
+// connections are closed and its error is returned
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	s.closeListenersLocked()
+	s.mu.Unlock()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConnections() {
+			s.cancelHandlers()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close - stops the server immediately, closing every listener and connection. handlers that are
+// running have their context cancelled
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.inShutdown = true
+	s.closeListenersLocked()
+	for c := range s.connections {
+		c.closed = true
+		c.Close()
+		delete(s.connections, c)
+	}
+	s.mu.Unlock()
+	s.cancelHandlers()
+	return nil
+}
+
+// serveConnection - reads frames from the connection and answers each one until it closes
+func (s *Server) serveConnection(c *serverConnection) {
+	defer func() {
+		c.Close()
+		s.untrackConnection(c)
+	}()
+	reader := bufio.NewReader(c)
+	for {
+		if !s.setIdle(c, true) {
+			return
+		}
+		if s.ReadTimeout > 0 {
+			_ = c.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		frame, err := ReadFrame(reader, s.MaxFrameSize)
+		if !s.setIdle(c, false) {
+			// Shutdown closed the connection while we were waiting, so the sender never got an ACK
+			// for this and will send it again
+			return
+		}
+		if err != nil {
+			var netErr net.Error
+			// closing the connection or going quiet for too long is how a sender says goodbye, so
+			// only anything else is worth logging
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+				s.logf("mllp: %s: %v", c.RemoteAddr(), err)
+			}
+			return
+		}
+		ack := s.handleFrame(c, frame)
+		if s.WriteTimeout > 0 {
+			_ = c.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+		}
+		if err := WriteFrame(c, []byte(ack)); err != nil {
+			s.logf("mllp: %s: unable to send the ACK: %v", c.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handleFrame - parses the message and hands it to the handler, returning the ACK to send back
+func (s *Server) handleFrame(c *serverConnection, frame []byte) string {
+	message := hl7Utilities.Hl7Message{RawMessage: string(frame)}
+	if _, err := message.Preprocess(); err != nil {
+		return s.buildAck(message, ApplicationReject, err.Error())
+	}
+	parsed, err := message.Parse()
+	if err != nil {
+		return s.buildAck(message, ApplicationReject, err.Error())
+	}
+	handler := s.Handler
+	if handler == nil {
+		return s.buildAck(message, ApplicationReject, "no handler for messages")
+	}
+	if err := s.callHandler(handler, &Request{Message: message, Parsed: parsed, RemoteAddr: c.RemoteAddr()}); err != nil {
+		if errors.Is(err, ErrRejected) {
+			return s.buildAck(message, ApplicationReject, err.Error())
+		}
+		return s.buildAck(message, ApplicationError, err.Error())
+	}
+	return s.buildAck(message, ApplicationAccept, "")
+}
+
+// callHandler - runs the handler, turning a panic into an AE so one bad message can't take the
+// whole server down
+func (s *Server) callHandler(handler Handler, request *Request) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("mllp: handler panicked: %v", r)
+			err = errors.New("internal error")
+		}
+	}()
+	return handler.HandleMessage(s.context(), request)
+}
+
+// buildAck - an original mode ACK for the message. anything other than an AA carries the text in an
+// ERR segment, as well as MSA-3 for receivers that only look there
+func (s *Server) buildAck(message hl7Utilities.Hl7Message, code, text string) string {
+	var errs []hl7Utilities.AckError
+	if code != ApplicationAccept {
+		errs = append(errs, hl7Utilities.AckError{Code: hl7Utilities.ErrorCodeApplicationInternal, Text: text})
+	}
+	return hl7Utilities.GenerateAck(message, code, errs).RawMessage
+}
+
+// context - the context handlers run with, which Close cancels
+func (s *Server) context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.baseContext == nil {
+		s.baseContext, s.cancel = context.WithCancel(context.Background())
+	}
+	return s.baseContext
+}
+
+// cancelHandlers - cancels the context of any handler still running
+func (s *Server) cancelHandlers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// setIdle - marks the connection as waiting for a frame or not, returning false when the server has
+// closed it or is shutting down and it should stop
+func (s *Server) setIdle(c *serverConnection, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed || (idle && s.inShutdown) {
+		return false
+	}
+	c.idle = idle
+	return true
+}
+
+// closeIdleConnections - closes the connections waiting for a frame, returning true once there are
+// none left at all
+func (s *Server) closeIdleConnections() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.connections {
+		if c.idle {
+			c.closed = true
+			c.Close()
+			delete(s.connections, c)
+		}
+	}
+	return len(s.connections) == 0
+}
+
+// closeListenersLocked - closes every listener. s.mu must be held
+func (s *Server) closeListenersLocked() {
+	for l := range s.listeners {
+		l.Close()
+		delete(s.listeners, l)
+	}
+}
+
+// shuttingDown - true once Shutdown or Close has been called
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+// trackListener - remembers the listener so Shutdown can close it, returning false if we're already
+// shutting down
+func (s *Server) trackListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// untrackListener - forgets the listener and closes it
+func (s *Server) untrackListener(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l.Close()
+	delete(s.listeners, l)
+}
+
+// trackConnection - remembers the connection so Shutdown can wait for it, returning false if we're
+// already shutting down
+func (s *Server) trackConnection(c *serverConnection) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return false
+	}
+	if s.connections == nil {
+		s.connections = make(map[*serverConnection]struct{})
+	}
+	s.connections[c] = struct{}{}
+	return true
+}
+
+// untrackConnection - forgets the connection once it's finished
+func (s *Server) untrackConnection(c *serverConnection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.connections, c)
+}
+
+// logf - writes to the error log
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
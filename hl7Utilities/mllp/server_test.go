@@ -0,0 +1,264 @@
+package mllp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+const inboundMessage = "MSH|^~\\&|LAB|LAB FACILITY|EHR|EHR FACILITY|20220802003337-0500||ORU^R01^ORU_R01|CTRL123|P|2.5.1\r" +
+	"PID|1||M177323145\r" +
+	"OBX|1|ST|code||value"
+
+// startServer - runs the server on a loopback port, returning its address
+func startServer(t *testing.T, server *Server) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("unable to listen", err)
+	}
+	if server.ErrorLog == nil {
+		server.ErrorLog = log.New(io.Discard, "", 0)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+// exchange - sends a message over the connection and returns the ACK
+func exchange(t *testing.T, conn net.Conn, reader *bufio.Reader, message string) *hl7Utilities.ParsedMessage {
+	t.Helper()
+	if err := WriteFrame(conn, []byte(message)); err != nil {
+		t.Fatal("unable to send", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	frame, err := ReadFrame(reader, 0)
+	if err != nil {
+		t.Fatal("unable to read the ACK", err)
+	}
+	ack, err := hl7Utilities.ParseMessage(string(frame))
+	if err != nil {
+		t.Fatalf("unable to parse the ACK %q: %v", frame, err)
+	}
+	return ack
+}
+
+func TestServer_Acks(t *testing.T) {
+	received := make(chan *Request, 10)
+	server := &Server{Handler: HandlerFunc(func(ctx context.Context, request *Request) error {
+		received <- request
+		switch request.Parsed.Segment("PID", 0).Field(3).Value() {
+		case "ERROR":
+			return fmt.Errorf("unable to store the result")
+		case "REJECT":
+			return fmt.Errorf("%w: unknown patient", ErrRejected)
+		case "PANIC":
+			panic("oops")
+		}
+		return nil
+	})}
+	conn, err := net.Dial("tcp", startServer(t, server))
+	if err != nil {
+		t.Fatal("unable to connect", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	ack := exchange(t, conn, reader, inboundMessage)
+	request := <-received
+	if request.Parsed.Segment("OBX", 0).Field(5).Value() != "value" || request.Message.RawMessage != inboundMessage {
+		t.Log("the handler should get the parsed message")
+		t.Fail()
+	}
+	cases := []struct{ specification, expected string }{
+		{"MSH-3", "EHR"},
+		{"MSH-4", "EHR FACILITY"},
+		{"MSH-5", "LAB"},
+		{"MSH-6", "LAB FACILITY"},
+		{"MSH-9", "ACK^R01^ACK"},
+		{"MSH-11", "P"},
+		{"MSH-12", "2.5.1"},
+		{"MSA-1", "AA"},
+		{"MSA-2", "CTRL123"},
+	}
+	for _, c := range cases {
+		value, err := ack.GetRaw(c.specification)
+		if err != nil || *value != c.expected {
+			t.Logf("%s should be '%s' but got %v, %v", c.specification, c.expected, value, err)
+			t.Fail()
+		}
+	}
+	if controlId, _ := ack.GetRaw("MSH-10"); *controlId == "" || *controlId == "CTRL123" {
+		t.Logf("the ACK should have its own control ID but got '%s'", *controlId)
+		t.Fail()
+	}
+
+	// the rest go over the same connection
+	responses := []struct{ patient, code, text string }{
+		{"ERROR", "AE", "unable to store the result"},
+		{"REJECT", "AR", "message rejected: unknown patient"},
+		{"PANIC", "AE", "internal error"},
+	}
+	for _, r := range responses {
+		ack := exchange(t, conn, reader, strings.Replace(inboundMessage, "M177323145", r.patient, 1))
+		<-received
+		code, _ := ack.Get("MSA-1")
+		text, _ := ack.Get("MSA-3")
+		if *code != r.code || *text != r.text {
+			t.Logf("%s: expected %s '%s' but got %s '%s'", r.patient, r.code, r.text, *code, *text)
+			t.Fail()
+		}
+	}
+
+	// something that isn't HL7 at all is rejected without bothering the handler
+	ack = exchange(t, conn, reader, "hello")
+	if code, _ := ack.Get("MSA-1"); *code != "AR" {
+		t.Logf("expected AR but got %s", *code)
+		t.Fail()
+	}
+	if len(received) != 0 {
+		t.Log("the handler shouldn't see a message that can't be parsed")
+		t.Fail()
+	}
+}
+
+func TestServer_MaxFrameSize(t *testing.T) {
+	server := &Server{MaxFrameSize: 32, Handler: HandlerFunc(func(context.Context, *Request) error { return nil })}
+	conn, err := net.Dial("tcp", startServer(t, server))
+	if err != nil {
+		t.Fatal("unable to connect", err)
+	}
+	defer conn.Close()
+	if err := WriteFrame(conn, []byte(inboundMessage)); err != nil {
+		t.Fatal("unable to send", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ReadFrame(bufio.NewReader(conn), 0); !errors.Is(err, io.EOF) {
+		t.Logf("the server should hang up on a frame that's too large, but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestServer_ReadTimeout(t *testing.T) {
+	server := &Server{ReadTimeout: 50 * time.Millisecond, Handler: HandlerFunc(func(context.Context, *Request) error { return nil })}
+	conn, err := net.Dial("tcp", startServer(t, server))
+	if err != nil {
+		t.Fatal("unable to connect", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Logf("the server should hang up on an idle connection, but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &Server{Handler: HandlerFunc(func(context.Context, *Request) error {
+		close(started)
+		<-release
+		return nil
+	})}
+	address := startServer(t, server)
+	busy, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal("unable to connect", err)
+	}
+	defer busy.Close()
+	idle, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal("unable to connect", err)
+	}
+	defer idle.Close()
+	if err := WriteFrame(busy, []byte(inboundMessage)); err != nil {
+		t.Fatal("unable to send", err)
+	}
+	<-started
+
+	shutdown := make(chan error)
+	go func() { shutdown <- server.Shutdown(context.Background()) }()
+	// the idle connection is closed straight away
+	_ = idle.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := idle.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Logf("the idle connection should be closed, but got %v", err)
+		t.Fail()
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatal("Shutdown shouldn't return while a message is being handled", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// no new connections once we're shutting down
+	if conn, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+		conn.Close()
+		t.Log("the listener should be closed")
+		t.Fail()
+	}
+	close(release)
+	_ = busy.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(busy)
+	frame, err := ReadFrame(reader, 0)
+	if err != nil || !strings.Contains(string(frame), "MSA|AA|CTRL123") {
+		t.Logf("the busy connection should still get its ACK, but got %q, %v", frame, err)
+		t.Fail()
+	}
+	if err := <-shutdown; err != nil {
+		t.Log("Shutdown should succeed", err)
+		t.Fail()
+	}
+	if _, err := reader.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Logf("the busy connection should be closed after its ACK, but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	server := &Server{Handler: HandlerFunc(func(ctx context.Context, _ *Request) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})}
+	conn, err := net.Dial("tcp", startServer(t, server))
+	if err != nil {
+		t.Fatal("unable to connect", err)
+	}
+	defer conn.Close()
+	if err := WriteFrame(conn, []byte(inboundMessage)); err != nil {
+		t.Fatal("unable to send", err)
+	}
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Logf("expected the deadline to pass but got %v", err)
+		t.Fail()
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Log("the handler's context should be cancelled")
+		t.Fail()
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("unable to listen", err)
+	}
+	if err := server.Serve(listener); !errors.Is(err, ErrServerClosed) {
+		t.Logf("a closed server shouldn't serve again, but got %v", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,440 @@
+package hl7Utilities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParsedMessage - an HL7 message that has been split once into its segments, fields, repetitions,
+// components and subcomponents, using the delimiters the message declares in its MSH header. values
+// are kept exactly as they appear in the message, escape sequences and all
+type ParsedMessage struct {
+	Delimiters Delimiters
+	Segments   []*ParsedSegment
+}
+
+// ParsedSegment - a single segment, like PID or OBX. Fields[0] holds field 1, so use Field(n) to
+// look fields up by their HL7 position
+type ParsedSegment struct {
+	Name   string
+	Fields []*Field
+}
+
+// Field - a field and all of its repetitions. a field that doesn't repeat has exactly one
+type Field struct {
+	Repetitions []*Repetition
+}
+
+// Repetition - one occurrence of a field, split into its components
+type Repetition struct {
+	Components []*Component
+}
+
+// Component - one component of a field, split into its subcomponents
+type Component struct {
+	Subcomponents []string
+}
+
+// Parse - splits the message into a [ParsedMessage] using the delimiters found by Preprocess
+func (message Hl7Message) Parse() (*ParsedMessage, error) {
+	msh, err := message.Preprocess()
+	if err != nil {
+		return nil, err
+	}
+	delimiters, err := msh.Delimiters()
+	if err != nil {
+		return nil, err
+	}
+	parsed := &ParsedMessage{Delimiters: delimiters}
+	for _, s := range message.MessageSegments() {
+		// skip the blank lines people like to leave between segments
+		if len(strings.TrimSpace(s)) == 0 {
+			continue
+		}
+		// only trim the front of the segment, trailing spaces can be part of the last value
+		segment, err := parseSegment(strings.TrimLeftFunc(s, unicode.IsSpace), delimiters)
+		if err != nil {
+			return nil, err
+		}
+		parsed.Segments = append(parsed.Segments, segment)
+	}
+	return parsed, nil
+}
+
+// ParseMessage - convenience wrapper to parse a raw HL7 string in one step
+func ParseMessage(rawMessage string) (*ParsedMessage, error) {
+	return Hl7Message{RawMessage: rawMessage}.Parse()
+}
+
+// ParseSegment - parses a single raw segment with delimiters taken from its message, for callers
+// working through a message a segment at a time
+func ParseSegment(rawSegment string, delimiters Delimiters) (*ParsedSegment, error) {
+	return parseSegment(rawSegment, delimiters)
+}
+
+// isHeaderSegment - MSH and the batch headers carry the field separator and encoding characters
+// in fields 1 and 2, so they can't be split like any other segment
+func isHeaderSegment(name string) bool {
+	return name == "MSH" || name == "FHS" || name == "BHS"
+}
+
+// parseSegment - splits a single raw segment into its fields
+func parseSegment(rawSegment string, delimiters Delimiters) (*ParsedSegment, error) {
+	parts := strings.Split(rawSegment, delimiters.Field)
+	name := parts[0]
+	if len(name) == 0 {
+		return nil, fmt.Errorf("%w: segment has no name: %s", ErrInvalidMessage, rawSegment)
+	}
+	segment := &ParsedSegment{Name: name}
+	parts = parts[1:]
+	if isHeaderSegment(name) {
+		// field 1 is the separator itself and field 2 holds the encoding characters, neither of
+		// which should be split any further
+		segment.Fields = append(segment.Fields, newPrimitiveField(delimiters.Field))
+		if len(parts) > 0 {
+			segment.Fields = append(segment.Fields, newPrimitiveField(parts[0]))
+			parts = parts[1:]
+		}
+	}
+	for _, p := range parts {
+		segment.Fields = append(segment.Fields, parseField(p, delimiters))
+	}
+	return segment, nil
+}
+
+// parseField - splits a field into its repetitions, components and subcomponents
+func parseField(rawField string, delimiters Delimiters) *Field {
+	field := &Field{}
+	for _, r := range strings.Split(rawField, delimiters.Repetition) {
+		repetition := &Repetition{}
+		for _, c := range strings.Split(r, delimiters.Component) {
+			repetition.Components = append(
+				repetition.Components,
+				&Component{Subcomponents: strings.Split(c, delimiters.Subcomponent)},
+			)
+		}
+		field.Repetitions = append(field.Repetitions, repetition)
+	}
+	return field
+}
+
+// maxPosition - the highest field, component or subcomponent position we'll accept when building a
+// message from a path, like Set does, or from another format, like JSON or XML, which name positions
+// rather than separating them. no segment or data type comes close, and without a limit a single
+// position could have us fill in millions of empty values
+const maxPosition = 999
+
+// newPrimitiveField - a field holding a single value that must never be split
+func newPrimitiveField(value string) *Field {
+	return &Field{
+		Repetitions: []*Repetition{{Components: []*Component{{Subcomponents: []string{value}}}}},
+	}
+}
+
+// SegmentsNamed - returns every segment with the given name, in message order
+func (m *ParsedMessage) SegmentsNamed(name string) []*ParsedSegment {
+	var segments []*ParsedSegment
+	if m == nil {
+		return segments
+	}
+	for _, s := range m.Segments {
+		if s.Name == name {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// Segment - returns an occurrence of the named segment, counting from 0, or nil if the message
+// doesn't have that many
+func (m *ParsedMessage) Segment(name string, occurrence int) *ParsedSegment {
+	segments := m.SegmentsNamed(name)
+	if occurrence < 0 || occurrence >= len(segments) {
+		return nil
+	}
+	return segments[occurrence]
+}
+
+// Field - returns the field at the HL7 position, which starts at 1, or nil if the segment
+// doesn't have that many fields
+func (s *ParsedSegment) Field(position int) *Field {
+	if s == nil || position < 1 || position > len(s.Fields) {
+		return nil
+	}
+	return s.Fields[position-1]
+}
+
+// FieldCount - the number of fields present in the segment
+func (s *ParsedSegment) FieldCount() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.Fields)
+}
+
+// Repetition - returns a repetition of the field, counting from 0, or nil if it's missing
+func (f *Field) Repetition(index int) *Repetition {
+	if f == nil || index < 0 || index >= len(f.Repetitions) {
+		return nil
+	}
+	return f.Repetitions[index]
+}
+
+// Value - the first primitive value in the field, which is all most callers want
+func (f *Field) Value() string {
+	return f.Repetition(0).Value()
+}
+
+// Component - returns the component at the HL7 position, which starts at 1, or nil if it's missing
+func (r *Repetition) Component(position int) *Component {
+	if r == nil || position < 1 || position > len(r.Components) {
+		return nil
+	}
+	return r.Components[position-1]
+}
+
+// Value - the first primitive value in the repetition
+func (r *Repetition) Value() string {
+	return r.Component(1).Value()
+}
+
+// Subcomponent - returns the subcomponent at the HL7 position, which starts at 1, or an empty
+// string if it's missing
+func (c *Component) Subcomponent(position int) string {
+	if c == nil || position < 1 || position > len(c.Subcomponents) {
+		return ""
+	}
+	return c.Subcomponents[position-1]
+}
+
+// Value - the first subcomponent of the component
+func (c *Component) Value() string {
+	return c.Subcomponent(1)
+}
+
+// Get - looks up a value with a terser specification, the same way [Hl7Message.Get] does, without
+// having to parse the message again. group paths like /PATIENT_RESULT/ORDER_OBSERVATION(1)/OBX-5
+// work here too, using the structure picked by Structure
+func (m *ParsedMessage) Get(specification string) (*string, error) {
+	return m.get(specification, true)
+}
+
+// GetRaw - same as Get, but returns the value exactly as it appears in the message
+func (m *ParsedMessage) GetRaw(specification string) (*string, error) {
+	return m.get(specification, false)
+}
+
+// ValidateSpecification - checks a terser specification, like PID-3-1 or a group path like
+// /PATIENT_RESULT/ORDER_OBSERVATION/OBX-5, is one Get can read, without needing a message to read it
+// from. it returns the same ErrInvalidSpecification Get would
+func ValidateSpecification(specification string) error {
+	if len(specification) == 0 {
+		return fmt.Errorf("%w: empty specification", ErrInvalidSpecification)
+	}
+	var terserSpec TerserSpecification
+	var err error
+	if strings.HasPrefix(specification, "/") {
+		var parsed groupPath
+		parsed, err = parseGroupPath(specification)
+		terserSpec = parsed.terserSpec
+	} else {
+		terserSpec, err = parseTerserSpecification(specification)
+	}
+	if err != nil {
+		return err
+	}
+	if len(terserSpec.FieldIndices) > 3 {
+		return fmt.Errorf("%w: %s is nested too deeply", ErrInvalidSpecification, specification)
+	}
+	return nil
+}
+
+// get - does the actual work of looking up the value for a specification
+func (m *ParsedMessage) get(specification string, decode bool) (*string, error) {
+	if len(specification) == 0 {
+		return nil, fmt.Errorf("%w: empty specification", ErrInvalidSpecification)
+	}
+	var segment *ParsedSegment
+	var terserSpec TerserSpecification
+	if strings.HasPrefix(specification, "/") {
+		structure, err := m.Structure()
+		if err != nil {
+			return nil, err
+		}
+		segment, terserSpec, err = findGroupPathSegment(m.Groups(structure), specification)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		terserSpec, err = parseTerserSpecification(specification)
+		if err != nil {
+			return nil, err
+		}
+		segment = m.findSegment(terserSpec.Segment, terserSpec.SetId)
+		if segment == nil {
+			return nil, fmt.Errorf("%w: no segment matching %s", ErrSegmentNotFound, specification)
+		}
+	}
+	return segment.valueAt(terserSpec, specification, m.Delimiters, decode)
+}
+
+// valueAt - pulls the value the field indices of a specification point to out of the segment
+func (s *ParsedSegment) valueAt(
+	terserSpec TerserSpecification,
+	specification string,
+	delimiters Delimiters,
+	decode bool,
+) (*string, error) {
+	if len(terserSpec.FieldIndices) > 3 {
+		return nil, fmt.Errorf("%w: %s is nested too deeply", ErrInvalidSpecification, specification)
+	}
+	notPresent := func(what string) (*string, error) {
+		return nil, fmt.Errorf("%w: %s isn't present for %s", ErrFieldOutOfRange, what, specification)
+	}
+	fieldIndex := terserSpec.FieldIndices[0]
+	field := s.Field(int(fieldIndex.Index))
+	if field == nil {
+		return notPresent("the field")
+	}
+	repetition := field.Repetition(int(fieldIndex.Repeat))
+	if repetition == nil {
+		return notPresent("the repetition")
+	}
+	value := repetition.encode(delimiters, false)
+	if len(terserSpec.FieldIndices) > 1 {
+		component := repetition.Component(int(terserSpec.FieldIndices[1].Index))
+		if component == nil {
+			return notPresent("the component")
+		}
+		value = component.encode(delimiters, false)
+		if len(terserSpec.FieldIndices) > 2 {
+			position := int(terserSpec.FieldIndices[2].Index)
+			if position > len(component.Subcomponents) {
+				return notPresent("the subcomponent")
+			}
+			value = component.Subcomponents[position-1]
+		}
+	}
+	if decode && !delimiters.containsDelimiter(value) {
+		value = delimiters.Decode(value)
+	}
+	return &value, nil
+}
+
+// Set - writes a primitive value into the message at the terser specification, escaping it against
+// our delimiters. any segment, field, repetition, component or subcomponent along the way that's
+// missing gets created, so Set("PID-11(1)-4", "MN") works even when PID-11 only has one repetition.
+// missing segments are added after the last segment with the same name, or at the end of the message
+func (m *ParsedMessage) Set(specification string, value string) error {
+	terserSpec, err := parseTerserSpecification(specification)
+	if err != nil {
+		return err
+	}
+	if len(terserSpec.FieldIndices) > 3 {
+		return fmt.Errorf("%w: %s is nested too deeply", ErrInvalidSpecification, specification)
+	}
+	for _, index := range terserSpec.FieldIndices {
+		if index.Index > maxPosition || index.Repeat > maxPosition {
+			return fmt.Errorf("%w: %s is past the last position we accept, %d", ErrInvalidSpecification, specification, maxPosition)
+		}
+	}
+	fieldIndex := terserSpec.FieldIndices[0]
+	if isHeaderSegment(terserSpec.Segment) && fieldIndex.Index <= 2 {
+		return fmt.Errorf(
+			"%w: %s-%d holds the message delimiters and can't be set",
+			ErrInvalidSpecification,
+			terserSpec.Segment,
+			fieldIndex.Index,
+		)
+	}
+	encoded := m.Delimiters.Encode(value)
+	segment := m.segmentForSet(terserSpec.Segment, terserSpec.SetId)
+	repetition := segment.ensureField(int(fieldIndex.Index)).ensureRepetition(int(fieldIndex.Repeat))
+	switch len(terserSpec.FieldIndices) {
+	case 1:
+		repetition.Components = []*Component{{Subcomponents: []string{encoded}}}
+	case 2:
+		component := repetition.ensureComponent(int(terserSpec.FieldIndices[1].Index))
+		component.Subcomponents = []string{encoded}
+	case 3:
+		component := repetition.ensureComponent(int(terserSpec.FieldIndices[1].Index))
+		position := int(terserSpec.FieldIndices[2].Index)
+		for len(component.Subcomponents) < position {
+			component.Subcomponents = append(component.Subcomponents, "")
+		}
+		component.Subcomponents[position-1] = encoded
+	}
+	return nil
+}
+
+// findSegment - finds the segment a specification points to the same way findSegment does for raw
+// segments, by its set ID, or by its position for segments that don't have set IDs
+func (m *ParsedMessage) findSegment(name string, setId int64) *ParsedSegment {
+	segments := m.SegmentsNamed(name)
+	if setId == 1 && len(segments) > 0 {
+		return segments[0]
+	}
+	for i, s := range segments {
+		if segmentNumber, err := strconv.ParseInt(s.Field(1).Value(), 10, 0); err == nil {
+			if segmentNumber == setId {
+				return s
+			}
+		} else if int64(i+1) == setId {
+			return s
+		}
+	}
+	return nil
+}
+
+// segmentForSet - finds the segment a specification points to, and creates it if it isn't there yet
+func (m *ParsedMessage) segmentForSet(name string, setId int64) *ParsedSegment {
+	if segment := m.findSegment(name, setId); segment != nil {
+		return segment
+	}
+	segments := m.SegmentsNamed(name)
+	segment := &ParsedSegment{Name: name}
+	if setId != 1 {
+		// give the new segment its set ID so we can find it again
+		segment.ensureField(1).Repetitions[0].Components[0].Subcomponents[0] = strconv.FormatInt(setId, 10)
+	}
+	// keep segments with the same name together
+	position := len(m.Segments)
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		for i, s := range m.Segments {
+			if s == last {
+				position = i + 1
+			}
+		}
+	}
+	m.Segments = append(m.Segments[:position], append([]*ParsedSegment{segment}, m.Segments[position:]...)...)
+	return segment
+}
+
+// ensureField - returns the field at the HL7 position, padding the segment with empty fields first
+// if it's too short
+func (s *ParsedSegment) ensureField(position int) *Field {
+	for len(s.Fields) < position {
+		s.Fields = append(s.Fields, newPrimitiveField(""))
+	}
+	return s.Fields[position-1]
+}
+
+// ensureRepetition - returns the repetition at the index, adding empty repetitions first if needed
+func (f *Field) ensureRepetition(index int) *Repetition {
+	for len(f.Repetitions) <= index {
+		f.Repetitions = append(f.Repetitions, &Repetition{Components: []*Component{{Subcomponents: []string{""}}}})
+	}
+	return f.Repetitions[index]
+}
+
+// ensureComponent - returns the component at the HL7 position, adding empty components first if needed
+func (r *Repetition) ensureComponent(position int) *Component {
+	for len(r.Components) < position {
+		r.Components = append(r.Components, &Component{Subcomponents: []string{""}})
+	}
+	return r.Components[position-1]
+}
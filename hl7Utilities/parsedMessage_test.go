@@ -0,0 +1,122 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHl7Message_Parse(t *testing.T) {
+	parsed, err := Hl7Message{RawMessage: simpleHl7Message}.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Delimiters != DefaultDelimiters {
+		t.Errorf("Parse() delimiters = %v, want %v", parsed.Delimiters, DefaultDelimiters)
+	}
+	var names []string
+	for _, s := range parsed.Segments {
+		names = append(names, s.Name)
+	}
+	wantNames := []string{"MSH", "SFT", "PID", "ORC", "OBR", "OBX", "NTE", "NTE", "SPM"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("Parse() segments = %v, want %v", names, wantNames)
+	}
+	// walk the tree and check some known values
+	msh := parsed.Segment("MSH", 0)
+	pid := parsed.Segment("PID", 0)
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"MSH-1", msh.Field(1).Value(), "|"},
+		{"MSH-2", msh.Field(2).Value(), "^~\\&"},
+		{"MSH-3-2", msh.Field(3).Repetition(0).Component(2).Value(), "2.16.840.1.113883.3.2.12.1"},
+		{"MSH-9-3", msh.Field(9).Repetition(0).Component(3).Value(), "ORU_R01"},
+		{"PID-3-4-2", pid.Field(3).Repetition(0).Component(4).Subcomponent(2), "2.16.840.1.113883.3.2.12.1.1"},
+		{"PID-5", pid.Field(5).Value(), "LASTNAME"},
+		{"PID-11(1)-1", pid.Field(11).Repetition(1).Value(), "STREET3"},
+		{"PID-11(1)-9", pid.Field(11).Repetition(1).Component(9).Value(), "COUNTY"},
+		{"NTE(1)-3", parsed.Segment("NTE", 1).Field(3).Value(), "PCR primer and probe set."},
+		{"missing field", pid.Field(99).Value(), ""},
+		{"missing repetition", pid.Field(11).Repetition(5).Value(), ""},
+		{"missing segment", parsed.Segment("ZZZ", 0).Field(1).Value(), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got = '%s', want '%s'", tt.got, tt.want)
+			}
+		})
+	}
+	if got := pid.FieldCount(); got != 35 {
+		t.Errorf("PID FieldCount() = %d, want 35", got)
+	}
+	if got := len(pid.Field(11).Repetitions); got != 2 {
+		t.Errorf("PID-11 repetitions = %d, want 2", got)
+	}
+}
+
+func TestParseMessage_customDelimiters(t *testing.T) {
+	raw := "MSH#*!\\$#SENDER*APP#FACILITY###20220802##ORU*R01*ORU_R01#1#P#2.5.1\r" +
+		"PID#1##ID1*^~*X$Y!ID2"
+	parsed, err := ParseMessage(raw)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	want := Delimiters{Field: "#", Component: "*", Repetition: "!", Escape: "\\", Subcomponent: "$"}
+	if parsed.Delimiters != want {
+		t.Errorf("ParseMessage() delimiters = %v, want %v", parsed.Delimiters, want)
+	}
+	pid3 := parsed.Segment("PID", 0).Field(3)
+	if got := pid3.Repetition(0).Component(2).Value(); got != "^~" {
+		t.Errorf("PID-3-2 = '%s', want '^~'", got)
+	}
+	if got := pid3.Repetition(0).Component(3).Subcomponent(2); got != "Y" {
+		t.Errorf("PID-3-3-2 = '%s', want 'Y'", got)
+	}
+	if got := pid3.Repetition(1).Value(); got != "ID2" {
+		t.Errorf("PID-3(1) = '%s', want 'ID2'", got)
+	}
+}
+
+func TestParsedMessage_Set(t *testing.T) {
+	parsed, err := ParseMessage(mshMessage + "\rNTE|1||first\rNTE|2||second\rSPM|1")
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	if err := parsed.Set("NTE(3)-3", "third"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := parsed.Set("SPM-4-2", "a^b"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	want := mshMessage + "\rNTE|1||first\rNTE|2||second\rNTE|3||third\rSPM|1|||^a\\S\\b\r"
+	if got := parsed.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	// positions past the limit would have us pad the segment out to them
+	if err := parsed.Set("SPM-1000", "x"); !errors.Is(err, ErrInvalidSpecification) {
+		t.Errorf("Set() error = %v, want %v", err, ErrInvalidSpecification)
+	}
+	if got := parsed.String(); got != want {
+		t.Errorf("String() after a rejected Set() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateSpecification(t *testing.T) {
+	valid := []string{"PID-3", "PID-3(1)-4-2", "NTE(2)-3", "/PATIENT_RESULT/ORDER_OBSERVATION(1)/OBX-5", "/.OBX(2)-5-1"}
+	for _, specification := range valid {
+		if err := ValidateSpecification(specification); err != nil {
+			t.Errorf("ValidateSpecification(%s) error = %v", specification, err)
+		}
+	}
+	// the group paths fail before there's a message to look the structure up in
+	invalid := []string{"", "pid-3", "PID", "PID-3-4-2-1", "/patient_result/OBX-5", "/PATIENT_RESULT(x)/OBX-5", "/PATIENT_RESULT/OBX", "/PATIENT_RESULT/OBX-5-1-1-1"}
+	for _, specification := range invalid {
+		if err := ValidateSpecification(specification); !errors.Is(err, ErrInvalidSpecification) {
+			t.Errorf("ValidateSpecification(%s) error = %v, want %v", specification, err, ErrInvalidSpecification)
+		}
+	}
+}
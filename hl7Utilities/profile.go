@@ -0,0 +1,769 @@
+package hl7Utilities
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the usage codes profiles add to the ones the standard uses
+const (
+	// UsageRequiredOrEmpty - RE, the field has to be sent whenever the sender has a value for it
+	UsageRequiredOrEmpty = "RE"
+)
+
+// Profile - a conformance profile from an implementation guide, which narrows down what the standard
+// allows for one kind of message, like the PHLabReport-NoAck profile for electronic lab reporting.
+// messages say which profiles they follow in MSH-21
+type Profile struct {
+	// Identifier - the name messages use for the profile in MSH-21-1, like PHLabReport-NoAck
+	Identifier string
+	// Oid - the OID messages can use for the profile in MSH-21-3 instead
+	Oid string
+	// Version and Structure - the kind of message the profile is for, like an ORU_R01 in 2.5.1
+	Version   string
+	Structure string
+	// Segments - the usage and cardinality of the segments and groups, in the order they were defined
+	Segments []*ProfileSegment
+	// Fields - the usage, cardinality and value sets of the fields and components
+	Fields []*ProfileField
+	// ValueSets - the value sets defined in the profile itself, by name. fields can also use HL7 tables
+	ValueSets map[string]*ValueSet
+}
+
+// ProfileSegment - what the profile says about a segment or group in the message structure
+type ProfileSegment struct {
+	// Path - the groups leading to the segment or group and then its name, separated by dots, like
+	// PATIENT_RESULT.PATIENT.PID. segments outside of any group are just their name
+	Path string
+	// Usage - R, RE, O or X
+	Usage string
+	// Min and Max - how many times it has to appear in each occurrence of the group around it, with a
+	// Max of zero meaning as often as you like
+	Min int
+	Max int
+}
+
+// Name - the name of the segment or group, the last part of its path
+func (s *ProfileSegment) Name() string {
+	return s.Path[strings.LastIndex(s.Path, ".")+1:]
+}
+
+// parent - the path of the group the segment or group is in, empty for the message itself
+func (s *ProfileSegment) parent() string {
+	if i := strings.LastIndex(s.Path, "."); i >= 0 {
+		return s.Path[:i]
+	}
+	return ""
+}
+
+// ProfileField - what the profile says about a field, or one component of a field
+type ProfileField struct {
+	// Location - like PID-8, or PID-3-5 for a component
+	Location  string
+	Segment   string
+	Field     int
+	Component int
+	// Usage - R, RE, O, X or C. conditional fields take TrueUsage when the predicate holds and
+	// FalseUsage when it doesn't
+	Usage      string
+	TrueUsage  string
+	FalseUsage string
+	Predicate  *Predicate
+	// Min and Max - how many repetitions the field needs, with a Max of zero meaning as many as you
+	// like. components don't repeat, so these are zero for them
+	Min int
+	Max int
+	// ValueSet - the name of a value set in the profile, or an HL7 table like HL70001. empty if the
+	// values aren't constrained
+	ValueSet string
+}
+
+// usage - the usage that applies to the field in the segment, working out the conditional ones
+func (f *ProfileField) usage(m *ParsedMessage, segment *ParsedSegment) string {
+	if f.Usage != UsageConditional {
+		return f.Usage
+	}
+	if f.Predicate.Holds(m, segment) {
+		return f.TrueUsage
+	}
+	return f.FalseUsage
+}
+
+// ValueSet - a list of codes a profile allows for a field
+type ValueSet struct {
+	Id string
+	// CodingSystems - the names CE, CWE and CNE values can give the value set in their coding system
+	// component. values from any other coding system aren't checked
+	CodingSystems []string
+	Codes         map[string]bool
+}
+
+// Predicate - the condition that decides whether a conditional field is required, like
+// `OBX-2 in NM,SN`. it's one of
+//
+//	<location> valued
+//	<location> not valued
+//	<location> in <code>,<code>...
+//	<location> not in <code>,<code>...
+//
+// where the location is a field or component, usually of the same segment
+type Predicate struct {
+	Location  string
+	Segment   string
+	Field     int
+	Component int
+	// Operator - valued, not valued, in or not in
+	Operator string
+	Values   []string
+}
+
+// String - the predicate the way it's written in a profile
+func (p *Predicate) String() string {
+	if len(p.Values) == 0 {
+		return p.Location + " " + p.Operator
+	}
+	return fmt.Sprintf("%s %s %s", p.Location, p.Operator, strings.Join(p.Values, ","))
+}
+
+// Holds - true when the predicate is true for the segment. locations in other segments are looked up
+// in the first of those segments in the message
+func (p *Predicate) Holds(m *ParsedMessage, segment *ParsedSegment) bool {
+	if segment == nil || segment.Name != p.Segment {
+		segment = m.Segment(p.Segment, 0)
+	}
+	value := ""
+	if segment != nil {
+		if field := segment.Field(p.Field); field != nil {
+			if r := field.Repetition(0); r != nil {
+				if p.Component > 0 {
+					value = r.Component(p.Component).Value()
+				} else {
+					value = r.Value()
+				}
+			}
+		}
+		value = m.Delimiters.Decode(value)
+	}
+	switch p.Operator {
+	case "valued":
+		return value != "" && value != explicitNull
+	case "not valued":
+		return value == "" || value == explicitNull
+	case "in", "not in":
+		found := false
+		for _, v := range p.Values {
+			found = found || v == value
+		}
+		return found == (p.Operator == "in")
+	}
+	return false
+}
+
+// ParseProfile - reads a profile from the tab separated layout the bundled profiles use. each line
+// starts with what it defines:
+//
+//	identifier	PHLabReport-NoAck
+//	oid	2.16.840.1.113883.9.11
+//	version	2.5.1
+//	structure	ORU_R01
+//	valueset	name	coding systems	codes
+//	segment	path	usage	cardinality
+//	field	location	usage	cardinality	value set	predicate
+//
+// with the coding systems and codes separated by commas, cardinalities like 1..1 or 0..*, usages like
+// R, RE, O, X or C(R/RE) for a conditional field, and - for a column that doesn't apply. lines
+// starting with # are comments
+func ParseProfile(definition string) (*Profile, error) {
+	profile := &Profile{ValueSets: make(map[string]*ValueSet)}
+	for i, line := range strings.Split(definition, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := profile.parseLine(strings.Split(line, "\t")); err != nil {
+			return nil, fmt.Errorf("unable to parse the profile, line %d: %w", i+1, err)
+		}
+	}
+	if profile.Identifier == "" {
+		return nil, fmt.Errorf("unable to parse the profile: it has no identifier")
+	}
+	if profile.Version == "" || profile.Structure == "" {
+		return nil, fmt.Errorf("unable to parse the %s profile: it needs a version and a structure", profile.Identifier)
+	}
+	for _, f := range profile.Fields {
+		if _, ok := profile.ValueSets[f.ValueSet]; f.ValueSet != "" && !ok && !strings.HasPrefix(f.ValueSet, "HL7") {
+			return nil, fmt.Errorf("unable to parse the %s profile: %s uses value set %s, which it doesn't define", profile.Identifier, f.Location, f.ValueSet)
+		}
+	}
+	return profile, nil
+}
+
+// parseLine - reads a single line of a profile
+func (p *Profile) parseLine(parts []string) error {
+	columns := map[string]int{
+		"identifier": 2, "oid": 2, "version": 2, "structure": 2, "valueset": 4, "segment": 4, "field": 6,
+	}
+	expected, ok := columns[parts[0]]
+	if !ok {
+		return fmt.Errorf("'%s' is not something a profile defines", parts[0])
+	}
+	if len(parts) != expected {
+		return fmt.Errorf("expected %d columns for %s but got %d", expected, parts[0], len(parts))
+	}
+	switch parts[0] {
+	case "identifier":
+		p.Identifier = parts[1]
+	case "oid":
+		p.Oid = parts[1]
+	case "version":
+		p.Version = parts[1]
+	case "structure":
+		p.Structure = parts[1]
+	case "valueset":
+		valueSet := &ValueSet{Id: parts[1], Codes: make(map[string]bool)}
+		if parts[2] != "-" {
+			valueSet.CodingSystems = strings.Split(parts[2], ",")
+		}
+		for _, code := range strings.Split(parts[3], ",") {
+			valueSet.Codes[code] = true
+		}
+		p.ValueSets[valueSet.Id] = valueSet
+	case "segment":
+		segment := &ProfileSegment{Path: parts[1], Usage: parts[2]}
+		switch segment.Usage {
+		case UsageRequired, UsageRequiredOrEmpty, UsageOptional, UsageNotSupported:
+		default:
+			return fmt.Errorf("'%s' is not a usage segments can have", segment.Usage)
+		}
+		var err error
+		if segment.Min, segment.Max, err = parseCardinality(parts[3]); err != nil {
+			return err
+		}
+		p.Segments = append(p.Segments, segment)
+	case "field":
+		field, err := parseProfileField(parts[1:])
+		if err != nil {
+			return err
+		}
+		p.Fields = append(p.Fields, field)
+	}
+	return nil
+}
+
+// parseProfileField - reads the columns of a field line
+func parseProfileField(parts []string) (*ProfileField, error) {
+	field := &ProfileField{Location: parts[0]}
+	var err error
+	if field.Segment, field.Field, field.Component, err = parseProfileLocation(parts[0]); err != nil {
+		return nil, err
+	}
+	if field.Usage, field.TrueUsage, field.FalseUsage, err = parseProfileUsage(parts[1]); err != nil {
+		return nil, err
+	}
+	if parts[2] != "-" {
+		if field.Min, field.Max, err = parseCardinality(parts[2]); err != nil {
+			return nil, err
+		}
+	}
+	if parts[3] != "-" {
+		field.ValueSet = parts[3]
+	}
+	if parts[4] != "-" {
+		if field.Predicate, err = parsePredicate(parts[4]); err != nil {
+			return nil, err
+		}
+	}
+	if (field.Usage == UsageConditional) != (field.Predicate != nil) {
+		return nil, fmt.Errorf("%s has to have a predicate when, and only when, it's conditional", field.Location)
+	}
+	return field, nil
+}
+
+// parseProfileUsage - reads a usage like RE, or C(R/RE) for a conditional one
+func parseProfileUsage(usage string) (string, string, string, error) {
+	switch usage {
+	case UsageRequired, UsageRequiredOrEmpty, UsageOptional, UsageNotSupported:
+		return usage, "", "", nil
+	}
+	if strings.HasPrefix(usage, "C(") && strings.HasSuffix(usage, ")") {
+		outcomes := strings.Split(usage[2:len(usage)-1], "/")
+		if len(outcomes) == 2 {
+			for _, o := range outcomes {
+				if _, _, _, err := parseProfileUsage(o); err != nil || o == "" {
+					return "", "", "", fmt.Errorf("'%s' is not a usage", usage)
+				}
+			}
+			return UsageConditional, outcomes[0], outcomes[1], nil
+		}
+	}
+	return "", "", "", fmt.Errorf("'%s' is not a usage", usage)
+}
+
+// parseCardinality - reads a cardinality like 1..1 or 0..*, with * giving a max of zero
+func parseCardinality(cardinality string) (int, int, error) {
+	bounds := strings.Split(cardinality, "..")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("'%s' is not a cardinality", cardinality)
+	}
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil || min < 0 {
+		return 0, 0, fmt.Errorf("'%s' is not a cardinality", cardinality)
+	}
+	if bounds[1] == "*" {
+		return min, 0, nil
+	}
+	max, err := strconv.Atoi(bounds[1])
+	if err != nil || max < min {
+		return 0, 0, fmt.Errorf("'%s' is not a cardinality", cardinality)
+	}
+	return min, max, nil
+}
+
+// parseProfileLocation - reads a location like PID-8 or PID-3-5
+func parseProfileLocation(location string) (string, int, int, error) {
+	parts := strings.Split(location, "-")
+	if len(parts) < 2 || len(parts) > 3 || len(parts[0]) != 3 {
+		return "", 0, 0, fmt.Errorf("'%s' is not a field or component", location)
+	}
+	positions := make([]int, 2)
+	for i, part := range parts[1:] {
+		position, err := strconv.Atoi(part)
+		if err != nil || position < 1 {
+			return "", 0, 0, fmt.Errorf("'%s' is not a field or component", location)
+		}
+		positions[i] = position
+	}
+	return parts[0], positions[0], positions[1], nil
+}
+
+// parsePredicate - reads a predicate like `OBX-2 in NM,SN`
+func parsePredicate(predicate string) (*Predicate, error) {
+	words := strings.Fields(predicate)
+	if len(words) < 2 {
+		return nil, fmt.Errorf("'%s' is not a predicate", predicate)
+	}
+	p := &Predicate{Location: words[0], Operator: strings.Join(words[1:], " ")}
+	var err error
+	if p.Segment, p.Field, p.Component, err = parseProfileLocation(p.Location); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.Operator == "valued", p.Operator == "not valued":
+	case len(words) == 3 && words[1] == "in", len(words) == 4 && words[1] == "not" && words[2] == "in":
+		p.Operator = strings.Join(words[1:len(words)-1], " ")
+		p.Values = strings.Split(words[len(words)-1], ",")
+	default:
+		return nil, fmt.Errorf("'%s' is not a predicate", predicate)
+	}
+	return p, nil
+}
+
+// profileFiles - the profiles we ship with, one file per profile named after its identifier, like
+// profiles/PHLabReport-NoAck.txt
+//
+//go:embed profiles
+var profileFiles embed.FS
+
+// Profiles - a set of profiles to pick from by the identifiers in MSH-21. the profiles we ship with
+// are always there, and others can be loaded on top of them
+type Profiles struct {
+	mu       sync.RWMutex
+	profiles []*Profile
+}
+
+// DefaultProfiles - the profiles ValidateProfile picks from. load profiles into it to have them used
+// everywhere
+var DefaultProfiles = NewProfiles()
+
+// NewProfiles - a set holding the profiles we ship with
+func NewProfiles() *Profiles {
+	profiles := &Profiles{}
+	files, err := profileFiles.ReadDir("profiles")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		definition, err := profileFiles.ReadFile(path.Join("profiles", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		profile, err := ParseProfile(string(definition))
+		if err != nil {
+			// the files are embedded, so this can only be a mistake in one of them
+			panic(err)
+		}
+		profiles.Add(profile)
+	}
+	return profiles
+}
+
+// Add - adds a profile to the set, replacing any profile with the same identifier
+func (p *Profiles) Add(profile *Profile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, existing := range p.profiles {
+		if existing.Identifier == profile.Identifier {
+			p.profiles[i] = profile
+			return
+		}
+	}
+	p.profiles = append(p.profiles, profile)
+}
+
+// LoadFile - reads a profile from a file and adds it to the set
+func (p *Profiles) LoadFile(filePath string) error {
+	definition, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	profile, err := ParseProfile(string(definition))
+	if err != nil {
+		return fmt.Errorf("%s: %w", filePath, err)
+	}
+	p.Add(profile)
+	return nil
+}
+
+// LoadDirectory - loads every .txt file in the directory as a profile, see LoadFile
+func (p *Profiles) LoadDirectory(directory string) error {
+	files, err := filepath.Glob(filepath.Join(directory, "*.txt"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := p.LoadFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup - the profile with the identifier or OID, or nil if there isn't one
+func (p *Profiles) Lookup(identifier string) *Profile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, profile := range p.profiles {
+		if identifier != "" && (profile.Identifier == identifier || profile.Oid == identifier) {
+			return profile
+		}
+	}
+	return nil
+}
+
+// ForMessage - the first profile the message names in MSH-21 that we have, matching either the
+// entity identifier or the OID in its universal ID, or nil if there isn't one
+func (p *Profiles) ForMessage(m *ParsedMessage) *Profile {
+	msh := m.Segment("MSH", 0)
+	if msh == nil || msh.Field(21) == nil {
+		return nil
+	}
+	for _, r := range msh.Field(21).Repetitions {
+		for _, position := range []int{1, 3} {
+			if profile := p.Lookup(m.Delimiters.Decode(r.Component(position).Value())); profile != nil {
+				return profile
+			}
+		}
+	}
+	return nil
+}
+
+// ProfileReport - the ways one message doesn't follow its profile
+type ProfileReport struct {
+	Profile *Profile
+	// ControlId - the message's MSH-10, to tell the reports for a batch of messages apart
+	ControlId string
+	Issues    []ValidationIssue
+}
+
+// Conforms - true when none of the issues are errors
+func (r *ProfileReport) Conforms() bool {
+	for _, i := range r.Issues {
+		if i.IsError() {
+			return false
+		}
+	}
+	return true
+}
+
+// String - the report for a person to read, a line about the message and then one for each issue
+func (r *ProfileReport) String() string {
+	var builder strings.Builder
+	result := "conforms"
+	if !r.Conforms() {
+		result = "does not conform"
+	}
+	fmt.Fprintf(&builder, "message %s %s to %s", r.ControlId, result, r.Profile.Identifier)
+	for _, i := range r.Issues {
+		fmt.Fprintf(&builder, "\n  %s %s %s", i.Severity, i.Code, i)
+	}
+	return builder.String()
+}
+
+// ValidateProfile - parses the message and checks it against its profile, see
+// [ParsedMessage.ValidateProfile]
+func (message Hl7Message) ValidateProfile() (*ProfileReport, error) {
+	parsed, err := message.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return parsed.ValidateProfile()
+}
+
+// ValidateProfile - checks the message against the profile it names in MSH-21, picked from
+// [DefaultProfiles]. the error wraps ErrProfileNotFound when it doesn't name one we have
+func (m *ParsedMessage) ValidateProfile() (*ProfileReport, error) {
+	profile := DefaultProfiles.ForMessage(m)
+	if profile == nil {
+		identifiers := ""
+		if msh := m.Segment("MSH", 0); msh != nil {
+			identifiers = msh.Field(21).Value()
+		}
+		return nil, fmt.Errorf("%w: '%s'", ErrProfileNotFound, identifiers)
+	}
+	return profile.Validate(m), nil
+}
+
+// Validate - checks the message against the profile, looking values up in [DefaultTables]
+func (p *Profile) Validate(m *ParsedMessage) *ProfileReport {
+	return p.ValidateWithTables(m, DefaultTables)
+}
+
+// ValidateWithTables - checks the message against the profile, looking values up in the tables. the
+// message has to be the version and structure the profile is for, with the segments and groups the
+// profile requires, as many times as it allows, and none it doesn't support. the same goes for the
+// fields and components, whose values also have to come from their value sets.
+//
+// a field missing when the profile requires it is an error even if the standard says it's optional,
+// but only the ways the profile narrows down the standard are reported, so check the message with
+// Validate as well to find everything else
+func (p *Profile) ValidateWithTables(m *ParsedMessage, tables *Tables) *ProfileReport {
+	v := &profileValidator{validator: validator{message: m, tables: tables}, profile: p, occurrences: segmentOccurrences(m)}
+	report := &ProfileReport{Profile: p}
+	msh := m.Segment("MSH", 0)
+	if msh == nil {
+		v.add(ValidationIssue{
+			Location:    "MSH",
+			Segment:     "MSH",
+			Severity:    SeverityError,
+			Code:        ErrorCodeSegmentSequence,
+			Description: "the message does not start with an MSH segment",
+		})
+		report.Issues = v.issues
+		return report
+	}
+	report.ControlId = m.Delimiters.Decode(msh.Field(10).Value())
+	v.version = msh.Field(12).Repetition(0).Component(1).Value()
+	if v.version != p.Version {
+		v.add(fieldIssue("MSH", 1, 12, 0, 0, SeverityError, ErrorCodeUnsupportedVersion, fmt.Sprintf(
+			"%s is for version %s but the message is %s", p.Identifier, p.Version, v.version,
+		)))
+	}
+	structure, err := m.Structure()
+	switch {
+	case err == nil && structure.Name != p.Structure:
+		v.add(fieldIssue("MSH", 1, 9, 0, 0, SeverityError, ErrorCodeUnsupportedMessage, fmt.Sprintf(
+			"%s is for %s messages but the message is %s", p.Identifier, p.Structure, structure.Name,
+		)))
+	case err == nil:
+		// use the profile's version of the structure, which is what its paths are written against
+		if profileStructure, err := LookupStructure(p.Structure, p.Version); err == nil {
+			structure = profileStructure
+		}
+		root, _ := m.arrange(structure)
+		v.checkGroup(root, "")
+	default:
+		v.add(fieldIssue("MSH", 1, 9, 0, 0, SeverityError, ErrorCodeUnsupportedMessage, fmt.Sprintf(
+			"unable to check the structure: %v", err,
+		)))
+	}
+	for _, segment := range m.Segments {
+		for _, f := range p.Fields {
+			if f.Segment == segment.Name {
+				v.checkField(segment, v.occurrences[segment], f)
+			}
+		}
+	}
+	report.Issues = v.issues
+	return report
+}
+
+// profileValidator - collects the issues while we check a message against a profile
+type profileValidator struct {
+	validator
+	profile     *Profile
+	occurrences map[*ParsedSegment]int
+}
+
+// checkGroup - checks the segments and groups directly inside one occurrence of a group against the
+// profile, then the groups nested in it
+func (v *profileValidator) checkGroup(group *MessageGroup, path string) {
+	for _, rule := range v.profile.Segments {
+		if rule.parent() != path {
+			continue
+		}
+		var found []*GroupChild
+		for _, child := range group.Children {
+			if (child.Group != nil && child.Group.Name == rule.Name()) || (child.Segment != nil && child.Segment.Name == rule.Name()) {
+				found = append(found, child)
+			}
+		}
+		issue := func(child *GroupChild, description string) {
+			i := ValidationIssue{Location: rule.Name(), Severity: SeverityError, Code: ErrorCodeSegmentSequence, Description: description}
+			if child != nil && child.Segment != nil {
+				i.Segment, i.Sequence = child.Segment.Name, v.occurrences[child.Segment]
+				i.Location = segmentLocation(i.Segment, i.Sequence)
+			} else if child == nil && len(rule.Name()) == 3 {
+				// segment names are always three characters, and group names never are
+				i.Segment = rule.Name()
+			}
+			v.add(i)
+		}
+		switch {
+		case rule.Usage == UsageNotSupported && len(found) > 0:
+			issue(found[0], fmt.Sprintf("%s is not supported by %s", rule.Path, v.profile.Identifier))
+		case rule.Usage == UsageRequired && len(found) < rule.Min:
+			issue(nil, fmt.Sprintf("%s is required by %s", rule.Path, v.profile.Identifier))
+		case rule.Max > 0 && len(found) > rule.Max:
+			issue(found[rule.Max], fmt.Sprintf(
+				"%s appears %d times but %s allows %d", rule.Path, len(found), v.profile.Identifier, rule.Max,
+			))
+		}
+	}
+	for _, child := range group.Children {
+		if child.Group == nil {
+			continue
+		}
+		childPath := child.Group.Name
+		if path != "" {
+			childPath = path + "." + childPath
+		}
+		v.checkGroup(child.Group, childPath)
+	}
+}
+
+// checkField - checks a field or component of one segment against the profile
+func (v *profileValidator) checkField(segment *ParsedSegment, occurrence int, rule *ProfileField) {
+	name := rule.Location
+	dataType := ""
+	if definition, err := LookupSegmentDefinition(segment.Name, v.version); err == nil {
+		if f := definition.Field(rule.Field); f != nil {
+			name, dataType = f.Name, f.DataType
+		}
+	}
+	issue := func(repetition int, severity, code, description string) {
+		v.add(fieldIssue(segment.Name, occurrence, rule.Field, repetition, rule.Component, severity, code, description))
+	}
+	usage := rule.usage(v.message, segment)
+	field := segment.Field(rule.Field)
+	if rule.Component > 0 {
+		if fieldEmpty(field) {
+			// the rule for the field itself says whether it has to be there
+			return
+		}
+		for i, r := range field.Repetitions {
+			value := v.message.Delimiters.Decode(r.Component(rule.Component).Value())
+			empty := value == "" || value == explicitNull
+			switch {
+			case usage == UsageRequired && empty:
+				issue(i+1, SeverityError, ErrorCodeRequiredFieldMissing, fmt.Sprintf(
+					"component %d of %s is required by %s", rule.Component, name, v.profile.Identifier,
+				))
+			case usage == UsageNotSupported && !empty:
+				issue(i+1, SeverityError, ErrorCodeDataType, fmt.Sprintf(
+					"component %d of %s is not supported by %s", rule.Component, name, v.profile.Identifier,
+				))
+			case !empty:
+				if severity, description := v.checkValueSet(rule, "", value, ""); description != "" {
+					issue(i+1, severity, ErrorCodeTableValueNotFound, description)
+				}
+			}
+		}
+		return
+	}
+	valued := 0
+	if field != nil {
+		for _, r := range field.Repetitions {
+			if !repetitionEmpty(r) {
+				valued++
+			}
+		}
+	}
+	switch {
+	case usage == UsageRequired && valued == 0:
+		description := fmt.Sprintf("%s is required by %s", name, v.profile.Identifier)
+		if rule.Predicate != nil {
+			description += fmt.Sprintf(" when %s", rule.Predicate)
+		}
+		issue(0, SeverityError, ErrorCodeRequiredFieldMissing, description)
+		return
+	case usage == UsageNotSupported && valued > 0:
+		description := fmt.Sprintf("%s is not supported by %s", name, v.profile.Identifier)
+		if rule.Predicate != nil {
+			description += fmt.Sprintf(" unless %s", rule.Predicate)
+		}
+		issue(0, SeverityError, ErrorCodeDataType, description)
+		return
+	case valued == 0:
+		return
+	case usage == UsageRequired && valued < rule.Min:
+		issue(0, SeverityError, ErrorCodeRequiredFieldMissing, fmt.Sprintf(
+			"%s repeats %d times but %s requires %d", name, valued, v.profile.Identifier, rule.Min,
+		))
+	case rule.Max > 0 && valued > rule.Max:
+		issue(0, SeverityError, ErrorCodeDataType, fmt.Sprintf(
+			"%s repeats %d times but %s allows %d", name, valued, v.profile.Identifier, rule.Max,
+		))
+	}
+	for i, r := range field.Repetitions {
+		code := v.message.Delimiters.Decode(r.Value())
+		codingSystem := ""
+		switch dataType {
+		case "CE", "CWE", "CNE":
+			codingSystem = v.message.Delimiters.Decode(r.Component(3).Value())
+		}
+		if severity, description := v.checkValueSet(rule, dataType, code, codingSystem); description != "" {
+			issue(i+1, severity, ErrorCodeTableValueNotFound, description)
+		}
+	}
+}
+
+// checkValueSet - checks a code is in the value set, returning the severity and what's wrong, or an
+// empty description when it's fine. codes from some other coding system aren't checked, nor are
+// HL7 tables we don't have. codes missing from the profile's own value sets, or from HL7 tables ID
+// fields use, are errors, and codes missing from the user defined tables are warnings, the same as
+// with Validate
+func (v *profileValidator) checkValueSet(rule *ProfileField, dataType, code, codingSystem string) (string, string) {
+	if rule.ValueSet == "" || code == "" || code == explicitNull {
+		return "", ""
+	}
+	if valueSet, ok := v.profile.ValueSets[rule.ValueSet]; ok {
+		if codingSystem != "" && codingSystem != valueSet.Id {
+			known := false
+			for _, c := range valueSet.CodingSystems {
+				known = known || c == codingSystem
+			}
+			if !known {
+				return "", ""
+			}
+		}
+		if valueSet.Codes[code] {
+			return "", ""
+		}
+		return SeverityError, fmt.Sprintf("'%s' is not in %s", code, valueSet.Id)
+	}
+	table := v.tables.Table(rule.ValueSet)
+	if table == nil || (codingSystem != "" && normalizeTableId(codingSystem) != table.Id) || table.Contains(code) {
+		return "", ""
+	}
+	severity := SeverityWarning
+	if hl7TableTypes[dataType] {
+		severity = SeverityError
+	}
+	return severity, fmt.Sprintf("'%s' is not in HL7%s %s", code, table.Id, table.Name)
+}
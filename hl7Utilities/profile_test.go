@@ -0,0 +1,220 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProfile_Validate(t *testing.T) {
+	cases := []struct {
+		name     string
+		message  string
+		set      map[string]string
+		expected []string
+	}{
+		{"conforms", simpleHl7Message, nil, nil},
+		{
+			"value set",
+			strings.Replace(simpleHl7Message, "|NE|NE|", "|AL|NE|", 1),
+			nil,
+			[]string{"E 103 MSH-15: 'AL' is not in NoAck"},
+		},
+		{
+			"value set with a coding system",
+			strings.Replace(simpleHl7Message, "UNK^UNKNOWN^HL70005", "9999-9^Martian^CDCREC", 1),
+			nil,
+			[]string{"E 103 PID-10: '9999-9' is not in PHVS_RaceCategory_CDC"},
+		},
+		{
+			"value set with some other coding system",
+			strings.Replace(simpleHl7Message, "UNK^UNKNOWN^HL70005", "M^Martian^L", 1),
+			nil,
+			nil,
+		},
+		{
+			"HL7 table for an ID",
+			simpleHl7Message,
+			map[string]string{"OBR-25": "Q"},
+			[]string{"E 103 OBR-25: 'Q' is not in HL70123 Result Status"},
+		},
+		{
+			"HL7 table",
+			simpleHl7Message,
+			map[string]string{"OBX-8": "ZZ"},
+			[]string{"W 103 OBX-8: 'ZZ' is not in HL70078 Abnormal Flags"},
+		},
+		{
+			"missing segment",
+			strings.Replace(simpleHl7Message, "SFT|Lawson", "ZFT|Lawson", 1),
+			nil,
+			[]string{"E 100 SFT: SFT is required by PHLabReport-NoAck"},
+		},
+		{
+			"segment not supported",
+			strings.Replace(simpleHl7Message, "\nSPM|", "\nFT1|1\nSPM|", 1),
+			nil,
+			[]string{"E 100 FT1: PATIENT_RESULT.ORDER_OBSERVATION.FT1 is not supported by PHLabReport-NoAck"},
+		},
+		{
+			"missing field the standard makes optional",
+			simpleHl7Message,
+			map[string]string{"OBR-7": ""},
+			[]string{"E 101 OBR-7: Observation Date/Time is required by PHLabReport-NoAck"},
+		},
+		{
+			"missing component",
+			strings.Replace(simpleHl7Message, "&ISO^PI^MCLab", "&ISO^^MCLab", 1),
+			nil,
+			[]string{"E 101 PID-3-5: component 5 of Patient Identifier List is required by PHLabReport-NoAck"},
+		},
+		{
+			"too many repetitions",
+			simpleHl7Message,
+			map[string]string{"PID-22(1)": "H"},
+			[]string{"E 102 PID-22: Ethnic Group repeats 2 times but PHLabReport-NoAck allows 1"},
+		},
+		{
+			"predicate holds",
+			strings.Replace(simpleHl7Message, "OBX|1|CE|", "OBX|1|NM|", 1),
+			nil,
+			[]string{"E 101 OBX-6: Units is required by PHLabReport-NoAck when OBX-2 in NM,SN"},
+		},
+		{
+			"predicate on another field",
+			simpleHl7Message,
+			map[string]string{"PID-29": "20220801"},
+			[]string{"E 101 PID-30: Patient Death Indicator is required by PHLabReport-NoAck when PID-29 valued"},
+		},
+		{
+			"predicate and value set",
+			simpleHl7Message,
+			map[string]string{"PID-29": "20220801", "PID-30": "X"},
+			[]string{"E 103 PID-30: 'X' is not in HL70136 Yes/No Indicator"},
+		},
+		{
+			"not supported when the predicate fails",
+			simpleHl7Message,
+			map[string]string{"OBX-5": "", "OBX-11": "X"},
+			[]string{"E 102 OBX-2: Value Type is not supported by PHLabReport-NoAck unless OBX-5 valued"},
+		},
+		{
+			"wrong version",
+			strings.Replace(simpleHl7Message, "|P|2.5.1|", "|P|2.7|", 1),
+			nil,
+			[]string{"E 203 MSH-12: PHLabReport-NoAck is for version 2.5.1 but the message is 2.7"},
+		},
+		{
+			"wrong message",
+			strings.Replace(simpleHl7Message, "ORU^R01^ORU_R01", "ADT^A01^ADT_A01", 1),
+			nil,
+			[]string{"E 200 MSH-9: PHLabReport-NoAck is for ORU_R01 messages but the message is ADT_A01"},
+		},
+	}
+	for _, c := range cases {
+		parsed, err := ParseMessage(c.message)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		for specification, value := range c.set {
+			if err := parsed.Set(specification, value); err != nil {
+				t.Fatal(c.name, err)
+			}
+		}
+		report, err := parsed.ValidateProfile()
+		if err != nil {
+			t.Logf("%s: error should be nil but got %v", c.name, err)
+			t.Fail()
+			continue
+		}
+		if found := issueStrings(report.Issues); !reflect.DeepEqual(found, c.expected) {
+			t.Logf("%s: expected %q but got %q", c.name, c.expected, found)
+			t.Fail()
+		}
+		if report.Conforms() != (len(c.expected) == 0 || c.expected[0][0] == 'W') {
+			t.Logf("%s: Conforms should be %v", c.name, !report.Conforms())
+			t.Fail()
+		}
+	}
+}
+
+func TestParsedMessage_ValidateProfile(t *testing.T) {
+	// the OID works as well as the name
+	message := strings.Replace(simpleHl7Message, "PHLabReport-NoAck^HL7^", "^HL7^", 1)
+	report, err := Hl7Message{RawMessage: message}.ValidateProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Profile.Identifier != "PHLabReport-NoAck" || report.ControlId != "2022080205333719454131" {
+		t.Logf("got the %s report for %s", report.Profile.Identifier, report.ControlId)
+		t.Fail()
+	}
+	if expected := "message 2022080205333719454131 conforms to PHLabReport-NoAck"; report.String() != expected {
+		t.Logf("expected '%s' but got '%s'", expected, report.String())
+		t.Fail()
+	}
+	_, err = Hl7Message{RawMessage: validOruMessage}.ValidateProfile()
+	if !errors.Is(err, ErrProfileNotFound) {
+		t.Log("a message without MSH-21 should have no profile, but got", err)
+		t.Fail()
+	}
+}
+
+func TestProfiles_LoadFile(t *testing.T) {
+	definition := strings.Join([]string{
+		"identifier\tLOCAL-ORU",
+		"version\t2.5.1",
+		"structure\tORU_R01",
+		"field\tPID-8\tR\t1..1\tHL70001\t-",
+	}, "\n")
+	filePath := filepath.Join(t.TempDir(), "LOCAL-ORU.txt")
+	if err := os.WriteFile(filePath, []byte(definition), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	profiles := NewProfiles()
+	if err := profiles.LoadFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if profiles.Lookup("LOCAL-ORU") == nil || profiles.Lookup("PHLabReport-NoAck") == nil {
+		t.Log("the loaded profile should be there along with the bundled ones")
+		t.Fail()
+	}
+	message := strings.Replace(validOruMessage, "|P|2.5.1", "|P|2.5.1|||||||||LOCAL-ORU", 1)
+	parsed, _ := ParseMessage(strings.Replace(message, "|19800101|F", "|19800101|", 1))
+	profile := profiles.ForMessage(parsed)
+	if profile == nil {
+		t.Fatal("the message should use the loaded profile")
+	}
+	found := issueStrings(profile.Validate(parsed).Issues)
+	if expected := []string{"E 101 PID-8: Administrative Sex is required by LOCAL-ORU"}; !reflect.DeepEqual(found, expected) {
+		t.Logf("expected %q but got %q", expected, found)
+		t.Fail()
+	}
+}
+
+func TestParseProfile_Errors(t *testing.T) {
+	header := "identifier\tP\nversion\t2.5.1\nstructure\tORU_R01\n"
+	cases := map[string]string{
+		"no identifier":   "version\t2.5.1\nstructure\tORU_R01",
+		"no structure":    "identifier\tP\nversion\t2.5.1",
+		"unknown line":    header + "table\t0001",
+		"columns":         header + "field\tPID-8\tR\t1..1",
+		"usage":           header + "field\tPID-8\tREQ\t1..1\t-\t-",
+		"segment usage":   header + "segment\tPID\tC(R/X)\t1..1",
+		"cardinality":     header + "segment\tPID\tR\t2..1",
+		"location":        header + "field\tPID8\tR\t1..1\t-\t-",
+		"no predicate":    header + "field\tPID-30\tC(R/RE)\t0..1\t-\t-",
+		"predicate":       header + "field\tPID-30\tC(R/RE)\t0..1\t-\tPID-29 is there",
+		"stray predicate": header + "field\tPID-30\tRE\t0..1\t-\tPID-29 valued",
+		"value set":       header + "field\tPID-10\tRE\t0..*\tRACE\t-",
+	}
+	for name, definition := range cases {
+		if _, err := ParseProfile(definition); err == nil {
+			t.Logf("%s: expected an error", name)
+			t.Fail()
+		}
+	}
+}
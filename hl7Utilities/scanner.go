@@ -0,0 +1,274 @@
+package hl7Utilities
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxSegmentLength - the longest segment the scanner will read. segments are usually short, but an
+// OBX can carry a whole base64 encoded PDF
+const maxSegmentLength = 64 << 20
+
+// Scanner - reads HL7 messages from a stream one at a time, the way [bufio.Scanner] reads lines, so
+// a file holding thousands of messages never has to be in memory all at once. segments can end in
+// \r, \n or \r\n, and blank lines between them are skipped.
+//
+// files wrapped in FHS/FTS and batches wrapped in BHS/BTS are understood. the envelope segments are
+// never part of a message, but the headers are kept for FileHeader and BatchHeader, and the counts
+// in BTS-1 and FTS-1 are checked against what we actually read
+type Scanner struct {
+	lines *bufio.Scanner
+	// pending - a line we read that belongs to whatever comes after the current message
+	pending *string
+	message Hl7Message
+	err     error
+	done    bool
+
+	fileHeader  *ParsedSegment
+	batchHeader *ParsedSegment
+	fileEnded   bool
+	inBatch     bool
+	// batchMessages - the messages read so far in the current batch
+	batchMessages int
+	// batches - the batches read so far in the file
+	batches int
+}
+
+// NewScanner - returns a scanner reading messages from the reader
+func NewScanner(r io.Reader) *Scanner {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64*1024), maxSegmentLength)
+	lines.Split(scanSegments)
+	return &Scanner{lines: lines}
+}
+
+// scanSegments - a [bufio.SplitFunc] that ends a segment at \r, \n or \r\n
+func scanSegments(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if !atEOF {
+				// we need to see the next byte to know whether this is \r\n
+				return 0, nil, nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Scan - reads the next message, returning false at the end of the stream or when something goes
+// wrong, which Err will then report
+func (s *Scanner) Scan() bool {
+	if s.err != nil || s.done {
+		return false
+	}
+	var segments []string
+	for {
+		line, ok := s.nextLine()
+		if !ok {
+			if err := s.lines.Err(); err != nil {
+				s.err = err
+				return false
+			}
+			if len(segments) > 0 {
+				// the next call will find nothing left and check the envelope was closed
+				s.emit(segments)
+				return true
+			}
+			s.done = true
+			s.err = s.checkEnd()
+			return false
+		}
+		if len(line) < 3 {
+			s.err = fmt.Errorf("%w: '%s' is not a segment", ErrInvalidMessage, line)
+			return false
+		}
+		name := line[:3]
+		if s.fileEnded {
+			s.err = fmt.Errorf("%w: %s segment after the FTS", ErrInvalidBatch, name)
+			return false
+		}
+		switch name {
+		case "MSH", "FHS", "BHS", "BTS", "FTS":
+			if len(segments) > 0 {
+				// this is the start of whatever comes next, so the message we have is complete
+				s.pending = &line
+				s.emit(segments)
+				return true
+			}
+			if name == "MSH" {
+				segments = append(segments, line)
+				continue
+			}
+			if err := s.envelope(name, line); err != nil {
+				s.err = err
+				return false
+			}
+		default:
+			if len(segments) == 0 {
+				s.err = fmt.Errorf("%w: %s segment before any MSH", ErrInvalidMessage, name)
+				return false
+			}
+			segments = append(segments, line)
+		}
+	}
+}
+
+// Message - the message the last call to Scan read, with its segments separated by \r
+func (s *Scanner) Message() Hl7Message {
+	return s.message
+}
+
+// Err - the first error the scanner hit, or nil if it reached the end of the stream cleanly
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// FileHeader - the FHS segment, or nil if the stream isn't wrapped in one
+func (s *Scanner) FileHeader() *ParsedSegment {
+	return s.fileHeader
+}
+
+// BatchHeader - the BHS segment of the batch the last message was in, or nil if it wasn't in one
+func (s *Scanner) BatchHeader() *ParsedSegment {
+	return s.batchHeader
+}
+
+// nextLine - the next line that isn't blank, with any leading whitespace trimmed off
+func (s *Scanner) nextLine() (string, bool) {
+	if s.pending != nil {
+		line := *s.pending
+		s.pending = nil
+		return line, true
+	}
+	for s.lines.Scan() {
+		line := strings.TrimLeftFunc(s.lines.Text(), unicode.IsSpace)
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		return line, true
+	}
+	return "", false
+}
+
+// emit - makes the segments the current message
+func (s *Scanner) emit(segments []string) {
+	s.message = Hl7Message{RawMessage: strings.Join(segments, "\r")}
+	if s.inBatch {
+		s.batchMessages++
+	}
+}
+
+// envelope - keeps track of the file and batch segments, checking they're in the right order and
+// that the counts in the trailers match
+func (s *Scanner) envelope(name, line string) error {
+	switch name {
+	case "FHS":
+		if s.fileHeader != nil || s.batches > 0 || s.inBatch {
+			return fmt.Errorf("%w: FHS after the start of the file", ErrInvalidBatch)
+		}
+		header, err := parseEnvelopeHeader(line)
+		if err != nil {
+			return err
+		}
+		s.fileHeader = header
+	case "BHS":
+		if s.inBatch {
+			return fmt.Errorf("%w: BHS before the BTS of the previous batch", ErrInvalidBatch)
+		}
+		header, err := parseEnvelopeHeader(line)
+		if err != nil {
+			return err
+		}
+		s.batchHeader = header
+		s.inBatch = true
+		s.batchMessages = 0
+		s.batches++
+	case "BTS":
+		if !s.inBatch {
+			return fmt.Errorf("%w: BTS without a BHS", ErrInvalidBatch)
+		}
+		if err := checkTrailerCount(line, "BTS-1 batch message count", s.batchMessages); err != nil {
+			return err
+		}
+		s.inBatch = false
+	case "FTS":
+		if s.fileHeader == nil {
+			return fmt.Errorf("%w: FTS without an FHS", ErrInvalidBatch)
+		}
+		if s.inBatch {
+			return fmt.Errorf("%w: FTS before the BTS of the last batch", ErrInvalidBatch)
+		}
+		if err := checkTrailerCount(line, "FTS-1 file batch count", s.batches); err != nil {
+			return err
+		}
+		s.fileEnded = true
+	}
+	return nil
+}
+
+// checkEnd - makes sure every header we read had its trailer by the end of the stream
+func (s *Scanner) checkEnd() error {
+	if s.inBatch {
+		return fmt.Errorf("%w: the last batch has no BTS", ErrInvalidBatch)
+	}
+	if s.fileHeader != nil && !s.fileEnded {
+		return fmt.Errorf("%w: the file has no FTS", ErrInvalidBatch)
+	}
+	return nil
+}
+
+// parseEnvelopeHeader - parses an FHS or BHS, which declare their own delimiters the same way MSH does
+func parseEnvelopeHeader(line string) (*ParsedSegment, error) {
+	if len(line) < 4 {
+		return nil, fmt.Errorf("%w: %s has no field separator", ErrInvalidBatch, line)
+	}
+	fieldSeparator := line[3:4]
+	parts := strings.Split(line, fieldSeparator)
+	encodingCharacters := ""
+	if len(parts) > 1 {
+		encodingCharacters = parts[1]
+	}
+	delimiters, err := NewDelimiters(fieldSeparator, encodingCharacters)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBatch, parts[0], err)
+	}
+	return parseSegment(line, delimiters)
+}
+
+// checkTrailerCount - compares the count in field 1 of a BTS or FTS with what we counted. senders
+// can leave the count empty, and then there's nothing to check
+func checkTrailerCount(line, description string, actual int) error {
+	if len(line) < 4 {
+		return nil
+	}
+	parts := strings.Split(line, line[3:4])
+	if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+		return nil
+	}
+	expected, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return fmt.Errorf("%w: %s '%s' is not a number", ErrInvalidBatch, description, parts[1])
+	}
+	if expected != actual {
+		return fmt.Errorf("%w: %s is %d but there were %d", ErrInvalidBatch, description, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scanAll - reads every message, returning their raw text and the scanner's error
+func scanAll(scanner *Scanner) ([]string, error) {
+	var messages []string
+	for scanner.Scan() {
+		messages = append(messages, scanner.Message().RawMessage)
+	}
+	return messages, scanner.Err()
+}
+
+func TestScanner_LineEndings(t *testing.T) {
+	expected := []string{
+		"MSH|^~\\&|A||||20220101||ORU^R01|1|P|2.5.1\rPID|1||123\rOBX|1|ST|code||value",
+		"MSH|^~\\&|B||||20220101||ORU^R01|2|P|2.5.1\rPID|1||456",
+	}
+	for _, lineEnding := range []string{"\r", "\n", "\r\n"} {
+		input := strings.Join([]string{
+			"MSH|^~\\&|A||||20220101||ORU^R01|1|P|2.5.1",
+			"PID|1||123",
+			"",
+			"OBX|1|ST|code||value",
+			"MSH|^~\\&|B||||20220101||ORU^R01|2|P|2.5.1",
+			"  PID|1||456",
+			"",
+		}, lineEnding)
+		// reading a byte at a time makes sure a \r\n split across reads is still one line ending
+		messages, err := scanAll(NewScanner(iotest.OneByteReader(strings.NewReader(input))))
+		if err != nil {
+			t.Logf("%q: error should be nil: %v", lineEnding, err)
+			t.Fail()
+		}
+		if !reflect.DeepEqual(messages, expected) {
+			t.Logf("%q: expected %q but got %q", lineEnding, expected, messages)
+			t.Fail()
+		}
+	}
+}
+
+func TestScanner_Batches(t *testing.T) {
+	input := strings.Join([]string{
+		"FHS|^~\\&|LAB|FACILITY||||20220101",
+		"BHS|^~\\&|LAB|FACILITY||||20220101||BATCH1",
+		"MSH|^~\\&|LAB||||20220101||ORU^R01|1|P|2.5.1",
+		"PID|1||123",
+		"MSH|^~\\&|LAB||||20220101||ORU^R01|2|P|2.5.1",
+		"PID|1||456",
+		"BTS|2",
+		"BHS|^~\\&|LAB|FACILITY||||20220101||BATCH2",
+		"MSH|^~\\&|LAB||||20220101||ORU^R01|3|P|2.5.1",
+		"BTS|1|last one",
+		"FTS|2",
+	}, "\r\n")
+	scanner := NewScanner(strings.NewReader(input))
+	var batchNames []string
+	for scanner.Scan() {
+		batchNames = append(batchNames, scanner.BatchHeader().Field(10).Value())
+		if !strings.HasPrefix(scanner.Message().RawMessage, "MSH") {
+			t.Logf("envelope segments shouldn't be part of a message: %q", scanner.Message().RawMessage)
+			t.Fail()
+		}
+	}
+	if scanner.Err() != nil {
+		t.Fatal("error should be nil", scanner.Err())
+	}
+	if !reflect.DeepEqual(batchNames, []string{"BATCH1", "BATCH1", "BATCH2"}) {
+		t.Logf("expected each message to know its batch but got %v", batchNames)
+		t.Fail()
+	}
+	if scanner.FileHeader().Field(3).Value() != "LAB" {
+		t.Logf("expected the FHS sending application to be LAB but got '%s'", scanner.FileHeader().Field(3).Value())
+		t.Fail()
+	}
+}
+
+func TestScanner_BatchWithoutCounts(t *testing.T) {
+	input := "BHS|^~\\&\rMSH|^~\\&|LAB\rMSH|^~\\&|LAB\rBTS\r"
+	messages, err := scanAll(NewScanner(strings.NewReader(input)))
+	if err != nil || len(messages) != 2 {
+		t.Logf("expected 2 messages and no error but got %d and %v", len(messages), err)
+		t.Fail()
+	}
+}
+
+func TestScanner_Errors(t *testing.T) {
+	cases := []struct {
+		name, input string
+		messages    int
+		err         error
+	}{
+		{"wrong BTS count", "BHS|^~\\&\rMSH|^~\\&|LAB\rBTS|2", 1, ErrInvalidBatch},
+		{"wrong FTS count", "FHS|^~\\&\rBHS|^~\\&\rMSH|^~\\&|LAB\rBTS|1\rFTS|3", 1, ErrInvalidBatch},
+		{"BTS count isn't a number", "BHS|^~\\&\rMSH|^~\\&|LAB\rBTS|one", 1, ErrInvalidBatch},
+		{"missing BTS", "BHS|^~\\&\rMSH|^~\\&|LAB", 1, ErrInvalidBatch},
+		{"missing FTS", "FHS|^~\\&\rMSH|^~\\&|LAB", 1, ErrInvalidBatch},
+		{"BTS without BHS", "MSH|^~\\&|LAB\rBTS|1", 1, ErrInvalidBatch},
+		{"FTS without FHS", "MSH|^~\\&|LAB\rFTS|0", 1, ErrInvalidBatch},
+		{"nested BHS", "BHS|^~\\&\rBHS|^~\\&\rMSH|^~\\&|LAB", 0, ErrInvalidBatch},
+		{"message after FTS", "FHS|^~\\&\rFTS|0\rMSH|^~\\&|LAB", 0, ErrInvalidBatch},
+		{"segment before MSH", "PID|1||123\rMSH|^~\\&|LAB", 0, ErrInvalidMessage},
+	}
+	for _, c := range cases {
+		messages, err := scanAll(NewScanner(strings.NewReader(c.input)))
+		if !errors.Is(err, c.err) {
+			t.Logf("%s: expected %v but got %v", c.name, c.err, err)
+			t.Fail()
+		}
+		if len(messages) != c.messages {
+			t.Logf("%s: expected %d messages before the error but got %d", c.name, c.messages, len(messages))
+			t.Fail()
+		}
+	}
+}
+
+func TestScanner_Empty(t *testing.T) {
+	messages, err := scanAll(NewScanner(strings.NewReader("\r\n\n")))
+	if err != nil || len(messages) != 0 {
+		t.Logf("expected nothing but got %v and %v", messages, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,955 @@
+package hl7Utilities
+
+import "fmt"
+
+// Segment - the segments we have typed accessors for, named after the fields in the v2.5.1 standard.
+// get them out of a parsed message with [SegmentsOf], or wrap one you already have with [NewSegment].
+// the header lives in [MSH], which Preprocess fills in
+type Segment interface {
+	PID | ORC | OBR | OBX | SPM | NTE | SFT | PV1 | NK1
+	// SegmentName - the three letter name of the segment, like PID
+	SegmentName() string
+}
+
+// typedSegment - what every typed segment is built on, the parsed segment along with the delimiters
+// of the message it came from so its values can be decoded
+type typedSegment struct {
+	segment    *ParsedSegment
+	delimiters Delimiters
+}
+
+// Parsed - the parsed segment behind the typed one, which is nil for a segment the message didn't have
+func (t typedSegment) Parsed() *ParsedSegment {
+	return t.segment
+}
+
+// Field - returns the field at the HL7 position, which starts at 1, or nil if it's missing. the named
+// accessors all go through here
+func (t typedSegment) Field(position int) *Field {
+	return t.segment.Field(position)
+}
+
+// Value - the first primitive value of the field at the HL7 position, with its escape sequences
+// decoded, or an empty string if it's missing
+func (t typedSegment) Value(position int) string {
+	return t.delimiters.Decode(t.Field(position).Value())
+}
+
+// Raw - the whole field at the HL7 position as it appears in the message, delimiters, escape
+// sequences and all, or an empty string if it's missing
+func (t typedSegment) Raw(position int) string {
+	field := t.Field(position)
+	if field == nil {
+		return ""
+	}
+	return field.encode(t.delimiters, false)
+}
+
+// Decode - replaces the escape sequences in a value taken from this segment
+func (t typedSegment) Decode(value string) string {
+	return t.delimiters.Decode(value)
+}
+
+// NewSegment - wraps a parsed segment in its typed form, like NewSegment[PID](segment, delimiters).
+// the delimiters should be the ones of the message the segment came from
+func NewSegment[T Segment](segment *ParsedSegment, delimiters Delimiters) (T, error) {
+	var typed T
+	if segment == nil || segment.Name != typed.SegmentName() {
+		name := "a missing segment"
+		if segment != nil {
+			name = segment.Name
+		}
+		return typed, fmt.Errorf("%w: %s can't be read as %s", ErrInvalidSpecification, name, typed.SegmentName())
+	}
+	return T{typedSegment{segment: segment, delimiters: delimiters}}, nil
+}
+
+// SegmentsOf - every segment of the type in the message, in message order, like SegmentsOf[OBX](m)
+func SegmentsOf[T Segment](m *ParsedMessage) []T {
+	var typed T
+	var segments []T
+	if m == nil {
+		return segments
+	}
+	for _, s := range m.SegmentsNamed(typed.SegmentName()) {
+		segments = append(segments, T{typedSegment{segment: s, delimiters: m.Delimiters}})
+	}
+	return segments
+}
+
+// SegmentOf - an occurrence of the segment type in the message, counting from 0. when the message
+// doesn't have that many the segment is empty, so its accessors return nil fields and empty values
+func SegmentOf[T Segment](m *ParsedMessage, occurrence int) T {
+	var typed T
+	if m == nil {
+		return typed
+	}
+	return T{typedSegment{segment: m.Segment(typed.SegmentName(), occurrence), delimiters: m.Delimiters}}
+}
+
+// SFT - the software segment, identifying the software that created the message
+type SFT struct{ typedSegment }
+
+// SegmentName - SFT
+func (SFT) SegmentName() string { return "SFT" }
+
+// SoftwareVendorOrganization - SFT-1
+func (s SFT) SoftwareVendorOrganization() *Field { return s.Field(1) }
+
+// SoftwareCertifiedVersionOrReleaseNumber - SFT-2
+func (s SFT) SoftwareCertifiedVersionOrReleaseNumber() *Field { return s.Field(2) }
+
+// SoftwareProductName - SFT-3
+func (s SFT) SoftwareProductName() *Field { return s.Field(3) }
+
+// SoftwareBinaryId - SFT-4
+func (s SFT) SoftwareBinaryId() *Field { return s.Field(4) }
+
+// SoftwareProductInformation - SFT-5
+func (s SFT) SoftwareProductInformation() *Field { return s.Field(5) }
+
+// SoftwareInstallDate - SFT-6
+func (s SFT) SoftwareInstallDate() *Field { return s.Field(6) }
+
+// PID - the patient identification segment
+type PID struct{ typedSegment }
+
+// SegmentName - PID
+func (PID) SegmentName() string { return "PID" }
+
+// SetId - PID-1
+func (s PID) SetId() *Field { return s.Field(1) }
+
+// PatientId - PID-2
+func (s PID) PatientId() *Field { return s.Field(2) }
+
+// PatientIdentifierList - PID-3
+func (s PID) PatientIdentifierList() *Field { return s.Field(3) }
+
+// AlternatePatientId - PID-4
+func (s PID) AlternatePatientId() *Field { return s.Field(4) }
+
+// PatientName - PID-5
+func (s PID) PatientName() *Field { return s.Field(5) }
+
+// MothersMaidenName - PID-6
+func (s PID) MothersMaidenName() *Field { return s.Field(6) }
+
+// DateTimeOfBirth - PID-7
+func (s PID) DateTimeOfBirth() *Field { return s.Field(7) }
+
+// AdministrativeSex - PID-8
+func (s PID) AdministrativeSex() *Field { return s.Field(8) }
+
+// PatientAlias - PID-9
+func (s PID) PatientAlias() *Field { return s.Field(9) }
+
+// Race - PID-10
+func (s PID) Race() *Field { return s.Field(10) }
+
+// PatientAddress - PID-11
+func (s PID) PatientAddress() *Field { return s.Field(11) }
+
+// CountyCode - PID-12
+func (s PID) CountyCode() *Field { return s.Field(12) }
+
+// PhoneNumberHome - PID-13
+func (s PID) PhoneNumberHome() *Field { return s.Field(13) }
+
+// PhoneNumberBusiness - PID-14
+func (s PID) PhoneNumberBusiness() *Field { return s.Field(14) }
+
+// PrimaryLanguage - PID-15
+func (s PID) PrimaryLanguage() *Field { return s.Field(15) }
+
+// MaritalStatus - PID-16
+func (s PID) MaritalStatus() *Field { return s.Field(16) }
+
+// Religion - PID-17
+func (s PID) Religion() *Field { return s.Field(17) }
+
+// PatientAccountNumber - PID-18
+func (s PID) PatientAccountNumber() *Field { return s.Field(18) }
+
+// SsnNumber - PID-19
+func (s PID) SsnNumber() *Field { return s.Field(19) }
+
+// DriversLicenseNumber - PID-20
+func (s PID) DriversLicenseNumber() *Field { return s.Field(20) }
+
+// MothersIdentifier - PID-21
+func (s PID) MothersIdentifier() *Field { return s.Field(21) }
+
+// EthnicGroup - PID-22
+func (s PID) EthnicGroup() *Field { return s.Field(22) }
+
+// BirthPlace - PID-23
+func (s PID) BirthPlace() *Field { return s.Field(23) }
+
+// MultipleBirthIndicator - PID-24
+func (s PID) MultipleBirthIndicator() *Field { return s.Field(24) }
+
+// BirthOrder - PID-25
+func (s PID) BirthOrder() *Field { return s.Field(25) }
+
+// Citizenship - PID-26
+func (s PID) Citizenship() *Field { return s.Field(26) }
+
+// VeteransMilitaryStatus - PID-27
+func (s PID) VeteransMilitaryStatus() *Field { return s.Field(27) }
+
+// Nationality - PID-28
+func (s PID) Nationality() *Field { return s.Field(28) }
+
+// PatientDeathDateAndTime - PID-29
+func (s PID) PatientDeathDateAndTime() *Field { return s.Field(29) }
+
+// PatientDeathIndicator - PID-30
+func (s PID) PatientDeathIndicator() *Field { return s.Field(30) }
+
+// IdentityUnknownIndicator - PID-31
+func (s PID) IdentityUnknownIndicator() *Field { return s.Field(31) }
+
+// IdentityReliabilityCode - PID-32
+func (s PID) IdentityReliabilityCode() *Field { return s.Field(32) }
+
+// LastUpdateDateTime - PID-33
+func (s PID) LastUpdateDateTime() *Field { return s.Field(33) }
+
+// LastUpdateFacility - PID-34
+func (s PID) LastUpdateFacility() *Field { return s.Field(34) }
+
+// SpeciesCode - PID-35
+func (s PID) SpeciesCode() *Field { return s.Field(35) }
+
+// BreedCode - PID-36
+func (s PID) BreedCode() *Field { return s.Field(36) }
+
+// Strain - PID-37
+func (s PID) Strain() *Field { return s.Field(37) }
+
+// ProductionClassCode - PID-38
+func (s PID) ProductionClassCode() *Field { return s.Field(38) }
+
+// TribalCitizenship - PID-39
+func (s PID) TribalCitizenship() *Field { return s.Field(39) }
+
+// NK1 - the next of kin and associated parties segment
+type NK1 struct{ typedSegment }
+
+// SegmentName - NK1
+func (NK1) SegmentName() string { return "NK1" }
+
+// SetId - NK1-1
+func (s NK1) SetId() *Field { return s.Field(1) }
+
+// Name - NK1-2
+func (s NK1) Name() *Field { return s.Field(2) }
+
+// Relationship - NK1-3
+func (s NK1) Relationship() *Field { return s.Field(3) }
+
+// Address - NK1-4
+func (s NK1) Address() *Field { return s.Field(4) }
+
+// PhoneNumber - NK1-5
+func (s NK1) PhoneNumber() *Field { return s.Field(5) }
+
+// BusinessPhoneNumber - NK1-6
+func (s NK1) BusinessPhoneNumber() *Field { return s.Field(6) }
+
+// ContactRole - NK1-7
+func (s NK1) ContactRole() *Field { return s.Field(7) }
+
+// StartDate - NK1-8
+func (s NK1) StartDate() *Field { return s.Field(8) }
+
+// EndDate - NK1-9
+func (s NK1) EndDate() *Field { return s.Field(9) }
+
+// JobTitle - NK1-10
+func (s NK1) JobTitle() *Field { return s.Field(10) }
+
+// JobCodeClass - NK1-11
+func (s NK1) JobCodeClass() *Field { return s.Field(11) }
+
+// EmployeeNumber - NK1-12
+func (s NK1) EmployeeNumber() *Field { return s.Field(12) }
+
+// OrganizationName - NK1-13
+func (s NK1) OrganizationName() *Field { return s.Field(13) }
+
+// MaritalStatus - NK1-14
+func (s NK1) MaritalStatus() *Field { return s.Field(14) }
+
+// AdministrativeSex - NK1-15
+func (s NK1) AdministrativeSex() *Field { return s.Field(15) }
+
+// DateTimeOfBirth - NK1-16
+func (s NK1) DateTimeOfBirth() *Field { return s.Field(16) }
+
+// LivingDependency - NK1-17
+func (s NK1) LivingDependency() *Field { return s.Field(17) }
+
+// AmbulatoryStatus - NK1-18
+func (s NK1) AmbulatoryStatus() *Field { return s.Field(18) }
+
+// Citizenship - NK1-19
+func (s NK1) Citizenship() *Field { return s.Field(19) }
+
+// PrimaryLanguage - NK1-20
+func (s NK1) PrimaryLanguage() *Field { return s.Field(20) }
+
+// LivingArrangement - NK1-21
+func (s NK1) LivingArrangement() *Field { return s.Field(21) }
+
+// PublicityCode - NK1-22
+func (s NK1) PublicityCode() *Field { return s.Field(22) }
+
+// ProtectionIndicator - NK1-23
+func (s NK1) ProtectionIndicator() *Field { return s.Field(23) }
+
+// StudentIndicator - NK1-24
+func (s NK1) StudentIndicator() *Field { return s.Field(24) }
+
+// Religion - NK1-25
+func (s NK1) Religion() *Field { return s.Field(25) }
+
+// MothersMaidenName - NK1-26
+func (s NK1) MothersMaidenName() *Field { return s.Field(26) }
+
+// Nationality - NK1-27
+func (s NK1) Nationality() *Field { return s.Field(27) }
+
+// EthnicGroup - NK1-28
+func (s NK1) EthnicGroup() *Field { return s.Field(28) }
+
+// ContactReason - NK1-29
+func (s NK1) ContactReason() *Field { return s.Field(29) }
+
+// ContactPersonsName - NK1-30
+func (s NK1) ContactPersonsName() *Field { return s.Field(30) }
+
+// ContactPersonsTelephoneNumber - NK1-31
+func (s NK1) ContactPersonsTelephoneNumber() *Field { return s.Field(31) }
+
+// ContactPersonsAddress - NK1-32
+func (s NK1) ContactPersonsAddress() *Field { return s.Field(32) }
+
+// AssociatedPartysIdentifiers - NK1-33
+func (s NK1) AssociatedPartysIdentifiers() *Field { return s.Field(33) }
+
+// JobStatus - NK1-34
+func (s NK1) JobStatus() *Field { return s.Field(34) }
+
+// Race - NK1-35
+func (s NK1) Race() *Field { return s.Field(35) }
+
+// Handicap - NK1-36
+func (s NK1) Handicap() *Field { return s.Field(36) }
+
+// ContactPersonSocialSecurityNumber - NK1-37
+func (s NK1) ContactPersonSocialSecurityNumber() *Field { return s.Field(37) }
+
+// BirthPlace - NK1-38
+func (s NK1) BirthPlace() *Field { return s.Field(38) }
+
+// VipIndicator - NK1-39
+func (s NK1) VipIndicator() *Field { return s.Field(39) }
+
+// PV1 - the patient visit segment
+type PV1 struct{ typedSegment }
+
+// SegmentName - PV1
+func (PV1) SegmentName() string { return "PV1" }
+
+// SetId - PV1-1
+func (s PV1) SetId() *Field { return s.Field(1) }
+
+// PatientClass - PV1-2
+func (s PV1) PatientClass() *Field { return s.Field(2) }
+
+// AssignedPatientLocation - PV1-3
+func (s PV1) AssignedPatientLocation() *Field { return s.Field(3) }
+
+// AdmissionType - PV1-4
+func (s PV1) AdmissionType() *Field { return s.Field(4) }
+
+// PreadmitNumber - PV1-5
+func (s PV1) PreadmitNumber() *Field { return s.Field(5) }
+
+// PriorPatientLocation - PV1-6
+func (s PV1) PriorPatientLocation() *Field { return s.Field(6) }
+
+// AttendingDoctor - PV1-7
+func (s PV1) AttendingDoctor() *Field { return s.Field(7) }
+
+// ReferringDoctor - PV1-8
+func (s PV1) ReferringDoctor() *Field { return s.Field(8) }
+
+// ConsultingDoctor - PV1-9
+func (s PV1) ConsultingDoctor() *Field { return s.Field(9) }
+
+// HospitalService - PV1-10
+func (s PV1) HospitalService() *Field { return s.Field(10) }
+
+// TemporaryLocation - PV1-11
+func (s PV1) TemporaryLocation() *Field { return s.Field(11) }
+
+// PreadmitTestIndicator - PV1-12
+func (s PV1) PreadmitTestIndicator() *Field { return s.Field(12) }
+
+// ReadmissionIndicator - PV1-13
+func (s PV1) ReadmissionIndicator() *Field { return s.Field(13) }
+
+// AdmitSource - PV1-14
+func (s PV1) AdmitSource() *Field { return s.Field(14) }
+
+// AmbulatoryStatus - PV1-15
+func (s PV1) AmbulatoryStatus() *Field { return s.Field(15) }
+
+// VipIndicator - PV1-16
+func (s PV1) VipIndicator() *Field { return s.Field(16) }
+
+// AdmittingDoctor - PV1-17
+func (s PV1) AdmittingDoctor() *Field { return s.Field(17) }
+
+// PatientType - PV1-18
+func (s PV1) PatientType() *Field { return s.Field(18) }
+
+// VisitNumber - PV1-19
+func (s PV1) VisitNumber() *Field { return s.Field(19) }
+
+// FinancialClass - PV1-20
+func (s PV1) FinancialClass() *Field { return s.Field(20) }
+
+// ChargePriceIndicator - PV1-21
+func (s PV1) ChargePriceIndicator() *Field { return s.Field(21) }
+
+// CourtesyCode - PV1-22
+func (s PV1) CourtesyCode() *Field { return s.Field(22) }
+
+// CreditRating - PV1-23
+func (s PV1) CreditRating() *Field { return s.Field(23) }
+
+// ContractCode - PV1-24
+func (s PV1) ContractCode() *Field { return s.Field(24) }
+
+// ContractEffectiveDate - PV1-25
+func (s PV1) ContractEffectiveDate() *Field { return s.Field(25) }
+
+// ContractAmount - PV1-26
+func (s PV1) ContractAmount() *Field { return s.Field(26) }
+
+// ContractPeriod - PV1-27
+func (s PV1) ContractPeriod() *Field { return s.Field(27) }
+
+// InterestCode - PV1-28
+func (s PV1) InterestCode() *Field { return s.Field(28) }
+
+// TransferToBadDebtCode - PV1-29
+func (s PV1) TransferToBadDebtCode() *Field { return s.Field(29) }
+
+// TransferToBadDebtDate - PV1-30
+func (s PV1) TransferToBadDebtDate() *Field { return s.Field(30) }
+
+// BadDebtAgencyCode - PV1-31
+func (s PV1) BadDebtAgencyCode() *Field { return s.Field(31) }
+
+// BadDebtTransferAmount - PV1-32
+func (s PV1) BadDebtTransferAmount() *Field { return s.Field(32) }
+
+// BadDebtRecoveryAmount - PV1-33
+func (s PV1) BadDebtRecoveryAmount() *Field { return s.Field(33) }
+
+// DeleteAccountIndicator - PV1-34
+func (s PV1) DeleteAccountIndicator() *Field { return s.Field(34) }
+
+// DeleteAccountDate - PV1-35
+func (s PV1) DeleteAccountDate() *Field { return s.Field(35) }
+
+// DischargeDisposition - PV1-36
+func (s PV1) DischargeDisposition() *Field { return s.Field(36) }
+
+// DischargedToLocation - PV1-37
+func (s PV1) DischargedToLocation() *Field { return s.Field(37) }
+
+// DietType - PV1-38
+func (s PV1) DietType() *Field { return s.Field(38) }
+
+// ServicingFacility - PV1-39
+func (s PV1) ServicingFacility() *Field { return s.Field(39) }
+
+// BedStatus - PV1-40
+func (s PV1) BedStatus() *Field { return s.Field(40) }
+
+// AccountStatus - PV1-41
+func (s PV1) AccountStatus() *Field { return s.Field(41) }
+
+// PendingLocation - PV1-42
+func (s PV1) PendingLocation() *Field { return s.Field(42) }
+
+// PriorTemporaryLocation - PV1-43
+func (s PV1) PriorTemporaryLocation() *Field { return s.Field(43) }
+
+// AdmitDateTime - PV1-44
+func (s PV1) AdmitDateTime() *Field { return s.Field(44) }
+
+// DischargeDateTime - PV1-45
+func (s PV1) DischargeDateTime() *Field { return s.Field(45) }
+
+// CurrentPatientBalance - PV1-46
+func (s PV1) CurrentPatientBalance() *Field { return s.Field(46) }
+
+// TotalCharges - PV1-47
+func (s PV1) TotalCharges() *Field { return s.Field(47) }
+
+// TotalAdjustments - PV1-48
+func (s PV1) TotalAdjustments() *Field { return s.Field(48) }
+
+// TotalPayments - PV1-49
+func (s PV1) TotalPayments() *Field { return s.Field(49) }
+
+// AlternateVisitId - PV1-50
+func (s PV1) AlternateVisitId() *Field { return s.Field(50) }
+
+// VisitIndicator - PV1-51
+func (s PV1) VisitIndicator() *Field { return s.Field(51) }
+
+// OtherHealthcareProvider - PV1-52
+func (s PV1) OtherHealthcareProvider() *Field { return s.Field(52) }
+
+// ORC - the common order segment
+type ORC struct{ typedSegment }
+
+// SegmentName - ORC
+func (ORC) SegmentName() string { return "ORC" }
+
+// OrderControl - ORC-1
+func (s ORC) OrderControl() *Field { return s.Field(1) }
+
+// PlacerOrderNumber - ORC-2
+func (s ORC) PlacerOrderNumber() *Field { return s.Field(2) }
+
+// FillerOrderNumber - ORC-3
+func (s ORC) FillerOrderNumber() *Field { return s.Field(3) }
+
+// PlacerGroupNumber - ORC-4
+func (s ORC) PlacerGroupNumber() *Field { return s.Field(4) }
+
+// OrderStatus - ORC-5
+func (s ORC) OrderStatus() *Field { return s.Field(5) }
+
+// ResponseFlag - ORC-6
+func (s ORC) ResponseFlag() *Field { return s.Field(6) }
+
+// QuantityTiming - ORC-7
+func (s ORC) QuantityTiming() *Field { return s.Field(7) }
+
+// Parent - ORC-8
+func (s ORC) Parent() *Field { return s.Field(8) }
+
+// DateTimeOfTransaction - ORC-9
+func (s ORC) DateTimeOfTransaction() *Field { return s.Field(9) }
+
+// EnteredBy - ORC-10
+func (s ORC) EnteredBy() *Field { return s.Field(10) }
+
+// VerifiedBy - ORC-11
+func (s ORC) VerifiedBy() *Field { return s.Field(11) }
+
+// OrderingProvider - ORC-12
+func (s ORC) OrderingProvider() *Field { return s.Field(12) }
+
+// EnterersLocation - ORC-13
+func (s ORC) EnterersLocation() *Field { return s.Field(13) }
+
+// CallBackPhoneNumber - ORC-14
+func (s ORC) CallBackPhoneNumber() *Field { return s.Field(14) }
+
+// OrderEffectiveDateTime - ORC-15
+func (s ORC) OrderEffectiveDateTime() *Field { return s.Field(15) }
+
+// OrderControlCodeReason - ORC-16
+func (s ORC) OrderControlCodeReason() *Field { return s.Field(16) }
+
+// EnteringOrganization - ORC-17
+func (s ORC) EnteringOrganization() *Field { return s.Field(17) }
+
+// EnteringDevice - ORC-18
+func (s ORC) EnteringDevice() *Field { return s.Field(18) }
+
+// ActionBy - ORC-19
+func (s ORC) ActionBy() *Field { return s.Field(19) }
+
+// AdvancedBeneficiaryNoticeCode - ORC-20
+func (s ORC) AdvancedBeneficiaryNoticeCode() *Field { return s.Field(20) }
+
+// OrderingFacilityName - ORC-21
+func (s ORC) OrderingFacilityName() *Field { return s.Field(21) }
+
+// OrderingFacilityAddress - ORC-22
+func (s ORC) OrderingFacilityAddress() *Field { return s.Field(22) }
+
+// OrderingFacilityPhoneNumber - ORC-23
+func (s ORC) OrderingFacilityPhoneNumber() *Field { return s.Field(23) }
+
+// OrderingProviderAddress - ORC-24
+func (s ORC) OrderingProviderAddress() *Field { return s.Field(24) }
+
+// OrderStatusModifier - ORC-25
+func (s ORC) OrderStatusModifier() *Field { return s.Field(25) }
+
+// AdvancedBeneficiaryNoticeOverrideReason - ORC-26
+func (s ORC) AdvancedBeneficiaryNoticeOverrideReason() *Field { return s.Field(26) }
+
+// FillersExpectedAvailabilityDateTime - ORC-27
+func (s ORC) FillersExpectedAvailabilityDateTime() *Field { return s.Field(27) }
+
+// ConfidentialityCode - ORC-28
+func (s ORC) ConfidentialityCode() *Field { return s.Field(28) }
+
+// OrderType - ORC-29
+func (s ORC) OrderType() *Field { return s.Field(29) }
+
+// EntererAuthorizationMode - ORC-30
+func (s ORC) EntererAuthorizationMode() *Field { return s.Field(30) }
+
+// ParentUniversalServiceIdentifier - ORC-31
+func (s ORC) ParentUniversalServiceIdentifier() *Field { return s.Field(31) }
+
+// OBR - the observation request segment
+type OBR struct{ typedSegment }
+
+// SegmentName - OBR
+func (OBR) SegmentName() string { return "OBR" }
+
+// SetId - OBR-1
+func (s OBR) SetId() *Field { return s.Field(1) }
+
+// PlacerOrderNumber - OBR-2
+func (s OBR) PlacerOrderNumber() *Field { return s.Field(2) }
+
+// FillerOrderNumber - OBR-3
+func (s OBR) FillerOrderNumber() *Field { return s.Field(3) }
+
+// UniversalServiceIdentifier - OBR-4
+func (s OBR) UniversalServiceIdentifier() *Field { return s.Field(4) }
+
+// Priority - OBR-5
+func (s OBR) Priority() *Field { return s.Field(5) }
+
+// RequestedDateTime - OBR-6
+func (s OBR) RequestedDateTime() *Field { return s.Field(6) }
+
+// ObservationDateTime - OBR-7
+func (s OBR) ObservationDateTime() *Field { return s.Field(7) }
+
+// ObservationEndDateTime - OBR-8
+func (s OBR) ObservationEndDateTime() *Field { return s.Field(8) }
+
+// CollectionVolume - OBR-9
+func (s OBR) CollectionVolume() *Field { return s.Field(9) }
+
+// CollectorIdentifier - OBR-10
+func (s OBR) CollectorIdentifier() *Field { return s.Field(10) }
+
+// SpecimenActionCode - OBR-11
+func (s OBR) SpecimenActionCode() *Field { return s.Field(11) }
+
+// DangerCode - OBR-12
+func (s OBR) DangerCode() *Field { return s.Field(12) }
+
+// RelevantClinicalInformation - OBR-13
+func (s OBR) RelevantClinicalInformation() *Field { return s.Field(13) }
+
+// SpecimenReceivedDateTime - OBR-14
+func (s OBR) SpecimenReceivedDateTime() *Field { return s.Field(14) }
+
+// SpecimenSource - OBR-15
+func (s OBR) SpecimenSource() *Field { return s.Field(15) }
+
+// OrderingProvider - OBR-16
+func (s OBR) OrderingProvider() *Field { return s.Field(16) }
+
+// OrderCallbackPhoneNumber - OBR-17
+func (s OBR) OrderCallbackPhoneNumber() *Field { return s.Field(17) }
+
+// PlacerField1 - OBR-18
+func (s OBR) PlacerField1() *Field { return s.Field(18) }
+
+// PlacerField2 - OBR-19
+func (s OBR) PlacerField2() *Field { return s.Field(19) }
+
+// FillerField1 - OBR-20
+func (s OBR) FillerField1() *Field { return s.Field(20) }
+
+// FillerField2 - OBR-21
+func (s OBR) FillerField2() *Field { return s.Field(21) }
+
+// ResultsReportStatusChangeDateTime - OBR-22
+func (s OBR) ResultsReportStatusChangeDateTime() *Field { return s.Field(22) }
+
+// ChargeToPractice - OBR-23
+func (s OBR) ChargeToPractice() *Field { return s.Field(23) }
+
+// DiagnosticServiceSectionId - OBR-24
+func (s OBR) DiagnosticServiceSectionId() *Field { return s.Field(24) }
+
+// ResultStatus - OBR-25
+func (s OBR) ResultStatus() *Field { return s.Field(25) }
+
+// ParentResult - OBR-26
+func (s OBR) ParentResult() *Field { return s.Field(26) }
+
+// QuantityTiming - OBR-27
+func (s OBR) QuantityTiming() *Field { return s.Field(27) }
+
+// ResultCopiesTo - OBR-28
+func (s OBR) ResultCopiesTo() *Field { return s.Field(28) }
+
+// Parent - OBR-29
+func (s OBR) Parent() *Field { return s.Field(29) }
+
+// TransportationMode - OBR-30
+func (s OBR) TransportationMode() *Field { return s.Field(30) }
+
+// ReasonForStudy - OBR-31
+func (s OBR) ReasonForStudy() *Field { return s.Field(31) }
+
+// PrincipalResultInterpreter - OBR-32
+func (s OBR) PrincipalResultInterpreter() *Field { return s.Field(32) }
+
+// AssistantResultInterpreter - OBR-33
+func (s OBR) AssistantResultInterpreter() *Field { return s.Field(33) }
+
+// Technician - OBR-34
+func (s OBR) Technician() *Field { return s.Field(34) }
+
+// Transcriptionist - OBR-35
+func (s OBR) Transcriptionist() *Field { return s.Field(35) }
+
+// ScheduledDateTime - OBR-36
+func (s OBR) ScheduledDateTime() *Field { return s.Field(36) }
+
+// NumberOfSampleContainers - OBR-37
+func (s OBR) NumberOfSampleContainers() *Field { return s.Field(37) }
+
+// TransportLogisticsOfCollectedSample - OBR-38
+func (s OBR) TransportLogisticsOfCollectedSample() *Field { return s.Field(38) }
+
+// CollectorsComment - OBR-39
+func (s OBR) CollectorsComment() *Field { return s.Field(39) }
+
+// TransportArrangementResponsibility - OBR-40
+func (s OBR) TransportArrangementResponsibility() *Field { return s.Field(40) }
+
+// TransportArranged - OBR-41
+func (s OBR) TransportArranged() *Field { return s.Field(41) }
+
+// EscortRequired - OBR-42
+func (s OBR) EscortRequired() *Field { return s.Field(42) }
+
+// PlannedPatientTransportComment - OBR-43
+func (s OBR) PlannedPatientTransportComment() *Field { return s.Field(43) }
+
+// ProcedureCode - OBR-44
+func (s OBR) ProcedureCode() *Field { return s.Field(44) }
+
+// ProcedureCodeModifier - OBR-45
+func (s OBR) ProcedureCodeModifier() *Field { return s.Field(45) }
+
+// PlacerSupplementalServiceInformation - OBR-46
+func (s OBR) PlacerSupplementalServiceInformation() *Field { return s.Field(46) }
+
+// FillerSupplementalServiceInformation - OBR-47
+func (s OBR) FillerSupplementalServiceInformation() *Field { return s.Field(47) }
+
+// MedicallyNecessaryDuplicateProcedureReason - OBR-48
+func (s OBR) MedicallyNecessaryDuplicateProcedureReason() *Field { return s.Field(48) }
+
+// ResultHandling - OBR-49
+func (s OBR) ResultHandling() *Field { return s.Field(49) }
+
+// OBX - the observation segment, holding a single result
+type OBX struct{ typedSegment }
+
+// SegmentName - OBX
+func (OBX) SegmentName() string { return "OBX" }
+
+// SetId - OBX-1
+func (s OBX) SetId() *Field { return s.Field(1) }
+
+// ValueType - OBX-2
+func (s OBX) ValueType() *Field { return s.Field(2) }
+
+// ObservationIdentifier - OBX-3
+func (s OBX) ObservationIdentifier() *Field { return s.Field(3) }
+
+// ObservationSubId - OBX-4
+func (s OBX) ObservationSubId() *Field { return s.Field(4) }
+
+// ObservationValue - OBX-5
+func (s OBX) ObservationValue() *Field { return s.Field(5) }
+
+// Units - OBX-6
+func (s OBX) Units() *Field { return s.Field(6) }
+
+// ReferencesRange - OBX-7
+func (s OBX) ReferencesRange() *Field { return s.Field(7) }
+
+// AbnormalFlags - OBX-8
+func (s OBX) AbnormalFlags() *Field { return s.Field(8) }
+
+// Probability - OBX-9
+func (s OBX) Probability() *Field { return s.Field(9) }
+
+// NatureOfAbnormalTest - OBX-10
+func (s OBX) NatureOfAbnormalTest() *Field { return s.Field(10) }
+
+// ObservationResultStatus - OBX-11
+func (s OBX) ObservationResultStatus() *Field { return s.Field(11) }
+
+// EffectiveDateOfReferenceRange - OBX-12
+func (s OBX) EffectiveDateOfReferenceRange() *Field { return s.Field(12) }
+
+// UserDefinedAccessChecks - OBX-13
+func (s OBX) UserDefinedAccessChecks() *Field { return s.Field(13) }
+
+// DateTimeOfTheObservation - OBX-14
+func (s OBX) DateTimeOfTheObservation() *Field { return s.Field(14) }
+
+// ProducersId - OBX-15
+func (s OBX) ProducersId() *Field { return s.Field(15) }
+
+// ResponsibleObserver - OBX-16
+func (s OBX) ResponsibleObserver() *Field { return s.Field(16) }
+
+// ObservationMethod - OBX-17
+func (s OBX) ObservationMethod() *Field { return s.Field(17) }
+
+// EquipmentInstanceIdentifier - OBX-18
+func (s OBX) EquipmentInstanceIdentifier() *Field { return s.Field(18) }
+
+// DateTimeOfTheAnalysis - OBX-19
+func (s OBX) DateTimeOfTheAnalysis() *Field { return s.Field(19) }
+
+// PerformingOrganizationName - OBX-23
+func (s OBX) PerformingOrganizationName() *Field { return s.Field(23) }
+
+// PerformingOrganizationAddress - OBX-24
+func (s OBX) PerformingOrganizationAddress() *Field { return s.Field(24) }
+
+// PerformingOrganizationMedicalDirector - OBX-25
+func (s OBX) PerformingOrganizationMedicalDirector() *Field { return s.Field(25) }
+
+// SPM - the specimen segment
+type SPM struct{ typedSegment }
+
+// SegmentName - SPM
+func (SPM) SegmentName() string { return "SPM" }
+
+// SetId - SPM-1
+func (s SPM) SetId() *Field { return s.Field(1) }
+
+// SpecimenId - SPM-2
+func (s SPM) SpecimenId() *Field { return s.Field(2) }
+
+// SpecimenParentIds - SPM-3
+func (s SPM) SpecimenParentIds() *Field { return s.Field(3) }
+
+// SpecimenType - SPM-4
+func (s SPM) SpecimenType() *Field { return s.Field(4) }
+
+// SpecimenTypeModifier - SPM-5
+func (s SPM) SpecimenTypeModifier() *Field { return s.Field(5) }
+
+// SpecimenAdditives - SPM-6
+func (s SPM) SpecimenAdditives() *Field { return s.Field(6) }
+
+// SpecimenCollectionMethod - SPM-7
+func (s SPM) SpecimenCollectionMethod() *Field { return s.Field(7) }
+
+// SpecimenSourceSite - SPM-8
+func (s SPM) SpecimenSourceSite() *Field { return s.Field(8) }
+
+// SpecimenSourceSiteModifier - SPM-9
+func (s SPM) SpecimenSourceSiteModifier() *Field { return s.Field(9) }
+
+// SpecimenCollectionSite - SPM-10
+func (s SPM) SpecimenCollectionSite() *Field { return s.Field(10) }
+
+// SpecimenRole - SPM-11
+func (s SPM) SpecimenRole() *Field { return s.Field(11) }
+
+// SpecimenCollectionAmount - SPM-12
+func (s SPM) SpecimenCollectionAmount() *Field { return s.Field(12) }
+
+// GroupedSpecimenCount - SPM-13
+func (s SPM) GroupedSpecimenCount() *Field { return s.Field(13) }
+
+// SpecimenDescription - SPM-14
+func (s SPM) SpecimenDescription() *Field { return s.Field(14) }
+
+// SpecimenHandlingCode - SPM-15
+func (s SPM) SpecimenHandlingCode() *Field { return s.Field(15) }
+
+// SpecimenRiskCode - SPM-16
+func (s SPM) SpecimenRiskCode() *Field { return s.Field(16) }
+
+// SpecimenCollectionDateTime - SPM-17
+func (s SPM) SpecimenCollectionDateTime() *Field { return s.Field(17) }
+
+// SpecimenReceivedDateTime - SPM-18
+func (s SPM) SpecimenReceivedDateTime() *Field { return s.Field(18) }
+
+// SpecimenExpirationDateTime - SPM-19
+func (s SPM) SpecimenExpirationDateTime() *Field { return s.Field(19) }
+
+// SpecimenAvailability - SPM-20
+func (s SPM) SpecimenAvailability() *Field { return s.Field(20) }
+
+// SpecimenRejectReason - SPM-21
+func (s SPM) SpecimenRejectReason() *Field { return s.Field(21) }
+
+// SpecimenQuality - SPM-22
+func (s SPM) SpecimenQuality() *Field { return s.Field(22) }
+
+// SpecimenAppropriateness - SPM-23
+func (s SPM) SpecimenAppropriateness() *Field { return s.Field(23) }
+
+// SpecimenCondition - SPM-24
+func (s SPM) SpecimenCondition() *Field { return s.Field(24) }
+
+// SpecimenCurrentQuantity - SPM-25
+func (s SPM) SpecimenCurrentQuantity() *Field { return s.Field(25) }
+
+// NumberOfSpecimenContainers - SPM-26
+func (s SPM) NumberOfSpecimenContainers() *Field { return s.Field(26) }
+
+// ContainerType - SPM-27
+func (s SPM) ContainerType() *Field { return s.Field(27) }
+
+// ContainerCondition - SPM-28
+func (s SPM) ContainerCondition() *Field { return s.Field(28) }
+
+// SpecimenChildRole - SPM-29
+func (s SPM) SpecimenChildRole() *Field { return s.Field(29) }
+
+// NTE - the notes and comments segment
+type NTE struct{ typedSegment }
+
+// SegmentName - NTE
+func (NTE) SegmentName() string { return "NTE" }
+
+// SetId - NTE-1
+func (s NTE) SetId() *Field { return s.Field(1) }
+
+// SourceOfComment - NTE-2
+func (s NTE) SourceOfComment() *Field { return s.Field(2) }
+
+// Comment - NTE-3
+func (s NTE) Comment() *Field { return s.Field(3) }
+
+// CommentType - NTE-4
+func (s NTE) CommentType() *Field { return s.Field(4) }
@@ -0,0 +1,109 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSegmentsOf(t *testing.T) {
+	parsed, err := ParseMessage(simpleHl7Message)
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	pids := SegmentsOf[PID](parsed)
+	if len(pids) != 1 {
+		t.Fatalf("expected 1 PID but got %d", len(pids))
+	}
+	pid := pids[0]
+	cases := []struct{ name, value, expected string }{
+		{"PID-3", pid.PatientIdentifierList().Value(), "M177323145"},
+		{"PID-5", pid.PatientName().Repetition(0).Component(2).Value(), "FIRSTNAME"},
+		{"PID-8", pid.AdministrativeSex().Value(), "M"},
+		{"PID-11", pid.PatientAddress().Repetition(1).Component(1).Value(), "STREET3"},
+		{"PID-22", pid.EthnicGroup().Repetition(0).Component(2).Value(), "UNKNOWN"},
+		{"PID-35", pid.SpeciesCode().Repetition(0).Component(2).Value(), "Homo sapiens (organism)"},
+		{"SFT-3", SegmentOf[SFT](parsed, 0).SoftwareProductName().Value(), "Cloverleaf IE"},
+		{"ORC-21", SegmentOf[ORC](parsed, 0).OrderingFacilityName().Value(), "Eastman Medical Center"},
+		{"OBR-4", SegmentOf[OBR](parsed, 0).UniversalServiceIdentifier().Repetition(0).Component(4).Value(), "MPXDX"},
+		{"OBX-5", SegmentOf[OBX](parsed, 0).ObservationValue().Repetition(0).Component(2).Value(), "Undetected"},
+		{"OBX-23", SegmentOf[OBX](parsed, 0).PerformingOrganizationName().Value(), "KCLab-RO Main Campus"},
+		{"NTE(2)-3", SegmentOf[NTE](parsed, 1).Comment().Value(), "PCR primer and probe set."},
+		{"SPM-17", SegmentOf[SPM](parsed, 0).SpecimenCollectionDateTime().Value(), "20220723105000-0500"},
+	}
+	for _, c := range cases {
+		if c.value != c.expected {
+			t.Logf("%s should be '%s' but got '%s'", c.name, c.expected, c.value)
+			t.Fail()
+		}
+	}
+}
+
+func TestSegmentOf_Missing(t *testing.T) {
+	parsed, err := ParseMessage(simpleHl7Message)
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	// the message has no PV1 or NK1, and only one OBX
+	if pv1 := SegmentOf[PV1](parsed, 0); pv1.Parsed() != nil || pv1.PatientClass() != nil || pv1.Value(2) != "" {
+		t.Log("a missing PV1 should have no fields")
+		t.Fail()
+	}
+	if nk1s := SegmentsOf[NK1](parsed); len(nk1s) != 0 {
+		t.Logf("expected no NK1 segments but got %d", len(nk1s))
+		t.Fail()
+	}
+	if obx := SegmentOf[OBX](parsed, 1); obx.ObservationValue().Value() != "" {
+		t.Log("a second OBX should be empty")
+		t.Fail()
+	}
+}
+
+func TestNewSegment(t *testing.T) {
+	delimiters := DefaultDelimiters
+	segment, err := ParseSegment(`NK1|1|SMITH^JANE|MTH^Mother^HL70063||^PRN^PH^^1^555^5551234|||||R\T\D`, delimiters)
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	nk1, err := NewSegment[NK1](segment, delimiters)
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	if nk1.Name().Repetition(0).Component(1).Value() != "SMITH" {
+		t.Logf("expected SMITH but got '%s'", nk1.Name().Value())
+		t.Fail()
+	}
+	if nk1.Relationship().Repetition(0).Component(2).Value() != "Mother" {
+		t.Logf("expected Mother but got '%s'", nk1.Relationship().Repetition(0).Component(2).Value())
+		t.Fail()
+	}
+	// Value decodes the escape sequences
+	if nk1.Value(10) != "R&D" {
+		t.Logf("expected 'R&D' but got '%s'", nk1.Value(10))
+		t.Fail()
+	}
+	if _, err := NewSegment[PID](segment, delimiters); !errors.Is(err, ErrInvalidSpecification) {
+		t.Log("an NK1 shouldn't be read as a PID", err)
+		t.Fail()
+	}
+	if _, err := NewSegment[PID](nil, delimiters); !errors.Is(err, ErrInvalidSpecification) {
+		t.Log("a nil segment shouldn't be read as a PID", err)
+		t.Fail()
+	}
+}
+
+func TestTypedSegment_Raw(t *testing.T) {
+	parsed, err := ParseMessage(simpleHl7Message)
+	if err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	pid := SegmentOf[PID](parsed, 0)
+	expected := "STREET1^STREET2^CITY^CA^90210^COUNTRY^^^COUNTY~STREET3^STREET4^CITY^CA^90210^COUNTRY^^^COUNTY"
+	if pid.Raw(11) != expected {
+		t.Logf("PID-11 should be '%s' but got '%s'", expected, pid.Raw(11))
+		t.Fail()
+	}
+	if pid.Raw(50) != "" {
+		t.Logf("a missing field should be empty but got '%s'", pid.Raw(50))
+		t.Fail()
+	}
+}
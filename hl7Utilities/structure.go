@@ -0,0 +1,264 @@
+package hl7Utilities
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StructureElement - one entry in a message structure, either a segment or a named group of
+// elements, along with whether it's required and whether it can repeat
+type StructureElement struct {
+	Name      string
+	Required  bool
+	Repeating bool
+	// Children - the elements of a group, in order. this is nil for segments
+	Children []*StructureElement
+}
+
+// IsGroup - true when the element is a group of other elements rather than a segment
+func (e *StructureElement) IsGroup() bool {
+	return e.Children != nil
+}
+
+// MessageStructure - the abstract message definition for a message structure like ORU_R01, which
+// lays out the order of its segments and how they are grouped
+type MessageStructure struct {
+	Name     string
+	Version  string
+	Elements []*StructureElement
+}
+
+// ParseStructureDefinition - reads a message structure written in the notation the HL7 standard
+// uses for abstract message definitions. a bare segment name is required, [ ] marks optional
+// elements, { } repeating ones, and a group is written with its name and a colon, so
+//
+//	MSH [{SFT}] {PATIENT_RESULT: [PATIENT: PID [PD1]] {ORDER_OBSERVATION: [ORC] OBR}}
+//
+// has a required MSH, any number of SFT, and one or more PATIENT_RESULT groups. use ( ) for a group
+// that is required and doesn't repeat
+func ParseStructureDefinition(name, version, definition string) (*MessageStructure, error) {
+	tokens := tokenizeStructureDefinition(definition)
+	parser := structureParser{tokens: tokens}
+	elements, err := parser.parseElements("")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the %s %s structure: %w", name, version, err)
+	}
+	if parser.position < len(tokens) {
+		return nil, fmt.Errorf(
+			"unable to parse the %s %s structure: unexpected '%s'",
+			name,
+			version,
+			tokens[parser.position],
+		)
+	}
+	return &MessageStructure{Name: name, Version: version, Elements: elements}, nil
+}
+
+// tokenizeStructureDefinition - splits a definition into brackets and names
+func tokenizeStructureDefinition(definition string) []string {
+	for _, bracket := range []string{"[", "]", "{", "}", "(", ")"} {
+		definition = strings.ReplaceAll(definition, bracket, " "+bracket+" ")
+	}
+	return strings.Fields(definition)
+}
+
+// structureParser - walks the tokens of a structure definition
+type structureParser struct {
+	tokens   []string
+	position int
+}
+
+// closingBracket - the bracket that ends each opening bracket
+var closingBracket = map[string]string{"[": "]", "{": "}", "(": ")"}
+
+// parseElements - reads elements until we hit the closing bracket, or the end of the definition
+// when closing is empty
+func (p *structureParser) parseElements(closing string) ([]*StructureElement, error) {
+	elements := make([]*StructureElement, 0)
+	for p.position < len(p.tokens) {
+		token := p.tokens[p.position]
+		if token == closing {
+			return elements, nil
+		}
+		element, err := p.parseElement()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	if closing != "" {
+		return nil, fmt.Errorf("missing '%s'", closing)
+	}
+	return elements, nil
+}
+
+// parseElement - reads a single segment, or a bracketed element
+func (p *structureParser) parseElement() (*StructureElement, error) {
+	token := p.tokens[p.position]
+	p.position++
+	closing, isBracket := closingBracket[token]
+	if !isBracket {
+		if !segmentNamePattern.MatchString(token) {
+			return nil, fmt.Errorf("'%s' is not a segment name", token)
+		}
+		return &StructureElement{Name: token, Required: true}, nil
+	}
+	var element *StructureElement
+	if p.position < len(p.tokens) && strings.HasSuffix(p.tokens[p.position], ":") {
+		// a named group
+		groupName := strings.TrimSuffix(p.tokens[p.position], ":")
+		p.position++
+		children, err := p.parseElements(closing)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) == 0 {
+			return nil, fmt.Errorf("group %s is empty", groupName)
+		}
+		element = &StructureElement{Name: groupName, Required: true, Children: children}
+	} else {
+		if p.position >= len(p.tokens) {
+			return nil, fmt.Errorf("missing '%s'", closing)
+		}
+		inner, err := p.parseElement()
+		if err != nil {
+			return nil, err
+		}
+		element = inner
+	}
+	if p.position >= len(p.tokens) || p.tokens[p.position] != closing {
+		return nil, fmt.Errorf("missing '%s' after %s", closing, element.Name)
+	}
+	p.position++
+	switch token {
+	case "[":
+		element.Required = false
+	case "{":
+		element.Repeating = true
+	}
+	return element, nil
+}
+
+// structureFiles - the abstract message definitions we ship with, one file per structure under a
+// directory for each version, like structures/2.5.1/ORU_R01.txt. ORM_O01 was withdrawn in v2.7 and
+// OML_O21 was introduced in v2.4, so those versions fall back to the nearest one we have
+//
+//go:embed structures
+var structureFiles embed.FS
+
+// eventStructures - trigger events that share another event's structure, like ADT^A04 which is
+// laid out exactly like ADT^A01. events not listed here use a structure with their own name
+var eventStructures = map[string]string{
+	"ADT_A04": "ADT_A01",
+	"ADT_A08": "ADT_A01",
+	"ADT_A13": "ADT_A01",
+	"ORU_R30": "ORU_R01",
+	"ORU_R31": "ORU_R01",
+	"ORU_R32": "ORU_R01",
+}
+
+// structureCache - definitions we've already parsed, keyed by name and version
+var structureCache = struct {
+	sync.Mutex
+	structures map[string]*MessageStructure
+}{structures: make(map[string]*MessageStructure)}
+
+// StructureName - the name of the message structure for an MSH-9 message type. MSH-9-3 names it
+// directly when the sender fills it in, otherwise we work it out from the message code and trigger
+// event, and every ACK shares a single structure
+func StructureName(messageCode, triggerEvent, messageStructure string) string {
+	if messageStructure != "" {
+		return messageStructure
+	}
+	if messageCode == "ACK" {
+		return "ACK"
+	}
+	event := fmt.Sprintf("%s_%s", messageCode, triggerEvent)
+	if structure, ok := eventStructures[event]; ok {
+		return structure
+	}
+	return event
+}
+
+// LookupStructure - returns the structure definition for a message structure name like ORU_R01 and
+// a version like 2.5.1. when we don't have a definition for the exact version we use the newest one
+// we have that is older than it, or the oldest we have if they're all newer, since a structure rarely
+// changes in ways that matter for grouping between versions
+func LookupStructure(structureName, version string) (*MessageStructure, error) {
+	selected, err := nearestVersion(structureFiles, "structures", structureName+".txt", version)
+	if err != nil {
+		return nil, fmt.Errorf("no structure definition for %s", structureName)
+	}
+	key := structureName + "/" + selected
+	structureCache.Lock()
+	defer structureCache.Unlock()
+	if structure, ok := structureCache.structures[key]; ok {
+		return structure, nil
+	}
+	definition, err := structureFiles.ReadFile(path.Join("structures", selected, structureName+".txt"))
+	if err != nil {
+		return nil, err
+	}
+	structure, err := ParseStructureDefinition(structureName, selected, string(definition))
+	if err != nil {
+		return nil, err
+	}
+	structureCache.structures[key] = structure
+	return structure, nil
+}
+
+// nearestVersion - picks which version directory under the root to read the file from for a version,
+// the newest that isn't newer than it, or the oldest if they all are. an empty version gets the newest
+func nearestVersion(files fs.FS, root, fileName, version string) (string, error) {
+	versions, err := fs.ReadDir(files, root)
+	if err != nil {
+		return "", err
+	}
+	var known []string
+	for _, v := range versions {
+		if _, err := fs.Stat(files, path.Join(root, v.Name(), fileName)); err == nil {
+			known = append(known, v.Name())
+		}
+	}
+	if len(known) == 0 {
+		return "", fs.ErrNotExist
+	}
+	sort.Slice(known, func(i, j int) bool {
+		return compareVersions(known[i], known[j]) < 0
+	})
+	selected := known[0]
+	for _, v := range known {
+		if version == "" || compareVersions(v, version) <= 0 {
+			selected = v
+		}
+	}
+	return selected, nil
+}
+
+// compareVersions - compares two HL7 versions like 2.3.1 and 2.5 part by part, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bPart, _ = strconv.Atoi(bParts[i])
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,203 @@
+package hl7Utilities
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestStructureFiles(t *testing.T) {
+	// every definition we ship has to parse
+	err := fs.WalkDir(structureFiles, "structures", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		definition, err := structureFiles.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(path.Base(filePath), ".txt")
+		structure, err := ParseStructureDefinition(name, path.Base(path.Dir(filePath)), string(definition))
+		if err != nil {
+			t.Errorf("%s: %v", filePath, err)
+			return nil
+		}
+		if structure.Elements[0].Name != "MSH" {
+			t.Errorf("%s: structure should start with MSH", filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookupStructure(t *testing.T) {
+	tests := []struct {
+		structure   string
+		version     string
+		wantVersion string
+		wantErr     bool
+	}{
+		{"ORU_R01", "2.5.1", "2.5.1", false},
+		{"ORU_R01", "2.3", "2.3.1", false},
+		{"ORU_R01", "2.4", "2.3.1", false},
+		{"ORU_R01", "2.6", "2.5.1", false},
+		{"ORU_R01", "2.8", "2.7", false},
+		{"ORU_R01", "", "2.7", false},
+		{"ADT_A01", "2.7.1", "2.7", false},
+		{"ACK", "2.3.1", "2.3.1", false},
+		// ORM_O01 was withdrawn in v2.7 and OML_O21 didn't exist before v2.4
+		{"ORM_O01", "2.7", "2.5.1", false},
+		{"OML_O21", "2.3.1", "2.5.1", false},
+		{"ZZZ_Z01", "2.5.1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.structure+" "+tt.version, func(t *testing.T) {
+			got, err := LookupStructure(tt.structure, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupStructure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Version != tt.wantVersion || got.Name != tt.structure) {
+				t.Errorf("LookupStructure() = %s %s, want %s %s", got.Name, got.Version, tt.structure, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestStructureName(t *testing.T) {
+	tests := []struct {
+		code, event, structure string
+		want                   string
+	}{
+		{"ORU", "R01", "ORU_R01", "ORU_R01"},
+		{"ORU", "R01", "", "ORU_R01"},
+		{"ADT", "A04", "", "ADT_A01"},
+		{"ADT", "A08", "", "ADT_A01"},
+		{"ADT", "A04", "ADT_A01", "ADT_A01"},
+		{"ACK", "R01", "", "ACK"},
+		{"ACK", "", "", "ACK"},
+		{"OML", "O21", "", "OML_O21"},
+	}
+	for _, tt := range tests {
+		if got := StructureName(tt.code, tt.event, tt.structure); got != tt.want {
+			t.Errorf("StructureName(%s, %s, %s) = %s, want %s", tt.code, tt.event, tt.structure, got, tt.want)
+		}
+	}
+}
+
+func Test_compareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.5.1", "2.5.1", 0},
+		{"2.5", "2.5.1", -1},
+		{"2.3.1", "2.3", 1},
+		{"2.10", "2.9", 1},
+		{"2.7", "2.8", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParsedMessage_StructureSelection(t *testing.T) {
+	tests := []struct {
+		name          string
+		message       string
+		wantStructure string
+		wantVersion   string
+		wantGroups    []string
+	}{
+		{
+			"ADT A04 uses the A01 structure",
+			"MSH|^~\\&|A|B|||20220802||ADT^A04|1|P|2.5.1\rEVN|A04\rPID|1||M1\rPV1|1|O\rIN1|1|PLAN\rIN2|1\rIN1|2|PLAN2",
+			"ADT_A01",
+			"2.5.1",
+			[]string{"MSH", "EVN", "PID", "PV1", "INSURANCE", "INSURANCE"},
+		},
+		{
+			"v2.3 ACK without a trigger event",
+			"MSH|^~\\&|A|B|||20220802||ACK|1|P|2.3\rMSA|AA|1\rERR|",
+			"ACK",
+			"2.3.1",
+			[]string{"MSH", "MSA", "ERR"},
+		},
+		{
+			"ORM with an order detail",
+			"MSH|^~\\&|A|B|||20220802||ORM^O01|1|P|2.3.1\rPID|1\rORC|NW|1\rOBR|1|1\rNTE|1||note\rORC|NW|2\rOBR|2|2",
+			"ORM_O01",
+			"2.3.1",
+			[]string{"MSH", "PATIENT", "ORDER", "ORDER"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseMessage(tt.message)
+			if err != nil {
+				t.Fatalf("ParseMessage() error = %v", err)
+			}
+			structure, err := parsed.Structure()
+			if err != nil {
+				t.Fatalf("Structure() error = %v", err)
+			}
+			if structure.Name != tt.wantStructure || structure.Version != tt.wantVersion {
+				t.Errorf("Structure() = %s %s, want %s %s", structure.Name, structure.Version, tt.wantStructure, tt.wantVersion)
+			}
+			root, err := parsed.MessageGroups()
+			if err != nil {
+				t.Fatalf("MessageGroups() error = %v", err)
+			}
+			var got []string
+			for _, c := range root.Children {
+				if c.Segment != nil {
+					got = append(got, c.Segment.Name)
+				} else {
+					got = append(got, c.Group.Name)
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantGroups, " ") {
+				t.Errorf("MessageGroups() = %v, want %v", got, tt.wantGroups)
+			}
+			if issues := parsed.StructureIssues(structure); len(issues) != 0 {
+				t.Errorf("StructureIssues() = %v, want none", issues)
+			}
+		})
+	}
+}
+
+func TestParsedMessage_StructureIssues(t *testing.T) {
+	// a second patient, a segment that has no business in an ORU, and a Z segment which is allowed
+	// anywhere
+	raw := "MSH|^~\\&|A|B|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\r" +
+		"PID|1||M1\rOBR|1\rOBX|1|ST|A||a\rPID|2||M2\rZPI|1\rOBR|1\rOBX|1|ST|B||b\rRXA|1"
+	parsed, err := ParseMessage(raw)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	structure, err := parsed.Structure()
+	if err != nil {
+		t.Fatalf("Structure() error = %v", err)
+	}
+	issues := parsed.StructureIssues(structure)
+	if len(issues) != 1 {
+		t.Fatalf("StructureIssues() = %v, want 1 issue", issues)
+	}
+	if issues[0].Segment.Name != "RXA" || issues[0].Position != 8 ||
+		!strings.Contains(issues[0].Description, "not part of") {
+		t.Errorf("StructureIssues()[0] = %+v", issues[0])
+	}
+	// a second PID starts a new PATIENT_RESULT, which is legal, but one after the order within the
+	// same group is out of order
+	raw = "MSH|^~\\&|A|B|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\r" +
+		"PID|1||M1\rOBR|1\rOBX|1|ST|A||a\rPD1|1"
+	parsed, _ = ParseMessage(raw)
+	issues = parsed.StructureIssues(structure)
+	if len(issues) != 1 || issues[0].Segment.Name != "PD1" || !strings.Contains(issues[0].Description, "out of order") {
+		t.Errorf("StructureIssues() = %+v, want PD1 out of order", issues)
+	}
+}
@@ -0,0 +1,257 @@
+package hl7Utilities
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TableEntry - one code in an HL7 table and what it means
+type TableEntry struct {
+	Code    string
+	Display string
+}
+
+// Table - an HL7 table, the set of codes a coded field can hold, like table 0001 for administrative sex
+type Table struct {
+	// Id - the table number, always four digits, like 0001
+	Id   string
+	Name string
+	// Entries - the codes in the order they were loaded
+	Entries []TableEntry
+	index   map[string]int
+}
+
+// NewTable - builds a table from its entries. a code listed twice keeps the last display it was given
+func NewTable(id, name string, entries []TableEntry) *Table {
+	table := &Table{Id: normalizeTableId(id), Name: name, index: make(map[string]int)}
+	for _, e := range entries {
+		if i, ok := table.index[e.Code]; ok {
+			table.Entries[i] = e
+			continue
+		}
+		table.index[e.Code] = len(table.Entries)
+		table.Entries = append(table.Entries, e)
+	}
+	return table
+}
+
+// Contains - true when the code is in the table. codes are case sensitive, the same as in HL7
+func (t *Table) Contains(code string) bool {
+	_, ok := t.index[code]
+	return ok
+}
+
+// Display - what the code means, and whether the table has it at all
+func (t *Table) Display(code string) (string, bool) {
+	i, ok := t.index[code]
+	if !ok {
+		return "", false
+	}
+	return t.Entries[i].Display, true
+}
+
+// ReadTableCSV - reads a table from CSV with a code and a display in each row. a first row of
+// `code,display` is taken to be a header and skipped
+func ReadTableCSV(id, name string, r io.Reader) (*Table, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read table %s: %w", id, err)
+	}
+	if len(records) > 0 && strings.EqualFold(records[0][0], "code") && strings.EqualFold(records[0][1], "display") {
+		records = records[1:]
+	}
+	entries := make([]TableEntry, 0, len(records))
+	for i, record := range records {
+		code := strings.TrimSpace(record[0])
+		if code == "" {
+			return nil, fmt.Errorf("unable to read table %s: row %d has no code", id, i+1)
+		}
+		entries = append(entries, TableEntry{Code: code, Display: strings.TrimSpace(record[1])})
+	}
+	return NewTable(id, name, entries), nil
+}
+
+// normalizeTableId - turns the ways people write table numbers, like 1, 0001 and HL70001, into the
+// four digits we key tables by
+func normalizeTableId(id string) string {
+	id = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(id)), "HL7")
+	if number, err := strconv.Atoi(id); err == nil && number >= 0 {
+		return fmt.Sprintf("%04d", number)
+	}
+	return id
+}
+
+// tableNames - the names of the tables we ship with
+var tableNames = map[string]string{
+	"0001": "Administrative Sex",
+	"0002": "Marital Status",
+	"0004": "Patient Class",
+	"0005": "Race",
+	"0008": "Acknowledgment Code",
+	"0065": "Specimen Action Code",
+	"0078": "Abnormal Flags",
+	"0085": "Observation Result Status Codes Interpretation",
+	"0103": "Processing ID",
+	"0104": "Version ID",
+	"0105": "Source of Comment",
+	"0119": "Order Control Codes",
+	"0123": "Result Status",
+	"0125": "Value Type",
+	"0136": "Yes/No Indicator",
+	"0155": "Accept/Application Acknowledgment Conditions",
+	"0189": "Ethnic Group",
+	"0357": "Message Error Condition Codes",
+	"0516": "Error Severity",
+}
+
+// tableFiles - the tables we ship with, one CSV per table named after its number, like tables/0001.csv.
+// the user defined tables, like race in 0005, hold the values HL7 suggests along with the CDC codes
+// US senders use
+//
+//go:embed tables
+var tableFiles embed.FS
+
+// Tables - a set of HL7 tables to look codes up in. the tables we ship with are always there, and
+// local tables can be loaded on top of them
+type Tables struct {
+	mu     sync.RWMutex
+	tables map[string]*Table
+}
+
+// DefaultTables - the tables Validate checks coded fields against. load local tables into it to have
+// them used everywhere
+var DefaultTables = NewTables()
+
+// NewTables - a set holding the tables we ship with
+func NewTables() *Tables {
+	tables := &Tables{tables: make(map[string]*Table)}
+	files, err := tableFiles.ReadDir("tables")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		id := strings.TrimSuffix(f.Name(), ".csv")
+		file, err := tableFiles.Open(path.Join("tables", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		table, err := ReadTableCSV(id, tableNames[id], file)
+		file.Close()
+		if err != nil {
+			// the files are embedded, so this can only be a mistake in one of them
+			panic(err)
+		}
+		tables.tables[table.Id] = table
+	}
+	return tables
+}
+
+// Table - the table with the number, like 0001, 1 or HL70001, or nil if there isn't one
+func (t *Tables) Table(id string) *Table {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.tables[normalizeTableId(id)]
+}
+
+// Ids - the numbers of every table in the set, in order
+func (t *Tables) Ids() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ids := make([]string, 0, len(t.tables))
+	for id := range t.tables {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Add - adds a local table to the set. when there's already a table with its number the two are
+// merged, so a site can add its own codes to a user defined table like 0005 and still have the
+// standard ones, with the local display winning for codes they share
+func (t *Tables) Add(table *Table) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	existing, ok := t.tables[table.Id]
+	if !ok {
+		t.tables[table.Id] = table
+		return
+	}
+	name := table.Name
+	if name == "" {
+		name = existing.Name
+	}
+	entries := append(append([]TableEntry{}, existing.Entries...), table.Entries...)
+	t.tables[table.Id] = NewTable(table.Id, name, entries)
+}
+
+// LoadCSV - reads a local table from a CSV file named after the table, like 0005.csv or HL70005.csv,
+// and adds it to the set
+func (t *Tables) LoadCSV(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	id := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	table, err := ReadTableCSV(id, "", file)
+	if err != nil {
+		return err
+	}
+	t.Add(table)
+	return nil
+}
+
+// LoadCSVDirectory - loads every .csv file in the directory as a local table, see LoadCSV
+func (t *Tables) LoadCSVDirectory(directory string) error {
+	files, err := filepath.Glob(filepath.Join(directory, "*.csv"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := t.LoadCSV(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Display - what the code means in the table, and whether the table has it. a table we don't have
+// has no codes
+func (t *Tables) Display(id, code string) (string, bool) {
+	table := t.Table(id)
+	if table == nil {
+		return "", false
+	}
+	return table.Display(code)
+}
+
+// Check - returns an error wrapping ErrInvalidValue when the code isn't in the table, or
+// ErrTableNotFound when we don't have the table
+func (t *Tables) Check(id, code string) error {
+	table := t.Table(id)
+	if table == nil {
+		return fmt.Errorf("%w: HL7%s", ErrTableNotFound, normalizeTableId(id))
+	}
+	if !table.Contains(code) {
+		return fmt.Errorf("%w: '%s' is not in HL7%s %s", ErrInvalidValue, code, table.Id, table.Name)
+	}
+	return nil
+}
+
+// UsesTable - true when the value says its code is from the HL7 table, like HL70005, or doesn't say
+// where its code is from at all
+func (c CWE) UsesTable(id string) bool {
+	return c.NameOfCodingSystem == "" || normalizeTableId(c.NameOfCodingSystem) == normalizeTableId(id)
+}
@@ -0,0 +1,132 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTables_Bundled(t *testing.T) {
+	tables := NewTables()
+	cases := []struct {
+		id, code, display string
+		found             bool
+	}{
+		{"0001", "F", "Female", true},
+		{"1", "M", "Male", true},
+		{"HL70005", "2106-3", "White", true},
+		{"0189", "H", "Hispanic or Latino", true},
+		{"0085", "F", "Final results", true},
+		{"0119", "XX", "Order/service changed, unsol.", true},
+		{"0001", "f", "", false},
+		{"0001", "Q", "", false},
+		{"9999", "A", "", false},
+	}
+	for _, c := range cases {
+		display, found := tables.Display(c.id, c.code)
+		if display != c.display || found != c.found {
+			t.Logf("%s %s: expected '%s', %v but got '%s', %v", c.id, c.code, c.display, c.found, display, found)
+			t.Fail()
+		}
+	}
+	if table := tables.Table("0001"); table == nil || table.Name != "Administrative Sex" || len(table.Entries) != 6 {
+		t.Logf("unexpected table 0001 %+v", table)
+		t.Fail()
+	}
+	for _, id := range tables.Ids() {
+		if tableNames[id] == "" {
+			t.Logf("table %s has no name", id)
+			t.Fail()
+		}
+	}
+}
+
+func TestTables_Check(t *testing.T) {
+	tables := NewTables()
+	if err := tables.Check("0001", "F"); err != nil {
+		t.Log("error should be nil", err)
+		t.Fail()
+	}
+	if err := tables.Check("0001", "Q"); !errors.Is(err, ErrInvalidValue) {
+		t.Logf("expected an invalid value but got %v", err)
+		t.Fail()
+	}
+	if err := tables.Check("9999", "Q"); !errors.Is(err, ErrTableNotFound) {
+		t.Logf("expected the table to be missing but got %v", err)
+		t.Fail()
+	}
+}
+
+func TestTables_Check_nullFlavors(t *testing.T) {
+	// senders use the null flavors for a race the patient didn't give, like our sample message does
+	parsed, err := ParseMessage(simpleHl7Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := SegmentsOf[PID](parsed)[0]
+	race := NewCWE(pid.Race().Repetition(0), parsed.Delimiters, "2.5.1")
+	if !race.UsesTable("0005") || race.Identifier != "UNK" {
+		t.Fatalf("expected UNK from HL70005 in the sample but got %+v", race)
+	}
+	tables := NewTables()
+	for _, code := range []string{race.Identifier, "ASKU"} {
+		if err := tables.Check("0005", code); err != nil {
+			t.Logf("%s: error should be nil but got %v", code, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestTables_LoadCSV(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		// adds a local code to a bundled table, and renames one of its codes
+		"HL70005.csv": "code,display\nL1,Local race\n2131-1,Some other race\n",
+		// a table we don't ship with, without a header
+		"0396.csv": "LN,LOINC\n\"SCT\", \"SNOMED CT, international\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0o600); err != nil {
+			t.Fatal("unable to write the table", err)
+		}
+	}
+	tables := NewTables()
+	if err := tables.LoadCSVDirectory(directory); err != nil {
+		t.Fatal("error should be nil", err)
+	}
+	race := tables.Table("0005")
+	var codes []string
+	for _, e := range race.Entries {
+		codes = append(codes, e.Code)
+	}
+	expected := []string{"1002-5", "2028-9", "2054-5", "2076-8", "2106-3", "2131-1", "ASKU", "UNK", "L1"}
+	if !reflect.DeepEqual(codes, expected) || race.Name != "Race" {
+		t.Logf("expected the local codes to be merged in but got %v %s", codes, race.Name)
+		t.Fail()
+	}
+	if display, _ := race.Display("2131-1"); display != "Some other race" {
+		t.Logf("the local display should win but got '%s'", display)
+		t.Fail()
+	}
+	if display, _ := tables.Display("0396", "SCT"); display != "SNOMED CT, international" {
+		t.Logf("expected the new table to be loaded but got '%s'", display)
+		t.Fail()
+	}
+	// the bundled tables aren't changed by loading into another set
+	if NewTables().Table("0005").Contains("L1") {
+		t.Log("loading a local table changed the bundled one")
+		t.Fail()
+	}
+}
+
+func TestReadTableCSV_Errors(t *testing.T) {
+	for _, content := range []string{"A,One,Extra\n", "A\n", ",Nothing\n", "\"A,One\n"} {
+		if _, err := ReadTableCSV("0001", "", strings.NewReader(content)); err == nil {
+			t.Logf("%q should be an error", content)
+			t.Fail()
+		}
+	}
+}
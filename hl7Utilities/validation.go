@@ -0,0 +1,422 @@
+package hl7Utilities
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// ValidationIssue - one way a message doesn't conform to the standard, along with where it is
+type ValidationIssue struct {
+	// Location - where the problem is, written like a terser specification, like PID-7, PID-3(1) for
+	// the second repetition or OBX[2]-5 for the second OBX. the brackets count occurrences, since
+	// the parentheses after a segment mean its set ID. problems with a whole segment or group are
+	// just its name
+	Location string
+	// Segment - the segment the problem is in, empty for a missing group
+	Segment string
+	// Sequence - which occurrence of the segment, counting from 1, or zero for a segment that's missing
+	Sequence int
+	// Field, Repetition and Component - where in the segment the problem is, counting from 1 the
+	// same way ERR-2 does. zero means the problem is with the whole segment, field or repetition
+	Field      int
+	Repetition int
+	Component  int
+	// Severity - E, W or I, the same codes as ERR-4
+	Severity string
+	// Code - the HL7 error code, one of the ErrorCode constants
+	Code        string
+	Description string
+}
+
+// String - the location and description, like `PID-7: invalid DTM '19801301'`
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Location, i.Description)
+}
+
+// IsError - true for issues with an error severity, as opposed to warnings and information
+func (i ValidationIssue) IsError() bool {
+	return i.Severity == SeverityError
+}
+
+// AckError - the issue the way [GenerateAck] reports it back to the sender
+func (i ValidationIssue) AckError() AckError {
+	return AckError{
+		Segment:    i.Segment,
+		Sequence:   i.Sequence,
+		Field:      i.Field,
+		Repetition: i.Repetition,
+		Component:  i.Component,
+		Code:       i.Code,
+		Severity:   i.Severity,
+		Text:       i.String(),
+	}
+}
+
+// AckErrors - the issues the way [GenerateAck] reports them back to the sender
+func AckErrors(issues []ValidationIssue) []AckError {
+	errors := make([]AckError, 0, len(issues))
+	for _, i := range issues {
+		errors = append(errors, i.AckError())
+	}
+	return errors
+}
+
+// Validate - parses the message and checks it, see [ParsedMessage.Validate]
+func (message Hl7Message) Validate() ([]ValidationIssue, error) {
+	parsed, err := message.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Validate(), nil
+}
+
+// Validate - checks the message against the standard for the version in MSH-12, returning every
+// problem found rather than stopping at the first. the segments have to be in the order the message
+// structure says, with the required segments and groups present. the fields of the segments we have
+// definitions for have to be valued when they're required, can't repeat more than they're allowed
+// to, and NM, SI, DT, TM, DTM, TS, ST and ID values have to be in the right format. values that
+// are too long are only warnings, since receivers are allowed to truncate them.
+//
+// coded fields are checked against [DefaultTables]. codes missing from a table HL7 defines, the
+// ones ID fields use, are errors, while codes missing from the user defined tables are warnings, since
+// sites add their own codes to those.
+//
+// a message without a structure we know of has its fields checked all the same, with a warning that
+// its structure couldn't be
+func (m *ParsedMessage) Validate() []ValidationIssue {
+	return m.ValidateWithTables(DefaultTables)
+}
+
+// ValidateWithTables - checks the message the same way Validate does, looking codes up in the tables
+func (m *ParsedMessage) ValidateWithTables(tables *Tables) []ValidationIssue {
+	v := &validator{message: m, tables: tables}
+	msh := m.Segment("MSH", 0)
+	if msh == nil {
+		v.add(ValidationIssue{
+			Location:    "MSH",
+			Segment:     "MSH",
+			Severity:    SeverityError,
+			Code:        ErrorCodeSegmentSequence,
+			Description: "the message does not start with an MSH segment",
+		})
+		return v.issues
+	}
+	v.version = msh.Field(12).Repetition(0).Component(1).Value()
+	if structure, err := m.Structure(); err != nil {
+		v.add(ValidationIssue{
+			Location:    "MSH-9",
+			Segment:     "MSH",
+			Sequence:    1,
+			Field:       9,
+			Severity:    SeverityWarning,
+			Code:        ErrorCodeUnsupportedMessage,
+			Description: fmt.Sprintf("unable to check the structure: %v", err),
+		})
+	} else {
+		v.checkStructure(structure)
+	}
+	occurrences := make(map[string]int)
+	for _, segment := range m.Segments {
+		occurrences[segment.Name]++
+		v.checkSegment(segment, occurrences[segment.Name])
+	}
+	return v.issues
+}
+
+// validator - collects the issues while we check a message
+type validator struct {
+	message *ParsedMessage
+	tables  *Tables
+	version string
+	issues  []ValidationIssue
+}
+
+// add - records an issue
+func (v *validator) add(issue ValidationIssue) {
+	v.issues = append(v.issues, issue)
+}
+
+// checkStructure - reports the segments that are out of order or don't belong, and the required
+// segments and groups that are missing
+func (v *validator) checkStructure(structure *MessageStructure) {
+	root, structureIssues := v.message.arrange(structure)
+	occurrences := segmentOccurrences(v.message)
+	for _, issue := range structureIssues {
+		v.add(ValidationIssue{
+			Location:    segmentLocation(issue.Segment.Name, occurrences[issue.Segment]),
+			Segment:     issue.Segment.Name,
+			Sequence:    occurrences[issue.Segment],
+			Severity:    SeverityError,
+			Code:        ErrorCodeSegmentSequence,
+			Description: issue.Description,
+		})
+	}
+	v.checkGroup(root, &StructureElement{Name: structure.Name, Children: structure.Elements})
+}
+
+// checkGroup - reports the required elements missing from one occurrence of a group, then checks the
+// groups nested in it
+func (v *validator) checkGroup(group *MessageGroup, element *StructureElement) {
+	present := make(map[string]bool)
+	for _, child := range group.Children {
+		if child.Group != nil {
+			present[child.Group.Name] = true
+		} else {
+			present[child.Segment.Name] = true
+		}
+	}
+	for _, child := range element.Children {
+		if !child.Required || present[child.Name] {
+			continue
+		}
+		issue := ValidationIssue{
+			Location:    child.Name,
+			Severity:    SeverityError,
+			Code:        ErrorCodeSegmentSequence,
+			Description: fmt.Sprintf("required segment %s is missing from %s", child.Name, group.Name),
+		}
+		if child.IsGroup() {
+			issue.Description = fmt.Sprintf("required group %s is missing from %s", child.Name, group.Name)
+		} else {
+			issue.Segment = child.Name
+		}
+		v.add(issue)
+	}
+	for _, child := range group.Children {
+		if child.Group == nil {
+			continue
+		}
+		for _, e := range element.Children {
+			if e.IsGroup() && e.Name == child.Group.Name {
+				v.checkGroup(child.Group, e)
+				break
+			}
+		}
+	}
+}
+
+// checkSegment - checks the fields of a segment we have a definition for
+func (v *validator) checkSegment(segment *ParsedSegment, occurrence int) {
+	definition, err := LookupSegmentDefinition(segment.Name, v.version)
+	if err != nil {
+		// Z segments and the segments we don't ship definitions for
+		return
+	}
+	for _, fieldDefinition := range definition.Fields {
+		v.checkField(segment, occurrence, fieldDefinition)
+	}
+}
+
+// checkField - checks one field of a segment against its definition
+func (v *validator) checkField(segment *ParsedSegment, occurrence int, definition *FieldDefinition) {
+	issue := func(repetition, component int, severity, code, description string) {
+		v.add(fieldIssue(segment.Name, occurrence, definition.Position, repetition, component, severity, code, description))
+	}
+	field := segment.Field(definition.Position)
+	if fieldEmpty(field) {
+		if definition.Required() {
+			issue(0, 0, SeverityError, ErrorCodeRequiredFieldMissing, fmt.Sprintf("required field %s is missing", definition.Name))
+		}
+		return
+	}
+	if definition.MaxRepetitions > 0 && len(field.Repetitions) > definition.MaxRepetitions {
+		issue(0, 0, SeverityError, ErrorCodeDataType, fmt.Sprintf(
+			"%s repeats %d times but can only repeat %d",
+			definition.Name,
+			len(field.Repetitions),
+			definition.MaxRepetitions,
+		))
+	}
+	dataType := definition.DataType
+	if dataType == "varies" && segment.Name == "OBX" {
+		dataType = segment.Field(2).Value()
+	}
+	for i, r := range field.Repetitions {
+		if definition.MaxLength > 0 {
+			if length := utf8.RuneCountInString(r.encode(v.message.Delimiters, false)); length > definition.MaxLength {
+				issue(i+1, 0, SeverityWarning, ErrorCodeValueTooLong, fmt.Sprintf(
+					"%s is %d characters long but can only be %d",
+					definition.Name,
+					length,
+					definition.MaxLength,
+				))
+			}
+		}
+		component, description := v.checkDataType(dataType, r)
+		if description != "" {
+			issue(i+1, component, SeverityError, ErrorCodeDataType, description)
+			continue
+		}
+		if definition.Table != "" {
+			if severity, description := v.checkTable(dataType, definition.Table, r); description != "" {
+				issue(i+1, 0, severity, ErrorCodeTableValueNotFound, description)
+			}
+		}
+	}
+}
+
+// fieldEmpty - true when the field is missing or none of its repetitions has a value
+func fieldEmpty(field *Field) bool {
+	if field == nil {
+		return true
+	}
+	for _, r := range field.Repetitions {
+		if !repetitionEmpty(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// repetitionEmpty - true when none of the repetition's components has a value
+func repetitionEmpty(r *Repetition) bool {
+	for _, c := range r.Components {
+		for _, s := range c.Subcomponents {
+			if s != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// primitiveTypes - the data types that are a single value, which can't have components
+var primitiveTypes = map[string]bool{
+	"ST": true, "TX": true, "FT": true, "ID": true, "IS": true, "NM": true, "SI": true, "DT": true, "TM": true, "DTM": true,
+}
+
+// checkDataType - checks the format of a repetition, returning the component the problem is in, if
+// it's in one, and what's wrong, or an empty description when it's fine. composite types other than
+// TS aren't checked
+func (v *validator) checkDataType(dataType string, r *Repetition) (int, string) {
+	if primitiveTypes[dataType] {
+		if len(r.Components) > 1 || len(r.Components[0].Subcomponents) > 1 {
+			return 0, fmt.Sprintf("invalid %s: %s values can't have components", dataType, dataType)
+		}
+		return 0, checkPrimitive(dataType, v.message.Delimiters.Decode(r.Value()))
+	}
+	if dataType == "TS" {
+		// TS-1 is the DTM. TS-2 is the degree of precision, which was deprecated before anyone used it
+		return 0, checkPrimitive("DTM", r.Value())
+	}
+	return 0, ""
+}
+
+// hl7TableTypes - the data types whose codes come from tables HL7 defines, rather than ones each site
+// can add to
+var hl7TableTypes = map[string]bool{"ID": true, "PT": true, "VID": true}
+
+// checkTable - checks the code in a repetition is in the field's table, returning the severity and
+// what's wrong, or an empty description when it's fine or we don't have the table. CE, CWE and CNE
+// values are only checked when they say they're using the HL7 table, or don't say what they're using
+func (v *validator) checkTable(dataType, tableId string, r *Repetition) (string, string) {
+	table := v.tables.Table(tableId)
+	if table == nil {
+		return "", ""
+	}
+	switch dataType {
+	case "CE", "CWE", "CNE":
+		codingSystem := r.Component(3).Value()
+		if codingSystem != "" && normalizeTableId(codingSystem) != table.Id {
+			return "", ""
+		}
+	case "ID", "IS", "PT", "VID":
+	default:
+		return "", ""
+	}
+	code := v.message.Delimiters.Decode(r.Value())
+	if code == "" || code == explicitNull || table.Contains(code) {
+		return "", ""
+	}
+	severity := SeverityWarning
+	if hl7TableTypes[dataType] {
+		severity = SeverityError
+	}
+	return severity, fmt.Sprintf("'%s' is not in HL7%s %s", code, table.Id, table.Name)
+}
+
+var (
+	numericPattern    = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+	sequenceIdPattern = regexp.MustCompile(`^[0-9]+$`)
+	timePattern       = regexp.MustCompile(`^([01][0-9]|2[0-3])([0-5][0-9]([0-5][0-9](\.[0-9]{1,4})?)?)?([+-][0-9]{4})?$`)
+	whitespacePattern = regexp.MustCompile(`\s`)
+	explicitNull      = `""`
+)
+
+// checkPrimitive - checks the format of a single value, returning what's wrong with it or an empty
+// string when it's fine. empty values and the explicit null `""` are always fine
+func checkPrimitive(dataType, value string) string {
+	if value == "" || value == explicitNull {
+		return ""
+	}
+	valid := true
+	switch dataType {
+	case "NM":
+		valid = numericPattern.MatchString(value)
+	case "SI":
+		valid = sequenceIdPattern.MatchString(value)
+	case "TM":
+		valid = timePattern.MatchString(value)
+	case "DTM":
+		_, err := ParseDTM(value, nil)
+		valid = err == nil
+	case "DT":
+		dtm, err := ParseDTM(value, nil)
+		valid = err == nil && dtm.Precision <= PrecisionDay && !dtm.HasOffset
+	case "ID":
+		// coded values never have spaces in them, so one with spaces is free text in the wrong place
+		valid = !whitespacePattern.MatchString(value)
+	}
+	if !valid {
+		return fmt.Sprintf("invalid %s '%s'", dataType, value)
+	}
+	return ""
+}
+
+// segmentLocation - the segment name, with the occurrence in brackets after the first
+func segmentLocation(name string, occurrence int) string {
+	if occurrence > 1 {
+		return fmt.Sprintf("%s[%d]", name, occurrence)
+	}
+	return name
+}
+
+// fieldLocation - where a field, or a repetition or component of it, is, like PID-3(1)-4. the
+// repetition and component count from 1, with zero leaving them out
+func fieldLocation(segmentName string, occurrence, field, repetition, component int) string {
+	location := fmt.Sprintf("%s-%d", segmentLocation(segmentName, occurrence), field)
+	if repetition > 1 {
+		location += fmt.Sprintf("(%d)", repetition-1)
+	}
+	if component > 0 {
+		location += fmt.Sprintf("-%d", component)
+	}
+	return location
+}
+
+// fieldIssue - an issue with a field, or a repetition or component of it
+func fieldIssue(segmentName string, occurrence, field, repetition, component int, severity, code, description string) ValidationIssue {
+	return ValidationIssue{
+		Location:    fieldLocation(segmentName, occurrence, field, repetition, component),
+		Segment:     segmentName,
+		Sequence:    occurrence,
+		Field:       field,
+		Repetition:  repetition,
+		Component:   component,
+		Severity:    severity,
+		Code:        code,
+		Description: description,
+	}
+}
+
+// segmentOccurrences - which occurrence of its name each segment in the message is, counting from 1
+func segmentOccurrences(m *ParsedMessage) map[*ParsedSegment]int {
+	occurrences := make(map[*ParsedSegment]int)
+	counts := make(map[string]int)
+	for _, segment := range m.Segments {
+		counts[segment.Name]++
+		occurrences[segment] = counts[segment.Name]
+	}
+	return occurrences
+}
@@ -0,0 +1,204 @@
+package hl7Utilities
+
+import (
+	"strings"
+	"testing"
+)
+
+// validOruMessage - an ORU^R01 with every required segment and field, to break one piece at a time
+const validOruMessage = "MSH|^~\\&|LAB|FAC|EHR|FAC|20220802003337-0500||ORU^R01^ORU_R01|CTRL1|P|2.5.1\r" +
+	"PID|1||M1^^^LAB^MR||DOE^JANE||19800101|F\r" +
+	"ORC|RE|P1|F1\r" +
+	"OBR|1|P1|F1|TEST^Test^L\r" +
+	"OBX|1|NM|GLU^Glucose^LN||98|mg/dL|70-99||||F|||20220801120000\r" +
+	"OBX|2|DT|COLL^Collected^L||20220801||||||F"
+
+// issueStrings - the issues as strings, to compare with what we expect
+func issueStrings(issues []ValidationIssue) []string {
+	var found []string
+	for _, i := range issues {
+		found = append(found, i.Severity+" "+i.Code+" "+i.String())
+	}
+	return found
+}
+
+func TestParsedMessage_Validate(t *testing.T) {
+	cases := []struct {
+		name     string
+		message  string
+		expected []string
+	}{
+		{"valid", validOruMessage, nil},
+		{
+			"missing required field",
+			strings.Replace(validOruMessage, "|F|||20220801120000", "||||20220801120000", 1),
+			[]string{"E 101 OBX-11: required field Observation Result Status is missing"},
+		},
+		{
+			"invalid DTM",
+			strings.Replace(validOruMessage, "19800101", "19801301", 1),
+			[]string{"E 102 PID-7: invalid DTM '19801301'"},
+		},
+		{
+			"invalid NM in OBX-5",
+			strings.Replace(validOruMessage, "||98|", "||ninety eight|", 1),
+			[]string{"E 102 OBX-5: invalid NM 'ninety eight'"},
+		},
+		{
+			"invalid DT in the second OBX",
+			strings.Replace(validOruMessage, "||20220801||", "||202208011200||", 1),
+			[]string{"E 102 OBX[2]-5: invalid DT '202208011200'"},
+		},
+		{
+			"invalid ID",
+			strings.Replace(validOruMessage, "|P|2.5.1", "|P|2.5.1||||||UNICODE UTF-8", 1),
+			[]string{"E 102 MSH-18: invalid ID 'UNICODE UTF-8'"},
+		},
+		{
+			"ST with components",
+			strings.Replace(validOruMessage, "|CTRL1|", "|CTRL^1|", 1),
+			[]string{"E 102 MSH-10: invalid ST: ST values can't have components"},
+		},
+		{
+			"too many repetitions",
+			strings.Replace(validOruMessage, "|19800101|F", "|19800101~19800102|F", 1),
+			[]string{"E 102 PID-7: Date/Time of Birth repeats 2 times but can only repeat 1"},
+		},
+		{
+			"too long",
+			strings.Replace(validOruMessage, "|CTRL1|", "|"+strings.Repeat("C", 21)+"|", 1),
+			[]string{"W 104 MSH-10: Message Control ID is 21 characters long but can only be 20"},
+		},
+		{
+			"repetition location",
+			strings.Replace(validOruMessage, "M1^^^LAB^MR|", "M1^^^LAB^MR~"+strings.Repeat("X", 251)+"|", 1),
+			[]string{"W 104 PID-3(1): Patient Identifier List is 251 characters long but can only be 250"},
+		},
+		{
+			"missing required segment",
+			strings.Replace(validOruMessage, "OBR|1|P1|F1|TEST^Test^L\r", "", 1),
+			[]string{"E 100 OBR: required segment OBR is missing from ORDER_OBSERVATION"},
+		},
+		{
+			"missing required group",
+			"MSH|^~\\&|LAB|FAC|EHR|FAC|20220802003337-0500||ORU^R01^ORU_R01|CTRL1|P|2.5.1\rPID|1||M1||DOE^JANE",
+			[]string{"E 100 ORDER_OBSERVATION: required group ORDER_OBSERVATION is missing from PATIENT_RESULT"},
+		},
+		{
+			"segment that doesn't belong",
+			validOruMessage + "\rEVN||20220802",
+			[]string{"E 100 EVN: EVN is not part of the ORU_R01 2.5.1 structure"},
+		},
+		{
+			"unknown structure",
+			strings.Replace(validOruMessage, "ORU^R01^ORU_R01", "ZZZ^Z01", 1),
+			[]string{"W 200 MSH-9: unable to check the structure: no structure definition for ZZZ_Z01"},
+		},
+		{
+			"v2.3.1 definitions",
+			strings.Replace(validOruMessage, "|P|2.5.1", "|P|2.3.1", 1) + "\rNTE|1||note|RE",
+			// NTE-4 wasn't added until v2.4, so it isn't checked
+			nil,
+		},
+		{
+			"unknown code in an HL7 table",
+			strings.Replace(validOruMessage, "||||F|||20220801120000", "||||Z|||20220801120000", 1),
+			[]string{"E 103 OBX-11: 'Z' is not in HL70085 Observation Result Status Codes Interpretation"},
+		},
+		{
+			"unknown code in a user defined table",
+			strings.Replace(validOruMessage, "|19800101|F", "|19800101|Q", 1),
+			[]string{"W 103 PID-8: 'Q' is not in HL70001 Administrative Sex"},
+		},
+		{
+			"coded values",
+			strings.Replace(validOruMessage, "|19800101|F", "|19800101|F||2106-3^White^HL70005~X^Other^L~9^Nine^HL70005", 1),
+			// the second race is from a local code system, so it's left alone
+			[]string{"W 103 PID-10(2): '9' is not in HL70005 Race"},
+		},
+		{
+			"explicit null",
+			strings.Replace(validOruMessage, "|19800101|", "|\"\"|", 1),
+			nil,
+		},
+	}
+	for _, c := range cases {
+		issues, err := Hl7Message{RawMessage: c.message}.Validate()
+		if err != nil {
+			t.Fatalf("%s: error should be nil: %v", c.name, err)
+		}
+		found := issueStrings(issues)
+		if strings.Join(found, "\n") != strings.Join(c.expected, "\n") {
+			t.Logf("%s: expected\n%s\nbut got\n%s", c.name, strings.Join(c.expected, "\n"), strings.Join(found, "\n"))
+			t.Fail()
+		}
+	}
+}
+
+func TestValidationIssue_AckError(t *testing.T) {
+	issues := Hl7Message{RawMessage: strings.Replace(validOruMessage, "19800101", "19801301", 1)}
+	found, err := issues.Validate()
+	if err != nil || len(found) != 1 {
+		t.Fatalf("expected a single issue but got %v, %v", found, err)
+	}
+	ack := GenerateAck(Hl7Message{RawMessage: validOruMessage}, AckApplicationError, AckErrors(found))
+	segments := ack.MessageSegments()
+	expected := "ERR||PID^1^7^1|102^Data type error^HL70357|E||||PID-7: invalid DTM '19801301'"
+	if segments[len(segments)-1] != expected {
+		t.Logf("expected %s but got %s", expected, segments[len(segments)-1])
+		t.Fail()
+	}
+}
+
+func TestLookupSegmentDefinition(t *testing.T) {
+	cases := []struct {
+		segment, version, expectedVersion string
+		fields                            int
+	}{
+		{"PID", "2.5.1", "2.5.1", 39},
+		{"PID", "2.4", "2.3.1", 30},
+		{"PID", "2.7", "2.5.1", 39},
+		{"PID", "", "2.5.1", 39},
+		{"SPM", "2.3.1", "2.5.1", 29},
+	}
+	for _, c := range cases {
+		definition, err := LookupSegmentDefinition(c.segment, c.version)
+		if err != nil {
+			t.Fatalf("%s %s: error should be nil: %v", c.segment, c.version, err)
+		}
+		if definition.Version != c.expectedVersion || len(definition.Fields) != c.fields {
+			t.Logf("%s %s: expected %d fields from %s but got %d from %s",
+				c.segment, c.version, c.fields, c.expectedVersion, len(definition.Fields), definition.Version)
+			t.Fail()
+		}
+	}
+	pid, _ := LookupSegmentDefinition("PID", "2.5.1")
+	if f := pid.Field(3); f == nil || !f.Required() || f.MaxRepetitions != 0 || f.MaxLength != 250 || f.DataType != "CX" {
+		t.Logf("unexpected PID-3 definition %+v", f)
+		t.Fail()
+	}
+	if f := pid.Field(8); f == nil || f.Table != "0001" || f.MaxRepetitions != 1 {
+		t.Logf("unexpected PID-8 definition %+v", f)
+		t.Fail()
+	}
+	if _, err := LookupSegmentDefinition("ZZZ", "2.5.1"); err == nil {
+		t.Log("a segment we don't have should be an error")
+		t.Fail()
+	}
+}
+
+func TestParseSegmentDefinition_Errors(t *testing.T) {
+	for _, definition := range []string{
+		"1\tST\tR\t1\t4",
+		"x\tST\tR\t1\t4\t-\tName",
+		"1\tST\tQ\t1\t4\t-\tName",
+		"1\tST\tR\t0\t4\t-\tName",
+		"1\tST\tR\t1\tlong\t-\tName",
+		"2\tST\tR\t1\t4\t-\tName\n1\tST\tR\t1\t4\t-\tName",
+	} {
+		if _, err := ParseSegmentDefinition("TST", "2.5.1", definition); err == nil {
+			t.Logf("%q should be an error", definition)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package hl7Utilities
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNamespace - the namespace of the HL7 v2 XML schemas
+const xmlNamespace = "urn:hl7-org:v2xml"
+
+// XMLOptions - controls how a message is written out in the HL7 v2 XML encoding
+type XMLOptions struct {
+	// Indent - written once per level of nesting, with each element on its own line. empty writes the
+	// whole message on one line
+	Indent string
+}
+
+// compositeComponents - the data types of the components of the composite data types, as of v2.5.1,
+// which name the elements inside a field, like <XPN.1> inside <PID.5> and <FN.1> inside that. types
+// that aren't here, like the CM types of older versions, have their components named after the
+// element they're in, so a component of ZPI-1 is <ZPI.1.1>
+var compositeComponents = map[string][]string{
+	"CE":  {"ST", "ST", "ID", "ST", "ST", "ID"},
+	"CNE": {"ST", "ST", "ID", "ST", "ST", "ID", "ST", "ST", "ST"},
+	"CNN": {"ST", "ST", "ST", "ST", "ST", "ST", "IS", "IS", "IS", "ST", "ID"},
+	"CQ":  {"NM", "CE"},
+	"CWE": {"ST", "ST", "ID", "ST", "ST", "ID", "ST", "ST", "ST"},
+	"CX":  {"ST", "ST", "ID", "HD", "ID", "HD", "DT", "DT", "CWE", "CWE"},
+	"DLD": {"IS", "TS"},
+	"DLN": {"ST", "IS", "DT"},
+	"DR":  {"TS", "TS"},
+	"ED":  {"HD", "ID", "ID", "ID", "TX"},
+	"EI":  {"ST", "IS", "ST", "ID"},
+	"EIP": {"EI", "EI"},
+	"ELD": {"ST", "NM", "NM", "CE"},
+	"ERL": {"ST", "NM", "NM", "NM", "NM", "NM"},
+	"FC":  {"IS", "TS"},
+	"FN":  {"ST", "ID", "ST", "ID", "ST"},
+	"HD":  {"IS", "ST", "ID"},
+	"JCC": {"IS", "IS", "TX"},
+	"MO":  {"NM", "ID"},
+	"MOC": {"MO", "CE"},
+	"MSG": {"ID", "ID", "ID"},
+	"NDL": {"CNN", "TS", "TS", "IS", "IS", "IS", "IS", "IS", "HD", "IS", "IS"},
+	"OSD": {"ID", "ST", "IS", "ST", "IS", "ST", "NM", "ST", "ST", "ID"},
+	"PL":  {"IS", "IS", "IS", "HD", "IS", "IS", "IS", "IS", "ST", "EI", "HD"},
+	"PRL": {"CE", "ST", "TX"},
+	"PT":  {"ID", "ID"},
+	"RI":  {"IS", "ST"},
+	"RP":  {"ST", "HD", "ID", "ID"},
+	"SAD": {"ST", "ST", "ST"},
+	"SN":  {"ST", "NM", "ST", "NM"},
+	"SPS": {"CE", "TX", "TX", "CE", "CE", "CE", "CE"},
+	"TQ":  {"CQ", "RI", "ST", "TS", "TS", "ST", "ST", "TX", "ID", "OSD", "CE", "NM"},
+	"TS":  {"DTM", "ID"},
+	"VID": {"ID", "CE", "CE"},
+	"XAD": {"SAD", "ST", "ST", "ST", "ST", "ID", "ID", "ST", "IS", "IS", "ID", "DR", "TS", "TS"},
+	"XCN": {"ST", "FN", "ST", "ST", "ST", "ST", "IS", "IS", "HD", "ID", "ST", "ID", "ID", "HD", "ID", "CE", "DR", "ID", "TS", "TS", "ST", "CWE", "CWE"},
+	"XON": {"ST", "IS", "NM", "NM", "ST", "HD", "ID", "HD", "ID", "ST"},
+	"XPN": {"FN", "ST", "ST", "ST", "ST", "IS", "ID", "ID", "CE", "DR", "ID", "TS", "TS", "ST"},
+	"XTN": {"ST", "ID", "ID", "ST", "NM", "NM", "NM", "ST", "ST", "ST", "ST", "ST"},
+}
+
+// EncodeXML - writes the message out in the HL7 v2 XML encoding. segments are nested in the groups
+// of the message's structure, like <ORU_R01.PATIENT_RESULT>, and fields and components are named for
+// their position and data type, like <PID.5><XPN.1><FN.1>. empty fields and components are left
+// out. delimiters in values are written as themselves, and any other escape sequences, like \.br\,
+// as <escape V=".br"/> elements, so the message comes back from [ParseXML] the same as it went in,
+// give or take trailing delimiters.
+//
+// messages we don't have the structure for are written with their segments directly inside the
+// root element
+func (m *ParsedMessage) EncodeXML(options XMLOptions) string {
+	w := &xmlWriter{delimiters: m.Delimiters, indent: options.Indent}
+	w.version, _ = m.GetRaw("MSH-12")
+	var root *MessageGroup
+	if structure, err := m.Structure(); err == nil {
+		root = m.Groups(structure)
+	} else {
+		root = &MessageGroup{Name: xmlRootName(m)}
+		for _, s := range m.Segments {
+			root.Children = append(root.Children, &GroupChild{Segment: s})
+		}
+	}
+	w.raw(`<?xml version="1.0" encoding="UTF-8"?>`)
+	w.newline()
+	w.open(root.Name, ` xmlns="`+xmlNamespace+`"`)
+	w.children(root.Name, root)
+	w.close(root.Name)
+	return w.String()
+}
+
+// EncodeXML - parses the message and writes it out in the HL7 v2 XML encoding with the options
+func (message Hl7Message) EncodeXML(options XMLOptions) (string, error) {
+	parsed, err := message.Parse()
+	if err != nil {
+		return "", err
+	}
+	return parsed.EncodeXML(options), nil
+}
+
+// xmlRootName - the name of the root element when we don't know the structure, which is the one
+// MSH-9 gives, or the message type and trigger event joined the way structure names are
+func xmlRootName(m *ParsedMessage) string {
+	if name, err := m.Get("MSH-9-3"); err == nil && *name != "" {
+		return *name
+	}
+	messageType, _ := m.Get("MSH-9-1")
+	event, _ := m.Get("MSH-9-2")
+	if messageType == nil || *messageType == "" {
+		return "Message"
+	}
+	if event == nil || *event == "" {
+		return *messageType
+	}
+	return *messageType + "_" + *event
+}
+
+// xmlWriter - builds the XML for a message
+type xmlWriter struct {
+	strings.Builder
+	delimiters Delimiters
+	version    *string
+	indent     string
+	depth      int
+}
+
+// raw - writes the text as it is
+func (w *xmlWriter) raw(text string) {
+	w.WriteString(text)
+}
+
+// newline - starts a new line when we're indenting
+func (w *xmlWriter) newline() {
+	if w.indent != "" {
+		w.WriteString("\n")
+	}
+}
+
+// open - starts an element on a line of its own, with the attributes already formatted
+func (w *xmlWriter) open(name, attributes string) {
+	w.WriteString(strings.Repeat(w.indent, w.depth))
+	w.WriteString("<" + name + attributes + ">")
+	w.newline()
+	w.depth++
+}
+
+// close - ends an element opened by open
+func (w *xmlWriter) close(name string) {
+	w.depth--
+	w.WriteString(strings.Repeat(w.indent, w.depth))
+	w.WriteString("</" + name + ">")
+	w.newline()
+}
+
+// leaf - writes an element holding a single value on one line
+func (w *xmlWriter) leaf(name, value string) {
+	w.WriteString(strings.Repeat(w.indent, w.depth))
+	if value == "" {
+		w.WriteString("<" + name + "/>")
+	} else {
+		w.WriteString("<" + name + ">" + value + "</" + name + ">")
+	}
+	w.newline()
+}
+
+// children - writes the segments and groups in a group, naming the groups after the structure
+func (w *xmlWriter) children(structureName string, group *MessageGroup) {
+	for _, c := range group.Children {
+		if c.Segment != nil {
+			w.segment(c.Segment)
+			continue
+		}
+		name := structureName + "." + c.Group.Name
+		w.open(name, "")
+		w.children(structureName, c.Group)
+		w.close(name)
+	}
+}
+
+// segment - writes a segment and its fields
+func (w *xmlWriter) segment(s *ParsedSegment) {
+	var definition *SegmentDefinition
+	if w.version != nil {
+		definition, _ = LookupSegmentDefinition(s.Name, *w.version)
+	}
+	w.open(s.Name, "")
+	for i, f := range s.Fields {
+		position := i + 1
+		name := s.Name + "." + strconv.Itoa(position)
+		if isHeaderSegment(s.Name) && position <= 2 {
+			// the separator and encoding characters are written as they are, since they aren't
+			// escaped in ER7 either
+			w.leaf(name, xmlEscape(f.Repetitions[0].Value()))
+			continue
+		}
+		dataType := ""
+		if definition != nil {
+			if d := definition.Field(position); d != nil {
+				dataType = d.DataType
+			}
+		}
+		if dataType == "varies" && s.Name == "OBX" && len(s.Fields) > 1 {
+			// OBX-2 says what type OBX-5 is
+			dataType = s.Fields[1].Repetitions[0].Value()
+		}
+		repetitions := f.Repetitions
+		for len(repetitions) > 0 && repetitionEmpty(repetitions[len(repetitions)-1]) {
+			repetitions = repetitions[:len(repetitions)-1]
+		}
+		for _, r := range repetitions {
+			w.repetition(name, dataType, r)
+		}
+	}
+	w.close(s.Name)
+}
+
+// repetition - writes one repetition of a field, with its components named for the data type
+func (w *xmlWriter) repetition(name, dataType string, r *Repetition) {
+	if repetitionEmpty(r) {
+		// an empty repetition between valued ones still has to hold its place
+		w.leaf(name, "")
+		return
+	}
+	types, composite := compositeComponents[dataType]
+	if !composite && len(r.Components) == 1 && len(r.Components[0].Subcomponents) == 1 {
+		w.leaf(name, w.text(r.Components[0].Subcomponents[0]))
+		return
+	}
+	w.open(name, "")
+	for i, c := range r.Components {
+		componentName, componentType := name+"."+strconv.Itoa(i+1), ""
+		if composite {
+			componentName = dataType + "." + strconv.Itoa(i+1)
+			if i < len(types) {
+				componentType = types[i]
+			}
+		}
+		w.component(componentName, componentType, c)
+	}
+	w.close(name)
+}
+
+// component - writes a component, and its subcomponents when it has any, unless it's empty
+func (w *xmlWriter) component(name, dataType string, c *Component) {
+	if strings.Join(c.Subcomponents, "") == "" {
+		return
+	}
+	types, composite := compositeComponents[dataType]
+	if !composite && len(c.Subcomponents) == 1 {
+		w.leaf(name, w.text(c.Subcomponents[0]))
+		return
+	}
+	w.open(name, "")
+	for i, s := range c.Subcomponents {
+		if s == "" {
+			continue
+		}
+		subcomponentName := name + "." + strconv.Itoa(i+1)
+		if composite && i < len(types) {
+			subcomponentName = dataType + "." + strconv.Itoa(i+1)
+		}
+		w.leaf(subcomponentName, w.text(s))
+	}
+	w.close(name)
+}
+
+// text - turns a raw value into XML content. escaped delimiters become the characters themselves,
+// and every other escape sequence an <escape> element, so it can be put back the way it was
+func (w *xmlWriter) text(raw string) string {
+	escape := w.delimiters.Escape
+	if escape == "" || !strings.Contains(raw, escape) {
+		return xmlEscape(raw)
+	}
+	var text strings.Builder
+	for {
+		start := strings.Index(raw, escape)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(raw[start+1:], escape)
+		if end < 0 {
+			break
+		}
+		text.WriteString(xmlEscape(raw[:start]))
+		sequence := raw[start+1 : start+1+end]
+		if character := w.delimiters.escapedDelimiter(sequence); character != "" {
+			text.WriteString(xmlEscape(character))
+		} else {
+			text.WriteString(`<escape V="` + xmlEscape(sequence) + `"/>`)
+		}
+		raw = raw[start+end+2:]
+	}
+	text.WriteString(xmlEscape(raw))
+	return text.String()
+}
+
+// escapedDelimiter - the delimiter an escape sequence like F stands for, or empty for the sequences
+// that aren't delimiters
+func (d Delimiters) escapedDelimiter(sequence string) string {
+	switch sequence {
+	case "F":
+		return d.Field
+	case "S":
+		return d.Component
+	case "T":
+		return d.Subcomponent
+	case "R":
+		return d.Repetition
+	case "E":
+		return d.Escape
+	case "P":
+		return d.Truncation
+	}
+	return ""
+}
+
+// xmlEscape - escapes the characters that can't appear as themselves in XML content
+func xmlEscape(value string) string {
+	var escaped strings.Builder
+	// EscapeText only fails when the writer does, which a strings.Builder never does
+	_ = xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
+
+// xmlNode - an element read from an XML message, or a run of text inside one when the name is empty
+type xmlNode struct {
+	name     string
+	text     string
+	escape   string
+	children []*xmlNode
+}
+
+// isText - true for the text between elements
+func (n *xmlNode) isText() bool {
+	return n.name == ""
+}
+
+// hasElements - true when the element holds other elements, rather than a value. escape elements are
+// part of a value
+func (n *xmlNode) hasElements() bool {
+	for _, c := range n.children {
+		if !c.isText() && c.name != "escape" {
+			return true
+		}
+	}
+	return false
+}
+
+// elements - the elements in the node, skipping the whitespace between them
+func (n *xmlNode) elements() []*xmlNode {
+	var elements []*xmlNode
+	for _, c := range n.children {
+		if !c.isText() {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// ParseXML - reads a message in the HL7 v2 XML encoding into a [ParsedMessage], which can then be
+// queried with terser specifications or written out as ER7. the groups are only there to be read
+// past, and fields, components and subcomponents are placed by the number at the end of their
+// element names, so the data type names don't matter. values are escaped for the delimiters in
+// MSH-1 and MSH-2, or the default ones when the message doesn't have them
+func ParseXML(data string) (*ParsedMessage, error) {
+	root, err := readXMLNodes(data)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*xmlNode
+	collectXMLSegments(root, &segments)
+	if len(segments) == 0 || !isHeaderSegment(segments[0].name) {
+		return nil, fmt.Errorf("%w: the XML doesn't start with an MSH segment", ErrInvalidMessage)
+	}
+	delimiters := DefaultDelimiters
+	header := segments[0]
+	fieldSeparator, encodingCharacters := "", ""
+	for _, e := range header.elements() {
+		switch e.name {
+		case header.name + ".1":
+			fieldSeparator = e.textContent()
+		case header.name + ".2":
+			encodingCharacters = e.textContent()
+		}
+	}
+	if fieldSeparator != "" || encodingCharacters != "" {
+		if delimiters, err = NewDelimiters(fieldSeparator, encodingCharacters); err != nil {
+			return nil, err
+		}
+	}
+	parsed := &ParsedMessage{Delimiters: delimiters}
+	for _, s := range segments {
+		segment, err := s.segment(delimiters)
+		if err != nil {
+			return nil, err
+		}
+		parsed.Segments = append(parsed.Segments, segment)
+	}
+	return parsed, nil
+}
+
+// readXMLNodes - reads the XML into a tree of nodes, returning the root element
+func readXMLNodes(data string) (*xmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local}
+			for _, a := range t.Attr {
+				if a.Name.Local == "V" {
+					node.escape = a.Value
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, &xmlNode{text: string(t)})
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: there's no XML in the message", ErrInvalidMessage)
+	}
+	return root, nil
+}
+
+// collectXMLSegments - finds the segments in a group, and the groups nested in it, in message order.
+// group names always have a dot in them, like ORU_R01.PATIENT_RESULT, and segment names never do
+func collectXMLSegments(group *xmlNode, segments *[]*xmlNode) {
+	for _, e := range group.elements() {
+		if strings.Contains(e.name, ".") {
+			collectXMLSegments(e, segments)
+		} else {
+			*segments = append(*segments, e)
+		}
+	}
+}
+
+// segment - turns a segment element into a ParsedSegment
+func (n *xmlNode) segment(delimiters Delimiters) (*ParsedSegment, error) {
+	if !segmentNamePattern.MatchString(n.name) {
+		return nil, fmt.Errorf("%w: '%s' isn't a segment name", ErrInvalidMessage, n.name)
+	}
+	segment := &ParsedSegment{Name: n.name}
+	if isHeaderSegment(n.name) {
+		segment.Fields = []*Field{newPrimitiveField(delimiters.Field), newPrimitiveField(delimiters.EncodingCharacters())}
+	}
+	for _, e := range n.elements() {
+		position, err := xmlPosition(e.name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s in %s: %v", ErrInvalidMessage, e.name, n.name, err)
+		}
+		if isHeaderSegment(n.name) && position <= 2 {
+			continue
+		}
+		for len(segment.Fields) < position {
+			segment.Fields = append(segment.Fields, &Field{})
+		}
+		field := segment.Fields[position-1]
+		repetition, err := e.repetition(delimiters)
+		if err != nil {
+			return nil, err
+		}
+		field.Repetitions = append(field.Repetitions, repetition)
+	}
+	for _, f := range segment.Fields {
+		if len(f.Repetitions) == 0 {
+			f.Repetitions = newPrimitiveField("").Repetitions
+		}
+	}
+	return segment, nil
+}
+
+// repetition - turns a field element into a repetition, which is a single value unless it holds
+// component elements
+func (n *xmlNode) repetition(delimiters Delimiters) (*Repetition, error) {
+	if !n.hasElements() {
+		return &Repetition{Components: []*Component{{Subcomponents: []string{n.value(delimiters)}}}}, nil
+	}
+	repetition := &Repetition{}
+	for _, e := range n.elements() {
+		position, err := xmlPosition(e.name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s in %s: %v", ErrInvalidMessage, e.name, n.name, err)
+		}
+		for len(repetition.Components) < position {
+			repetition.Components = append(repetition.Components, &Component{Subcomponents: []string{""}})
+		}
+		component := &Component{Subcomponents: []string{e.value(delimiters)}}
+		if e.hasElements() {
+			component.Subcomponents = nil
+			for _, s := range e.elements() {
+				subposition, err := xmlPosition(s.name)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s in %s: %v", ErrInvalidMessage, s.name, e.name, err)
+				}
+				for len(component.Subcomponents) < subposition {
+					component.Subcomponents = append(component.Subcomponents, "")
+				}
+				component.Subcomponents[subposition-1] = s.value(delimiters)
+			}
+		}
+		repetition.Components[position-1] = component
+	}
+	return repetition, nil
+}
+
+// textContent - the text in the element, as it is
+func (n *xmlNode) textContent() string {
+	var text strings.Builder
+	for _, c := range n.children {
+		text.WriteString(c.text)
+	}
+	return text.String()
+}
+
+// value - the raw value of an element holding text and escapes, escaped for the delimiters
+func (n *xmlNode) value(delimiters Delimiters) string {
+	var value strings.Builder
+	for _, c := range n.children {
+		switch {
+		case c.isText():
+			value.WriteString(delimiters.Encode(c.text))
+		case c.name == "escape":
+			value.WriteString(delimiters.escapeSequence(c.escape))
+		}
+	}
+	return value.String()
+}
+
+// xmlPosition - the position at the end of an element name, like 5 in PID.5 or XPN.1
+func xmlPosition(name string) (int, error) {
+	dot := strings.LastIndex(name, ".")
+	position, err := strconv.Atoi(name[dot+1:])
+	if dot < 0 || err != nil || position < 1 {
+		return 0, fmt.Errorf("the name doesn't end in a position")
+	}
+	if position > maxPosition {
+		return 0, fmt.Errorf("%d is past the last position we accept, %d", position, maxPosition)
+	}
+	return position, nil
+}
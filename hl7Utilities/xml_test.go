@@ -0,0 +1,189 @@
+package hl7Utilities
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsedMessage_EncodeXML_roundTrip(t *testing.T) {
+	// the XML has the escapes as elements, OBX-5 typed by OBX-2 and the segments nested in their groups,
+	// and all of it has to read back as the message we started with
+	tests := []struct {
+		name    string
+		message string
+		xml     []string
+	}{
+		{
+			"formatting escapes",
+			"MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rNTE|1||a\\F\\b\\.br\\c \\H\\bold\\N\\ \\X0D\\ < >\r",
+			[]string{`<NTE.3>a|b<escape V=".br"/>c <escape V="H"/>bold<escape V="N"/> <escape V="X0D"/> &lt; &gt;</NTE.3>`},
+		},
+		{
+			"OBX-5 typed by OBX-2",
+			"MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rPID|1||M1\rOBR|1||acc1|TEST\r" +
+				"OBX|1|CWE|94500-6^COVID^LN||260415000^Not detected^SCT||||||F\rOBX|2|SN|2160-0^Creatinine^LN||<^0.5|mg/dL\r" +
+				"OBX|3|NM|2345-7^Glucose^LN||95\r",
+			[]string{
+				`<OBX.5><CWE.1>260415000</CWE.1><CWE.2>Not detected</CWE.2><CWE.3>SCT</CWE.3></OBX.5>`,
+				`<OBX.5><SN.1>&lt;</SN.1><SN.2>0.5</SN.2></OBX.5>`,
+				`<OBX.5>95</OBX.5>`,
+			},
+		},
+		{
+			"groups",
+			"MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rPID|1||M1\rOBR|1||acc1|TEST\r" +
+				"OBX|1|ST|8251-1^Comment^LN||fasting\rNTE|1||hemolyzed\rSPM|1|||SWAB\rOBR|2||acc2|TEST\rOBX|1|NM|2345-7||95\r",
+			[]string{
+				`<ORU_R01.PATIENT_RESULT><ORU_R01.PATIENT><PID>`,
+				`<NTE.3>hemolyzed</NTE.3></NTE></ORU_R01.OBSERVATION><ORU_R01.SPECIMEN><SPM>`,
+				`</ORU_R01.SPECIMEN></ORU_R01.ORDER_OBSERVATION><ORU_R01.ORDER_OBSERVATION><OBR><OBR.1>2</OBR.1>`,
+			},
+		},
+		{
+			"unknown message and Z segment",
+			"MSH|^~\\&|LAB|FAC|||20220802||ZZZ^Z01|1|P|2.5.1\rZPI|1|a^b&c|x~y\r",
+			[]string{
+				`<ZZZ_Z01 xmlns="urn:hl7-org:v2xml"><MSH>`,
+				`<ZPI.2><ZPI.2.1>a</ZPI.2.1><ZPI.2.2><ZPI.2.2.1>b</ZPI.2.2.1><ZPI.2.2.2>c</ZPI.2.2.2></ZPI.2.2></ZPI.2><ZPI.3>x</ZPI.3><ZPI.3>y</ZPI.3>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		parsed, err := ParseMessage(tt.message)
+		if err != nil {
+			t.Fatalf("%s: ParseMessage() error = %v", tt.name, err)
+		}
+		for _, e := range tt.xml {
+			if encoded := parsed.EncodeXML(XMLOptions{}); !strings.Contains(encoded, e) {
+				t.Errorf("%s: expected %s in %s", tt.name, e, encoded)
+			}
+		}
+		// indenting adds whitespace between the elements, which mustn't end up in the values
+		for _, indent := range []string{"", "  "} {
+			encoded := parsed.EncodeXML(XMLOptions{Indent: indent})
+			decoded, err := ParseXML(encoded)
+			if err != nil {
+				t.Errorf("%s: ParseXML() error = %v\n%s", tt.name, err, encoded)
+				continue
+			}
+			if got, want := decoded.String(), parsed.String(); got != want {
+				t.Errorf("%s: round trip = %q, want %q\n%s", tt.name, got, want, encoded)
+			}
+		}
+	}
+}
+
+func TestParsedMessage_EncodeXML(t *testing.T) {
+	parsed, err := ParseMessage(simpleHl7Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := parsed.EncodeXML(XMLOptions{})
+	expected := []string{
+		`<?xml version="1.0" encoding="UTF-8"?><ORU_R01 xmlns="urn:hl7-org:v2xml"><MSH><MSH.1>|</MSH.1><MSH.2>^~\&amp;</MSH.2>`,
+		`<ORU_R01.PATIENT_RESULT><ORU_R01.PATIENT><PID><PID.1>1</PID.1>`,
+		`<PID.5><XPN.1><FN.1>LASTNAME</FN.1></XPN.1><XPN.2>FIRSTNAME</XPN.2><XPN.3>MIDDLE</XPN.3></PID.5>`,
+		`<ORU_R01.ORDER_OBSERVATION><ORC><ORC.1>RE</ORC.1>`,
+		// OBX-5 is a CE, because OBX-2 says so
+		`<OBX.5><CE.1>260415000</CE.1><CE.2>Undetected</CE.2><CE.3>SCT</CE.3></OBX.5>`,
+		`<ORU_R01.OBSERVATION><OBX>`,
+		`<ORU_R01.SPECIMEN><SPM>`,
+		`</ORU_R01.PATIENT_RESULT></ORU_R01>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(encoded, e) {
+			t.Logf("expected %s in %s", e, encoded)
+			t.Fail()
+		}
+	}
+	escapes, _ := ParseMessage("MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rNTE|1||a\\F\\b\\.br\\c < d")
+	if e := `<NTE.3>a|b<escape V=".br"/>c &lt; d</NTE.3>`; !strings.Contains(escapes.EncodeXML(XMLOptions{}), e) {
+		t.Logf("expected %s in %s", e, escapes.EncodeXML(XMLOptions{}))
+		t.Fail()
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	// the way a partner might send it, with some type names that aren't ours and comments
+	message := `<?xml version="1.0" encoding="UTF-8"?>
+<ORU_R01 xmlns="urn:hl7-org:v2xml">
+	<MSH>
+		<MSH.1>|</MSH.1>
+		<MSH.2>^~\&amp;</MSH.2>
+		<MSH.4><HD.1>LAB</HD.1></MSH.4>
+		<MSH.9><MSG.1>ORU</MSG.1><MSG.2>R01</MSG.2><MSG.3>ORU_R01</MSG.3></MSH.9>
+		<MSH.10>CTRL1</MSH.10>
+		<MSH.12><VID.1>2.5.1</VID.1></MSH.12>
+	</MSH>
+	<ORU_R01.PATIENT_RESULT>
+		<ORU_R01.PATIENT>
+			<!-- the patient -->
+			<PID>
+				<PID.3><CX.1>M1</CX.1><CX.4><HD.1>LAB</HD.1><HD.2>1.2.3</HD.2></CX.4></PID.3>
+				<PID.3><CX.1>M2</CX.1></PID.3>
+				<PID.5><XPN.1><FN.1>DOE</FN.1></XPN.1><XPN.2>JANE</XPN.2></PID.5>
+			</PID>
+		</ORU_R01.PATIENT>
+		<ORU_R01.ORDER_OBSERVATION>
+			<OBR><OBR.4><CWE.1>TEST</CWE.1></OBR.4></OBR>
+			<ORU_R01.OBSERVATION>
+				<OBX>
+					<OBX.2>ST</OBX.2>
+					<OBX.5>high^low <escape V=".br"/>next line</OBX.5>
+				</OBX>
+			</ORU_R01.OBSERVATION>
+		</ORU_R01.ORDER_OBSERVATION>
+	</ORU_R01.PATIENT_RESULT>
+</ORU_R01>`
+	parsed, err := ParseXML(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ spec, expectedValue string }{
+		{"MSH-4", "LAB"},
+		{"MSH-9-3", "ORU_R01"},
+		{"MSH-10", "CTRL1"},
+		{"PID-3-1", "M1"},
+		{"PID-3-4-2", "1.2.3"},
+		{"PID-3(1)-1", "M2"},
+		{"PID-5-1", "DOE"},
+		{"PID-5-2", "JANE"},
+		{"OBR-4-1", "TEST"},
+		{"OBX-5", "high^low \nnext line"},
+	}
+	for _, c := range cases {
+		value, err := parsed.Get(c.spec)
+		if err != nil || *value != c.expectedValue {
+			t.Logf("%s: expected '%s' but got %v, %v", c.spec, c.expectedValue, value, err)
+			t.Fail()
+		}
+	}
+	expected := "PID|||M1^^^LAB&1.2.3~M2||DOE^JANE"
+	if er7 := parsed.EncodeER7(ER7Options{TrimTrailingDelimiters: true}); !strings.Contains(er7, expected) {
+		t.Logf("expected %s in %s", expected, er7)
+		t.Fail()
+	}
+}
+
+func TestParseXML_errors(t *testing.T) {
+	cases := map[string]string{
+		"not XML":           "MSH|^~\\&|LAB",
+		"unclosed":          "<ORU_R01><MSH><MSH.1>|</MSH.1>",
+		"no MSH":            "<ORU_R01><PID><PID.1>1</PID.1></PID></ORU_R01>",
+		"bad field":         "<ORU_R01><MSH><MSH.1>|</MSH.1><MSH.2>^~\\&amp;</MSH.2><MSH.X>1</MSH.X></MSH></ORU_R01>",
+		"delimiters":        "<ORU_R01><MSH><MSH.1>|</MSH.1><MSH.2>^</MSH.2></MSH></ORU_R01>",
+		"empty input":       "",
+		"long segment name": "<ORU_R01><MSH><MSH.1>|</MSH.1><MSH.2>^~\\&amp;</MSH.2></MSH><PIDX><PIDX.1>1</PIDX.1></PIDX></ORU_R01>",
+		"lower case name":   "<ORU_R01><MSH><MSH.1>|</MSH.1><MSH.2>^~\\&amp;</MSH.2></MSH><pid><pid.1>1</pid.1></pid></ORU_R01>",
+		"huge field":        "<ORU_R01><MSH><MSH.1>|</MSH.1><MSH.2>^~\\&amp;</MSH.2></MSH><PID><PID.30000000>x</PID.30000000></PID></ORU_R01>",
+		"huge component":    "<ORU_R01><MSH><MSH.1>|</MSH.1><MSH.2>^~\\&amp;</MSH.2></MSH><PID><PID.5><XPN.30000000>x</XPN.30000000></PID.5></PID></ORU_R01>",
+		"huge subcomponent": "<ORU_R01><MSH><MSH.1>|</MSH.1><MSH.2>^~\\&amp;</MSH.2></MSH><PID><PID.3><CX.4><HD.30000000>x</HD.30000000></CX.4></PID.3></PID></ORU_R01>",
+	}
+	for name, message := range cases {
+		if _, err := ParseXML(message); !errors.Is(err, ErrInvalidMessage) {
+			t.Logf("%s: expected ErrInvalidMessage but got %v", name, err)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// defaultColumnsFile - the columns every run writes, see columns.yaml
+//
+//go:embed columns.yaml
+var defaultColumnsFile string
+
+// columnMappings, orderColumns, observationColumns - the columns read straight out of the message,
+// by name, for every row, for the rows for orders and observations, and just for the rows for
+// observations. they start out as the ones in columns.yaml, with any from the config's mapping file
+// added
+var columnMappings, orderColumns, observationColumns = mustParseColumns(defaultColumnsFile)
+
+// Column - how to read an output column out of a message. in a mapping file it's either a terser
+// path on its own, like
+//
+//	pt_state: PID-11-4
+//
+// or a mapping with the paths and transforms, like
+//
+//	ordering_provider_state:
+//	  paths: [ORC-24-4, ORC-22-4]
+//	  transforms: [trim, upper]
+type Column struct {
+	// Paths - the terser paths to read, taking the first that has a value once it's transformed
+	Paths []string
+	// Join - when it's set, the values of all the paths are joined with it instead
+	Join *string
+	// Transforms - what to do to each value, in order, like trim or date:20060102
+	Transforms []string
+}
+
+// columnFile - the JSON form of a column written as a mapping
+type columnFile struct {
+	Path       string   `json:"path"`
+	Paths      []string `json:"paths"`
+	Join       *string  `json:"join"`
+	Transforms []string `json:"transforms"`
+}
+
+// UnmarshalJSON - reads a column written as a path or as a mapping
+func (c *Column) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*c = Column{Paths: []string{path}}
+		return c.validate()
+	}
+	var file columnFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return err
+	}
+	if file.Path != "" && len(file.Paths) > 0 {
+		return fmt.Errorf("use path or paths, not both")
+	}
+	*c = Column{Paths: file.Paths, Join: file.Join, Transforms: file.Transforms}
+	if file.Path != "" {
+		c.Paths = []string{file.Path}
+	}
+	return c.validate()
+}
+
+// validate - checks the paths are terser specifications and we know the transforms
+func (c *Column) validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("no path")
+	}
+	for _, path := range c.Paths {
+		if err := hl7Utilities.ValidateSpecification(path); err != nil {
+			return err
+		}
+	}
+	for _, transform := range c.Transforms {
+		name, _, _ := strings.Cut(transform, ":")
+		switch name {
+		case "trim", "upper", "lower", "date":
+		default:
+			return fmt.Errorf("unknown transform '%s'", transform)
+		}
+	}
+	return nil
+}
+
+// mappingFile - the JSON form of a mapping file
+type mappingFile struct {
+	Columns            map[string]Column `json:"columns"`
+	OrderColumns       map[string]Column `json:"orderColumns"`
+	ObservationColumns map[string]Column `json:"observationColumns"`
+}
+
+// parseColumns - reads the columns in a mapping file, as JSON when it's JSON and as YAML otherwise
+func parseColumns(data string, isJSON bool) (*mappingFile, error) {
+	var file mappingFile
+	if err := decodeFile([]byte(data), isJSON, &file); err != nil {
+		return nil, err
+	}
+	for _, columns := range []*map[string]Column{&file.Columns, &file.OrderColumns, &file.ObservationColumns} {
+		if *columns == nil {
+			*columns = map[string]Column{}
+		}
+	}
+	return &file, nil
+}
+
+// mustParseColumns - reads the columns we ship with, which can only be broken by a bad build
+func mustParseColumns(data string) (map[string]Column, map[string]Column, map[string]Column) {
+	file, err := parseColumns(data, false)
+	check(err)
+	return file.Columns, file.OrderColumns, file.ObservationColumns
+}
+
+// loadColumns - adds the columns in the mapping file to the ones we have, replacing any with the
+// same name
+func loadColumns(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := parseColumns(string(data), strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, c := range []struct{ from, to map[string]Column }{
+		{file.Columns, columnMappings},
+		{file.OrderColumns, orderColumns},
+		{file.ObservationColumns, observationColumns},
+	} {
+		for name, column := range c.from {
+			c.to[name] = column
+		}
+	}
+	return nil
+}
+
+// rowContext - the segments a row is read from. paths read the most recent segment with their name,
+// so a message with several specimens gets the order each one came with, while paths that pick a
+// segment out by set ID, like OBX(2)-5, and group paths read the whole message
+type rowContext struct {
+	message *hl7Utilities.ParsedMessage
+	current *hl7Utilities.ParsedMessage
+	sender  string
+	// rule - the sender's rule, or nil when we don't know them
+	rule *SenderRule
+}
+
+// newRowContext - a context for reading rows out of the message
+func newRowContext(message *hl7Utilities.ParsedMessage) *rowContext {
+	return &rowContext{
+		message: message,
+		current: &hl7Utilities.ParsedMessage{Delimiters: message.Delimiters},
+	}
+}
+
+// add - makes the segment the most recent one with its name
+func (r *rowContext) add(segment *hl7Utilities.ParsedSegment) {
+	for i, s := range r.current.Segments {
+		if s.Name == segment.Name {
+			r.current.Segments[i] = segment
+			return
+		}
+	}
+	r.current.Segments = append(r.current.Segments, segment)
+}
+
+// remove - forgets the segments with the names, for when the order they belong to is over
+func (r *rowContext) remove(names ...string) {
+	segments := r.current.Segments[:0]
+	for _, s := range r.current.Segments {
+		keep := true
+		for _, name := range names {
+			keep = keep && s.Name != name
+		}
+		if keep {
+			segments = append(segments, s)
+		}
+	}
+	r.current.Segments = segments
+}
+
+// get - the value at the path, or an empty string when the message doesn't have one there
+func (r *rowContext) get(path string) string {
+	message := r.current
+	if segment, _, _ := strings.Cut(path, "-"); strings.HasPrefix(path, "/") || strings.Contains(segment, "(") {
+		message = r.message
+	}
+	value, err := message.Get(path)
+	if err != nil {
+		return ""
+	}
+	return *value
+}
+
+// value - reads the column out of the segments we've seen
+func (r *rowContext) value(column Column) string {
+	var values []string
+	for _, path := range column.Paths {
+		value := r.get(path)
+		for _, transform := range column.Transforms {
+			value = r.transform(transform, value)
+		}
+		if value == "" {
+			continue
+		}
+		if column.Join == nil {
+			return value
+		}
+		values = append(values, value)
+	}
+	if column.Join == nil {
+		return ""
+	}
+	return strings.Join(values, *column.Join)
+}
+
+// transform - applies a transform to a value. dates are read in the sender's time zone, and are
+// left as they were sent when they can't be read
+func (r *rowContext) transform(transform, value string) string {
+	name, layout, _ := strings.Cut(transform, ":")
+	switch name {
+	case "trim":
+		return strings.TrimSpace(value)
+	case "upper":
+		return strings.ToUpper(value)
+	case "lower":
+		return strings.ToLower(value)
+	case "date":
+		if value == "" {
+			return value
+		}
+		if layout == "" {
+			layout = longDateFormat
+		}
+		return formatDate(value, r.message.Delimiters.Component, r.sender, layout)
+	}
+	return value
+}
+
+// addColumns - reads every mapped column into the row, then the extra columns, like the ones for
+// orders, then the sender's overrides
+func (r *rowContext) addColumns(values map[string]string, extra ...map[string]Column) {
+	for _, columns := range append([]map[string]Column{columnMappings}, extra...) {
+		for name, column := range columns {
+			values[name] = r.value(column)
+		}
+	}
+	if r.rule != nil {
+		for name, column := range r.rule.Overrides {
+			values[name] = r.value(column)
+		}
+	}
+}
+
+// build - a row holding a copy of the values, with the columns read in and whatever the sender needs
+// fixed applied to it
+func (r *rowContext) build(values map[string]string, extra ...map[string]Column) map[string]string {
+	row := make(map[string]string, len(values))
+	for key, value := range values {
+		row[key] = value
+	}
+	r.addColumns(row, extra...)
+	r.applyQuirks(row)
+	return row
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+const mappingMessage = "MSH|^~\\&|LAB|FAC|||20220802003337-0500||ORU^R01^ORU_R01|CTRL1|P|2.5.1\r" +
+	"PID|1||M1^^^LAB||DOE^JANE||19800101|F|||1 MAIN ST^^TOWN^ ca ^90210\r" +
+	"ORC|RE||acc1|||||||||^Howser^Douglas|||||||||Eastman|^^^NY^10001\r" +
+	"OBR|1||acc1|TEST\r" +
+	"OBX|1|ST|CODE||first\r" +
+	"SPM|1|||SWAB|||||||||||||20220801120000\r" +
+	"ORC|RE||acc2|||||||||||||||||||^^^NJ^07001\r" +
+	"OBR|2||acc2|TEST\r" +
+	"OBX|1|ST|CODE||second\r" +
+	"SPM|2|||SWAB\r"
+
+func TestParseColumns(t *testing.T) {
+	file, err := parseColumns(`columns:
+  pt_id: PID-3-1
+  pt_state:
+    path: PID-11-4
+    transforms: [trim, upper]
+  provider_state:
+    paths: [ORC-24-4, ORC-22-4]
+  provider_name:
+    paths: [ORC-12-3, ORC-12-2-1]
+    join: " "
+    transforms: [upper]
+  pt_dob:
+    path: PID-7
+    transforms: ["date:2006-01-02"]
+  collected:
+    paths: [SPM-17-1, MSH-7]
+    transforms: [date]
+  result: OBX-5
+  second_order: ORC(2)-3
+`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := hl7Utilities.ParseMessage(mappingMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// read a row at each specimen, the way the decomposer does
+	var rows []map[string]string
+	row := newRowContext(parsed)
+	for _, segment := range parsed.Segments {
+		row.add(segment)
+		if segment.Name == "SPM" {
+			values := make(map[string]string)
+			for name, column := range file.Columns {
+				values[name] = row.value(column)
+			}
+			rows = append(rows, values)
+		}
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows but got %d", len(rows))
+	}
+	expected := []map[string]string{
+		{
+			"pt_id":          "M1",
+			"pt_state":       "CA",
+			"provider_state": "NY",
+			"provider_name":  "DOUGLAS HOWSER",
+			"pt_dob":         "1980-01-01",
+			"collected":      "20220801120000+0000",
+			"result":         "first",
+			"second_order":   "acc2",
+		},
+		// each specimen gets its own order, and falls back to the message date when it has no date
+		{
+			"pt_id":          "M1",
+			"pt_state":       "CA",
+			"provider_state": "NJ",
+			"provider_name":  "",
+			"pt_dob":         "1980-01-01",
+			"collected":      "20220802003337-0500",
+			"result":         "second",
+			"second_order":   "acc2",
+		},
+	}
+	for i, e := range expected {
+		for name, value := range e {
+			if rows[i][name] != value {
+				t.Logf("row %d: expected %s to be '%s' but got '%s'", i, name, value, rows[i][name])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestParseColumns_errors(t *testing.T) {
+	cases := map[string]string{
+		"bad path":          "columns:\n  pt_id: PID-X\n",
+		"bad group path":    "columns:\n  result: /PATIENT_RESULT/order_observation/OBX-5\n",
+		"unknown transform": "columns:\n  pt_id:\n    path: PID-3\n    transforms: [reverse]\n",
+		"path and paths":    "columns:\n  pt_id:\n    path: PID-3\n    paths: [PID-2]\n",
+		"no path":           "columns:\n  pt_id:\n    transforms: [trim]\n",
+		"unknown setting":   "columns:\n  pt_id:\n    paht: PID-3\n",
+		"not columns":       "pt_id: PID-3\n",
+	}
+	for name, data := range cases {
+		if _, err := parseColumns(data, false); err == nil {
+			t.Logf("%s: expected an error", name)
+			t.Fail()
+		}
+	}
+}
+
+func TestLoadColumns(t *testing.T) {
+	saved := columnMappings
+	defer func() { columnMappings = saved }()
+	columnMappings, _, _ = mustParseColumns(defaultColumnsFile)
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	err := os.WriteFile(path, []byte(`{"columns": {"pt_sex": {"path": "PID-8", "transforms": ["lower"]}, "pt_last_name": "PID-5-1"}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadColumns(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(columnMappings) != len(saved)+1 {
+		t.Logf("expected one more column than the %d we ship with but got %d", len(saved), len(columnMappings))
+		t.Fail()
+	}
+	if column := columnMappings["pt_sex"]; strings.Join(column.Transforms, ",") != "lower" {
+		t.Logf("expected pt_sex to be replaced but got %v", column)
+		t.Fail()
+	}
+}
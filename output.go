@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// columns - every key in the rows, sorted, so a value only some messages have still gets a column
+func columns(rows []map[string]string) []string {
+	all := make(map[string]string)
+	for _, row := range rows {
+		for key := range row {
+			all[key] = ""
+		}
+	}
+	return keys(all)
+}
+
+// writeResults - writes the rows out in the format, which is one of csv, tsv, json or jsonl
+func writeResults(w io.Writer, format string, rows []map[string]string) error {
+	switch format {
+	case formatCSV, formatTSV:
+		writer := csv.NewWriter(w)
+		if format == formatTSV {
+			writer.Comma = '\t'
+		}
+		headers := columns(rows)
+		// write out our headers
+		if err := writer.Write(headers); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			line := make([]string, 0, len(headers))
+			for _, key := range headers {
+				line = append(line, row[key])
+			}
+			if err := writer.Write(line); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if rows == nil {
+			rows = []map[string]string{}
+		}
+		return encoder.Encode(rows)
+	case formatJSONL:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// defaultSendersFile - the labs we know out of the box, see senders.yaml
+//
+//go:embed senders.yaml
+var defaultSendersFile string
+
+// senderRules - the senders we know, in the order they're matched. starts out as the ones in
+// senders.yaml, with any from the config's senders file ahead of them
+var senderRules = mustParseSenders(defaultSendersFile)
+
+// SenderRule - how to recognize a lab's messages and what to do differently for them
+type SenderRule struct {
+	// ID - the sender_id its messages get, like mayo
+	ID string `json:"id"`
+	// Applications - the names it sends in MSH-3-1, matched ignoring case
+	Applications []string `json:"applications"`
+	// Facilities - the names it sends in MSH-4-1, matched ignoring case
+	Facilities []string `json:"facilities"`
+	// OIDs - the universal IDs it sends in MSH-3-2 or MSH-4-2
+	OIDs []string `json:"oids"`
+	// TimeZone - the IANA time zone it means when it leaves the UTC offset off a date. a time zone
+	// for the same sender in the config wins
+	TimeZone string `json:"timeZone"`
+	// Overrides - columns read differently for this sender, replacing the ones in columns.yaml
+	Overrides map[string]Column `json:"overrides"`
+	// Quirks - the names of the fixes in quirks to apply to its rows
+	Quirks []string `json:"quirks"`
+
+	location *time.Location
+}
+
+// sendersFile - the JSON form of a senders file
+type sendersFile struct {
+	Senders []*SenderRule `json:"senders"`
+}
+
+// quirk - a fix for something a sender does that doesn't follow the standard, applied to each of its
+// rows once the columns have been read
+type quirk func(row *rowContext, values map[string]string)
+
+// quirks - the fixes a sender rule can ask for by name
+var quirks = map[string]quirk{
+	"specimen-type-alternate-identifier": specimenTypeAlternateIdentifier,
+	"age-in-dob":                         ageInDOB,
+}
+
+// parseSenders - reads the senders in a senders file, as JSON when it's JSON and as YAML otherwise
+func parseSenders(data string, isJSON bool) ([]*SenderRule, error) {
+	var file sendersFile
+	if err := decodeFile([]byte(data), isJSON, &file); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, rule := range file.Senders {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("sender %s appears more than once", rule.ID)
+		}
+		seen[rule.ID] = true
+	}
+	return file.Senders, nil
+}
+
+// mustParseSenders - reads the senders we ship with, which can only be broken by a bad build
+func mustParseSenders(data string) []*SenderRule {
+	rules, err := parseSenders(data, false)
+	check(err)
+	return rules
+}
+
+// loadSenders - puts the senders in the file ahead of the ones we have, replacing any with the same ID
+func loadSenders(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	rules, err := parseSenders(string(data), strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	replaced := make(map[string]bool)
+	for _, rule := range rules {
+		replaced[rule.ID] = true
+	}
+	for _, rule := range senderRules {
+		if !replaced[rule.ID] {
+			rules = append(rules, rule)
+		}
+	}
+	senderRules = rules
+	return nil
+}
+
+// validate - checks the rule can match something, and that we have its time zone and quirks
+func (s *SenderRule) validate() error {
+	if s.ID == "" {
+		return fmt.Errorf("a sender has no id")
+	}
+	if len(s.Applications) == 0 && len(s.Facilities) == 0 && len(s.OIDs) == 0 {
+		return fmt.Errorf("sender %s has no applications, facilities or oids to match", s.ID)
+	}
+	if s.TimeZone != "" {
+		location, err := time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return fmt.Errorf("sender %s: %w", s.ID, err)
+		}
+		s.location = location
+	}
+	for _, name := range s.Quirks {
+		if _, ok := quirks[name]; !ok {
+			return fmt.Errorf("sender %s: unknown quirk '%s'", s.ID, name)
+		}
+	}
+	return nil
+}
+
+// matches - true when the message comes from this sender
+func (s *SenderRule) matches(message *hl7Utilities.ParsedMessage) bool {
+	value := func(specification string) string {
+		v, err := message.Get(specification)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(*v)
+	}
+	contains := func(values []string, value string, ignoreCase bool) bool {
+		for _, v := range values {
+			if v == value || (ignoreCase && strings.EqualFold(v, value)) {
+				return value != ""
+			}
+		}
+		return false
+	}
+	return contains(s.Applications, value("MSH-3-1"), true) ||
+		contains(s.Facilities, value("MSH-4-1"), true) ||
+		contains(s.OIDs, value("MSH-3-2"), false) ||
+		contains(s.OIDs, value("MSH-4-2"), false)
+}
+
+// matchSender - the first rule the message matches, or nil when we don't know the sender
+func matchSender(message *hl7Utilities.ParsedMessage) *SenderRule {
+	for _, rule := range senderRules {
+		if rule.matches(message) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// applyQuirks - applies the fixes the row's sender asks for
+func (r *rowContext) applyQuirks(values map[string]string) {
+	if r.rule == nil {
+		return
+	}
+	for _, name := range r.rule.Quirks {
+		quirks[name](r, values)
+	}
+}
+
+// specimenTypeAlternateIdentifier - mayo sends the specimen description as the alternate identifier
+// in SPM-4-4, in a specimen type with all eight of its components, rather than as the text
+func specimenTypeAlternateIdentifier(row *rowContext, values map[string]string) {
+	spm, err := hl7Utilities.NewSegment[hl7Utilities.SPM](row.current.Segment("SPM", 0), row.message.Delimiters)
+	if err != nil {
+		return
+	}
+	specimenType := spm.SpecimenType().Repetition(0)
+	if specimenType == nil || len(specimenType.Components) != 8 {
+		return
+	}
+	values["specimen_type"] = strings.ToUpper(strings.TrimSpace(row.get("SPM-4-4")))
+}
+
+// agePattern - the years at the start of an age like 30Y
+var agePattern = regexp.MustCompile(`^\d+`)
+
+// ageInDOB - mayo sends the patient's age after their date of birth, like 19000101^30Y. this is
+// non-standard HL7, so we read it ourselves, with the 122 we use for an unknown age when the years
+// aren't a number
+func ageInDOB(row *rowContext, values map[string]string) {
+	pid, err := hl7Utilities.NewSegment[hl7Utilities.PID](row.current.Segment("PID", 0), row.message.Delimiters)
+	if err != nil {
+		return
+	}
+	dob := pid.DateTimeOfBirth().Repetition(0)
+	if dob == nil || len(dob.Components) < 2 {
+		return
+	}
+	matches := agePattern.FindAllString(pid.Decode(dob.Component(2).Value()), -1)
+	if len(matches) == 0 {
+		values["pt_age"] = "122"
+		return
+	}
+	age, _ := strconv.ParseFloat(matches[0], 64)
+	values["pt_age"] = fmt.Sprintf("%.0f", math.Abs(math.Floor(age)))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hl7Decomposer/hl7Utilities"
+)
+
+// senderRow - a row context for the message, read up to its first specimen
+func senderRow(t *testing.T, message string) *rowContext {
+	parsed, err := hl7Utilities.ParseMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := newRowContext(parsed)
+	for _, segment := range parsed.Segments {
+		row.add(segment)
+		if segment.Name == "SPM" {
+			break
+		}
+	}
+	row.rule = matchSender(parsed)
+	return row
+}
+
+func TestMatchSender(t *testing.T) {
+	cases := []struct {
+		msh      string
+		expected string
+	}{
+		{"MSH|^~\\&|Mayo Clinic RD|FAC", "mayo"},
+		{"MSH|^~\\&|COREP.SONICHEALTH.ST|FAC", "sonic"},
+		{"MSH|^~\\&|horizon^1.2.3^ISO|FAC", "aegis"},
+		{"MSH|^~\\&|OTHER LAB|FAC", ""},
+	}
+	for _, c := range cases {
+		parsed, err := hl7Utilities.ParseMessage(c.msh + "|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\r")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := ""
+		if rule := matchSender(parsed); rule != nil {
+			id = rule.ID
+		}
+		if id != c.expected {
+			t.Logf("%s: expected '%s' but got '%s'", c.msh, c.expected, id)
+			t.Fail()
+		}
+	}
+}
+
+func TestLoadSenders(t *testing.T) {
+	saved := senderRules
+	defer func() { senderRules = saved }()
+	path := filepath.Join(t.TempDir(), "senders.yaml")
+	err := os.WriteFile(path, []byte(`senders:
+  - id: newlab
+    facilities: [NEW LAB DLMP]
+    oids: [2.16.840.1.113883.3.99]
+    timeZone: America/New_York
+    overrides:
+      pt_state: PID-11-8
+  # mayo moved to a new application name
+  - id: mayo
+    applications: [mayo clinic labs]
+    quirks: [age-in-dob]
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSenders(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(senderRules) != len(saved)+1 || senderRules[0].ID != "newlab" || senderRules[0].location == nil {
+		t.Fatalf("expected newlab and its time zone ahead of the built in senders but got %v", senderRules)
+	}
+	cases := map[string]string{
+		// by MSH-4-1, and by the OID in MSH-3-2
+		"MSH|^~\\&|APP|new lab dlmp":                   "newlab",
+		"MSH|^~\\&|APP^2.16.840.1.113883.3.99^ISO|FAC": "newlab",
+		"MSH|^~\\&|Mayo Clinic Labs|FAC":               "mayo",
+		// the old name went with the rule it replaced
+		"MSH|^~\\&|Mayo Clinic RD|FAC": "",
+	}
+	for msh, expected := range cases {
+		parsed, _ := hl7Utilities.ParseMessage(msh + "|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\r")
+		id := ""
+		if rule := matchSender(parsed); rule != nil {
+			id = rule.ID
+		}
+		if id != expected {
+			t.Logf("%s: expected '%s' but got '%s'", msh, expected, id)
+			t.Fail()
+		}
+	}
+	// overrides replace the column for that sender only
+	row := senderRow(t, "MSH|^~\\&|APP|NEW LAB DLMP|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rPID|1||M1||DOE^JANE||19800101|F|||^^^MN^^^^WI\rSPM|1\r")
+	values := make(map[string]string)
+	row.addColumns(values)
+	if values["pt_state"] != "WI" {
+		t.Logf("expected the override to read WI from PID-11-8 but got '%s'", values["pt_state"])
+		t.Fail()
+	}
+}
+
+func TestParseSenders_errors(t *testing.T) {
+	cases := map[string]string{
+		"no id":             "senders:\n  - applications: [lab]\n",
+		"nothing to match":  "senders:\n  - id: lab\n",
+		"unknown quirk":     "senders:\n  - id: lab\n    applications: [lab]\n    quirks: [upside-down]\n",
+		"unknown time zone": "senders:\n  - id: lab\n    applications: [lab]\n    timeZone: Mars/Olympus_Mons\n",
+		"bad override":      "senders:\n  - id: lab\n    applications: [lab]\n    overrides:\n      pt_state: PID-X\n",
+		"duplicate":         "senders:\n  - id: lab\n    applications: [lab]\n  - id: lab\n    oids: [1.2]\n",
+		"unknown setting":   "senders:\n  - id: lab\n    application: [lab]\n",
+	}
+	for name, data := range cases {
+		if _, err := parseSenders(data, false); err == nil {
+			t.Logf("%s: expected an error", name)
+			t.Fail()
+		}
+	}
+}
+
+func TestSpecimenTypeAlternateIdentifier(t *testing.T) {
+	cases := []struct {
+		spm      string
+		expected string
+	}{
+		{"SPM|1|||^^^ groin ^groin^L^^v1", "GROIN"},
+		// only the specimen types with all eight components are sent this way
+		{"SPM|1|||119297000^Blood^SCT", "unchanged"},
+		{"SPM|1", "unchanged"},
+	}
+	for _, c := range cases {
+		row := senderRow(t, "MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\r"+c.spm+"\r")
+		values := map[string]string{"specimen_type": "unchanged"}
+		specimenTypeAlternateIdentifier(row, values)
+		if values["specimen_type"] != c.expected {
+			t.Logf("%s: expected '%s' but got '%s'", c.spm, c.expected, values["specimen_type"])
+			t.Fail()
+		}
+	}
+}
+
+func TestAgeInDOB(t *testing.T) {
+	cases := []struct {
+		dob      string
+		expected string
+	}{
+		{"19000101^30Y", "30"},
+		{"^7M", "7"},
+		{"19000101^UNK", "122"},
+		// a date of birth on its own is left to the usual calculation
+		{"19000101", "unchanged"},
+	}
+	for _, c := range cases {
+		row := senderRow(t, "MSH|^~\\&|LAB|FAC|||20220802||ORU^R01^ORU_R01|1|P|2.5.1\rPID|1||M1||DOE^JANE||"+c.dob+"\r")
+		values := map[string]string{"pt_age": "unchanged"}
+		ageInDOB(row, values)
+		if values["pt_age"] != c.expected {
+			t.Logf("%s: expected '%s' but got '%s'", c.dob, c.expected, values["pt_age"])
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine - a line of a YAML file with its indentation measured and its comment removed
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// parseYAML - reads the subset of YAML our config files need into the same maps, slices, strings and
+// booleans encoding/json would give for the equivalent JSON, so both kinds of file can be decoded
+// into a Config the same way. that subset is
+//
+//	key: value          mappings, nested by indentation
+//	- item              sequences, including "- key: value" items holding mappings
+//	[a, b]              flow sequences of scalars
+//	"text" or 'text'    quoted strings
+//	true, false, null   booleans and nulls
+//
+// everything else, numbers included, is a string. anchors, multi-line strings and multiple documents
+// aren't supported
+func parseYAML(data string) (interface{}, error) {
+	var lines []*yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		text := stripYAMLComment(raw)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: YAML can't be indented with tabs", i+1)
+		}
+		lines = append(lines, &yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].number)
+	}
+	return value, nil
+}
+
+// parseYAMLBlock - reads the mapping or sequence starting at lines[i], returning it and the index of
+// the first line after it
+func parseYAMLBlock(lines []*yamlLine, i, indent int) (interface{}, int, error) {
+	if isYAMLSequenceItem(lines[i].text) {
+		return parseYAMLSequence(lines, i, indent)
+	}
+	return parseYAMLMapping(lines, i, indent)
+}
+
+// isYAMLSequenceItem - true for a line starting a sequence item
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseYAMLSequence - reads the "- item" lines at the indentation
+func parseYAMLSequence(lines []*yamlLine, i, indent int) (interface{}, int, error) {
+	sequence := []interface{}{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLSequenceItem(lines[i].text) {
+		line := lines[i]
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		switch {
+		case item == "":
+			// the item is the block on the lines below
+			if i+1 >= len(lines) || lines[i+1].indent <= indent {
+				sequence = append(sequence, nil)
+				i++
+				continue
+			}
+			value, next, err := parseYAMLBlock(lines, i+1, lines[i+1].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			sequence = append(sequence, value)
+			i = next
+		case isYAMLMappingEntry(item):
+			// "- key: value" starts a mapping whose keys line up with this one
+			line.indent += len(line.text) - len(item)
+			line.text = item
+			value, next, err := parseYAMLMapping(lines, i, line.indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			sequence = append(sequence, value)
+			i = next
+		default:
+			value, err := parseYAMLScalar(item, line.number)
+			if err != nil {
+				return nil, 0, err
+			}
+			sequence = append(sequence, value)
+			i++
+		}
+	}
+	return sequence, i, nil
+}
+
+// isYAMLMappingEntry - true for text like "key: value" or "key:"
+func isYAMLMappingEntry(text string) bool {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") || strings.HasPrefix(text, "[") {
+		return false
+	}
+	return strings.Contains(text, ": ") || strings.HasSuffix(text, ":")
+}
+
+// parseYAMLMapping - reads the "key: value" lines at the indentation
+func parseYAMLMapping(lines []*yamlLine, i, indent int) (interface{}, int, error) {
+	mapping := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent {
+		line := lines[i]
+		if !isYAMLMappingEntry(line.text) {
+			return nil, 0, fmt.Errorf("line %d: expected 'key: value' but got '%s'", line.number, line.text)
+		}
+		key, rest := line.text, ""
+		if colon := strings.Index(line.text, ": "); colon >= 0 {
+			key, rest = line.text[:colon], strings.TrimSpace(line.text[colon+2:])
+		} else {
+			key = strings.TrimSuffix(line.text, ":")
+		}
+		key = strings.TrimSpace(key)
+		if unquoted, err := parseYAMLScalar(key, line.number); err == nil {
+			if s, ok := unquoted.(string); ok {
+				key = s
+			}
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, 0, fmt.Errorf("line %d: '%s' appears more than once", line.number, key)
+		}
+		i++
+		if rest != "" {
+			value, err := parseYAMLScalar(rest, line.number)
+			if err != nil {
+				return nil, 0, err
+			}
+			mapping[key] = value
+			continue
+		}
+		// the value is the block on the lines below, which for a sequence can be at the same
+		// indentation as the key
+		if i < len(lines) && (lines[i].indent > indent || (lines[i].indent == indent && isYAMLSequenceItem(lines[i].text))) {
+			value, next, err := parseYAMLBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			mapping[key] = value
+			i = next
+			continue
+		}
+		mapping[key] = nil
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].number)
+	}
+	return mapping, i, nil
+}
+
+// parseYAMLScalar - reads a single value
+func parseYAMLScalar(text string, number int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", number, text)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", number, text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unterminated sequence %s", number, text)
+		}
+		sequence := []interface{}{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return sequence, nil
+		}
+		for _, item := range splitYAMLFlowSequence(inner) {
+			value, err := parseYAMLScalar(strings.TrimSpace(item), number)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+		}
+		return sequence, nil
+	case text == "{}":
+		return map[string]interface{}{}, nil
+	}
+	// only true and false, since yes, no, on and off are just as likely to be a code like a namespace
+	switch text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+	return text, nil
+}
+
+// splitYAMLFlowSequence - splits the inside of a flow sequence at its commas, leaving any comma inside
+// quotes alone
+func splitYAMLFlowSequence(inner string) []string {
+	var items []string
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote != 0:
+			if c == '\'' && quote == '\'' && i+1 < len(inner) && inner[i+1] == '\'' {
+				// '' is how a single quoted string holds a quote
+				i++
+			} else if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case (c == '"' || c == '\'') && strings.TrimSpace(inner[start:i]) == "":
+			// only quotes that start an item, the same as for comments
+			quote = c
+		case c == ',':
+			items = append(items, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, inner[start:])
+}
+
+// stripYAMLComment - removes a # comment from the line, leaving any # inside quotes alone
+func stripYAMLComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" :-[,", line[i-1]) >= 0):
+			// only quotes that start a value, so the apostrophe in it's doesn't hide a comment
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}